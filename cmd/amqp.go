@@ -0,0 +1,24 @@
+//go:build amqp
+
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/amqp"
+)
+
+func createAMQPExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return amqp.New(amqp.Config{
+		URL:          cast.ToString(cfg["url"]),
+		Exchange:     cast.ToString(cfg["exchange"]),
+		ExchangeType: cast.ToString(cfg["exchange_type"]),
+		RoutingKey:   cast.ToString(cfg["routing_key"]),
+		Transient:    cast.ToBool(cfg["transient"]),
+		TLS:          tlsOptions(cfg),
+		Timeout:      cast.ToDuration(cfg["timeout"]),
+		Columns:      columns,
+		Logger:       logger.With("name", name),
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !amqp
+
+package cmd
+
+import "github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+
+func createAMQPExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return nil, ErrNotEnabled
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/aws/sqs"
 )
 
-func createDynamoDBExporter(cfg map[string]any) (exporter.Exporter, error) {
+func createDynamoDBExporter(columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
 	table := cast.ToString(cfg["table"])
 	if table == "" {
 		return nil, fmt.Errorf("DynamoDB table name must be specified")
@@ -23,10 +23,11 @@ func createDynamoDBExporter(cfg map[string]any) (exporter.Exporter, error) {
 		AccessKeyID:     cast.ToString(cfg["access_key_id"]),
 		SecretAccessKey: cast.ToString(cfg["secret_access_key"]),
 		SessionToken:    cast.ToString(cfg["session_token"]),
+		Columns:         columns,
 	})
 }
 
-func createSQSExporter(cfg map[string]any) (exporter.Exporter, error) {
+func createSQSExporter(columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
 	queueName := cast.ToString(cfg["queue.name"])
 	queueURL := cast.ToString(cfg["queue.url"])
 	if queueName == "" && queueURL == "" {
@@ -39,5 +40,6 @@ func createSQSExporter(cfg map[string]any) (exporter.Exporter, error) {
 		AccessKeyID:     cast.ToString(cfg["access_key_id"]),
 		SecretAccessKey: cast.ToString(cfg["secret_access_key"]),
 		SessionToken:    cast.ToString(cfg["session_token"]),
+		Columns:         columns,
 	})
 }
@@ -4,10 +4,10 @@ package cmd
 
 import "github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 
-func createDynamoDBExporter(cfg map[string]any) (exporter.Exporter, error) {
+func createDynamoDBExporter(columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
 	return nil, ErrNotEnabled
 }
 
-func createSQSExporter(cfg map[string]any) (exporter.Exporter, error) {
+func createSQSExporter(columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
 	return nil, ErrNotEnabled
 }
@@ -20,14 +20,22 @@ var daemonCmd = &cobra.Command{
 		if err := createExporters(); err != nil {
 			return err
 		}
+		if err := createProcessors(); err != nil {
+			return err
+		}
 		interval := viper.GetDuration("interval")
 		cfg := scanner.DefaultConfig()
 		cfg.DeviceName = device
 		cfg.Peripherals = peripherals
 		cfg.Exporters = exporters
+		cfg.Processors = processors
 		cfg.Logger = logger
+		queueCfg, err := queueConfig()
+		if err != nil {
+			return err
+		}
+		cfg.Queue = queueCfg
 		var scn scanner.Scanner
-		var err error
 		if interval == 0 {
 			scn, err = scanner.NewContinuous(cfg)
 		} else {
@@ -38,6 +46,9 @@ var daemonCmd = &cobra.Command{
 		}
 		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer cancel()
+		if statsInterval := viper.GetDuration("queue.stats_interval"); statsInterval > 0 {
+			go logQueueStats(ctx, scn, statsInterval)
+		}
 		err = scn.Scan(ctx, interval)
 		return errors.Join(err, scn.Close(), closeExporters())
 	},
@@ -3,22 +3,37 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/scanner"
 )
 
-var discoverTimeout time.Duration
+var (
+	discoverTimeout time.Duration
+	discoverBattery bool
+)
 
 var discoverCmd = &cobra.Command{
 	Use:   "discover",
 	Short: "Discover all nearby RuuviTags",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		logger.Debug("Discovering nearby RuuviTags")
+		if discoverBattery {
+			return discoverBatteryStatus(cmd)
+		}
 		addrs, err := discover(discoverTimeout)
 		if err != nil {
 			return err
@@ -33,11 +48,20 @@ var discoverCmd = &cobra.Command{
 
 func init() {
 	discoverCmd.Flags().DurationVar(&discoverTimeout, "timeout", 30*time.Second, "timeout for discovery")
+	discoverCmd.Flags().BoolVar(&discoverBattery, "battery", false, "show battery status and estimated battery life")
 
 	rootCmd.AddCommand(discoverCmd)
 }
 
-func discover(timeout time.Duration) (ruuviTags []string, err error) {
+func discover(timeout time.Duration) ([]string, error) {
+	data, err := discoverData(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(data)), nil
+}
+
+func discoverData(timeout time.Duration) (data map[string]sensor.Data, err error) {
 	var d *scanner.Discover
 	d, err = scanner.NewDiscover(device, &scanner.GoBLEScanner{}, &scanner.GoBLEDeviceCreator{}, logger)
 	if err != nil {
@@ -53,6 +77,70 @@ func discover(timeout time.Duration) (ruuviTags []string, err error) {
 	defer timeoutCancel()
 	ctx, sigIntCancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer sigIntCancel()
-	ruuviTags, err = d.Discover(ctx)
+	data, err = d.DiscoverData(ctx)
 	return
 }
+
+func discoverBatteryStatus(cmd *cobra.Command) error {
+	monitor, err := batteryMonitor()
+	if err != nil {
+		return err
+	}
+	data, err := discoverData(discoverTimeout)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]string)
+	for addr, name := range viper.GetStringMapString("ruuvitags") {
+		names[strings.ToUpper(addr)] = name
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStderr(), 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(w, "ADDRESS\tNAME\tBATTERY\tSTATUS\tESTIMATED LIFE"); err != nil {
+		return err
+	}
+	for _, addr := range slices.Sorted(maps.Keys(data)) {
+		d := data[addr]
+		d.Name = names[addr]
+		status := monitor.BatteryStatus(d)
+		voltage, state, life := "-", "-", "-"
+		if status.Voltage > 0 {
+			voltage = fmt.Sprintf("%.3f V", status.Voltage)
+			state = "ok"
+			if status.Low {
+				state = "low"
+			}
+		}
+		if status.HasEstimate {
+			life = fmt.Sprintf("%.0f days", status.LifeDays)
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", addr, d.Name, voltage, state, life); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// batteryMonitor returns the first configured battery processor or a battery processor with
+// default settings if none is configured
+func batteryMonitor() (processor.BatteryMonitor, error) {
+	configs, err := parseProcessorConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		cfg := configs[name]
+		if cast.ToString(cfg["type"]) != "battery" {
+			continue
+		}
+		proc, err := createProcessor(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return proc.(processor.BatteryMonitor), nil
+	}
+	proc, err := processor.NewBattery("battery", processor.BatteryConfig{Logger: logger})
+	if err != nil {
+		return nil, err
+	}
+	return proc.(processor.BatteryMonitor), nil
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/sqlite"
+)
+
+const exportBatchSize = 100
+
+var (
+	exportDB        string
+	exportTable     string
+	exportSince     time.Duration
+	exportHourly    bool
+	exportExporters []string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Send measurements stored by the sqlite exporter to other exporters",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configs, err := getExporterConfigs()
+		if err != nil {
+			return err
+		}
+		q := sqlite.Query{
+			Path:    exportDB,
+			Table:   exportTable,
+			From:    time.Now().Add(-exportSince),
+			Hourly:  exportHourly,
+			Columns: columnMap(),
+		}
+		// Default to the database of the configured sqlite exporter
+		for _, name := range slices.Sorted(maps.Keys(configs)) {
+			cfg := configs[name]
+			if cast.ToString(cfg["type"]) == "sqlite" && q.Path == "" {
+				q.Path = cast.ToString(cfg["path"])
+				if q.Table == "" {
+					q.Table = cast.ToString(cfg["table"])
+				}
+			}
+		}
+		if q.Path == "" {
+			return fmt.Errorf("database must be specified with --db or a sqlite exporter")
+		}
+		if err := createExportTargets(configs, q.Columns); err != nil {
+			return errors.Join(err, closeExporters())
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		count := 0
+		batch := make([]exporter.Measurement, 0, exportBatchSize)
+		flush := func() error {
+			for _, exp := range exporters {
+				if err := exporter.ExportBatch(ctx, exp, batch); err != nil {
+					return fmt.Errorf("failed to export to %s: %w", exp.Name(), err)
+				}
+			}
+			count += len(batch)
+			batch = batch[:0]
+			return nil
+		}
+		err = readSQLite(ctx, q, func(m exporter.Measurement) error {
+			batch = append(batch, m)
+			if len(batch) < exportBatchSize {
+				return nil
+			}
+			return flush()
+		})
+		if err == nil && len(batch) > 0 {
+			err = flush()
+		}
+		logger.LogAttrs(ctx, slog.LevelInfo, "Exported stored measurements", slog.String("db", q.Path), slog.Int("count", count))
+		return errors.Join(err, closeExporters())
+	},
+}
+
+// createExportTargets creates the exporters selected with --exporter, or all exporters
+// other than sqlite exporters
+func createExportTargets(configs map[string]map[string]any, columns map[string]string) error {
+	names := exportExporters
+	if len(names) == 0 {
+		for _, name := range slices.Sorted(maps.Keys(configs)) {
+			if cast.ToString(configs[name]["type"]) != "sqlite" {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no exporters to send the measurements to")
+	}
+	for _, name := range names {
+		cfg, ok := configs[name]
+		if !ok {
+			return fmt.Errorf("exporter %s is not configured", name)
+		}
+		exp, err := createExporter(name, cfg, columns)
+		if err != nil {
+			return err
+		}
+		exporters = append(exporters, createRetry(name, exp, cfg))
+	}
+	return nil
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportDB, "db", "", "SQLite database path, defaults to the database of the sqlite exporter")
+	exportCmd.Flags().StringVar(&exportTable, "table", "", "table name, defaults to the table of the sqlite exporter")
+	exportCmd.Flags().DurationVar(&exportSince, "since", 24*time.Hour, "export measurements stored within this duration")
+	exportCmd.Flags().BoolVar(&exportHourly, "hourly", false, "export hourly averages instead of raw measurements")
+	exportCmd.Flags().StringSliceVar(&exportExporters, "exporter", nil, "names of the exporters to send measurements to, defaults to all except sqlite exporters")
+
+	rootCmd.AddCommand(exportCmd)
+}
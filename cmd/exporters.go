@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log/slog"
 	"maps"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-ble/ble"
@@ -16,6 +18,8 @@ import (
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/console"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/http"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/spool"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
 )
 
 func createExporters() error {
@@ -27,10 +31,7 @@ func createExporters() error {
 		return fmt.Errorf("at least one RuuviTag address must be specified")
 	}
 	logger.LogAttrs(context.TODO(), slog.LevelInfo, "RuuviTags", slog.Any("ruuvitags", ruuviTags))
-	columns := viper.GetStringMapString("columns")
-	if len(columns) == 0 {
-		columns = sensor.DefaultColumnMap
-	}
+	columns := columnMap()
 	logger.LogAttrs(context.TODO(), slog.LevelInfo, "Using column mapping", slog.Any("columns", columns))
 	peripherals = make(map[string]string)
 	for addr, name := range ruuviTags {
@@ -45,6 +46,10 @@ func createExporters() error {
 		if err != nil {
 			return err
 		}
+		exp = createRetry(name, exp, cfg)
+		if exp, err = createSpool(name, exp, cfg); err != nil {
+			return err
+		}
 		exporters = append(exporters, exp)
 	}
 	device = viper.GetString(deviceConfigKey)
@@ -69,28 +74,70 @@ func createExporter(name string, cfg map[string]any, columns map[string]string)
 	switch tp {
 	case "influxdb":
 		exp, err = createInfluxDBExporter(columns, cfg)
+	case "influxdb1":
+		exp, err = createInfluxDBV1Exporter(columns, cfg)
 	case "console":
 		exp = console.New(name)
 	case "pubsub":
 		exp, err = createPubSubExporter(columns, cfg)
 	case "dynamodb":
-		exp, err = createDynamoDBExporter(cfg)
+		exp, err = createDynamoDBExporter(columns, cfg)
 	case "sqs":
-		exp, err = createSQSExporter(cfg)
+		exp, err = createSQSExporter(columns, cfg)
 	case "postgres":
 		exp, err = createPostgresExporter(name, columns, cfg)
 	case "http":
-		addr := cast.ToString(cfg["addr"])
-		token := cast.ToString(cfg["token"])
+		addr := cast.ToString(cfg["url"])
+		if addr == "" {
+			addr = cast.ToString(cfg["addr"])
+		}
+		timeout := cast.ToDuration(cfg["timeout"])
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
 		exp, err = http.New(http.Config{
-			URL:     addr,
-			Token:   token,
-			Timeout: 10 * time.Second,
-			Columns: columns,
-			Logger:  logger,
+			URL:               addr,
+			EventURL:          cast.ToString(cfg["event_url"]),
+			Token:             cast.ToString(cfg["token"]),
+			Method:            cast.ToString(cfg["method"]),
+			Headers:           cast.ToStringMapString(cfg["headers"]),
+			Secret:            cast.ToString(cfg["secret"]),
+			SignatureHeader:   cast.ToString(cfg["signature_header"]),
+			Gzip:              cast.ToBool(cfg["gzip"]),
+			Template:          cast.ToString(cfg["template"]),
+			ContentType:       cast.ToString(cfg["content_type"]),
+			RetryableStatuses: retryableStatuses(cfg["retryable_statuses"]),
+			Timeout:           timeout,
+			TLS:               tlsOptions(cfg),
+			Columns:           columns,
+			Logger:            logger.With("name", name),
 		})
 	case "mqtt":
-		exp, err = createMQTTExporter(cfg)
+		exp, err = createMQTTExporter(name, columns, cfg)
+	case "prometheus":
+		exp, err = createPrometheusExporter(name, columns, cfg)
+	case "remote_write":
+		exp, err = createRemoteWriteExporter(name, columns, cfg)
+	case "otlp":
+		exp, err = createOTLPExporter(name, columns, cfg)
+	case "graphite":
+		exp, err = createGraphiteExporter(name, columns, cfg)
+	case "statsd":
+		exp, err = createStatsDExporter(name, columns, cfg)
+	case "sqlite":
+		exp, err = createSQLiteExporter(name, columns, cfg)
+	case "file":
+		exp, err = createFileExporter(name, columns, cfg)
+	case "parquet":
+		exp, err = createParquetExporter(name, columns, cfg)
+	case "kafka":
+		exp, err = createKafkaExporter(name, columns, cfg)
+	case "nats":
+		exp, err = createNATSExporter(name, columns, cfg)
+	case "amqp":
+		exp, err = createAMQPExporter(name, columns, cfg)
+	case "redis":
+		exp, err = createRedisExporter(name, columns, cfg)
 	default:
 		err = fmt.Errorf("invalid exporter type: %s", tp)
 	}
@@ -100,6 +147,105 @@ func createExporter(name string, cfg map[string]any, columns map[string]string)
 	return
 }
 
+// createRetry wraps the exporter with retries and a circuit breaker if the exporter config
+// has a retry section
+func createRetry(name string, exp exporter.Exporter, cfg map[string]any) exporter.Exporter {
+	raw, ok := cfg["retry"]
+	if !ok {
+		return exp
+	}
+	retryCfg := cast.ToStringMap(raw)
+	logger.LogAttrs(context.TODO(), slog.LevelInfo, "Using retries", slog.String("name", name), slog.Any("config", retryCfg))
+	return exporter.WithRetry(exp, exporter.RetryConfig{
+		MaxAttempts:      cast.ToInt(retryCfg["max_attempts"]),
+		InitialBackoff:   cast.ToDuration(retryCfg["initial_backoff"]),
+		MaxBackoff:       cast.ToDuration(retryCfg["max_backoff"]),
+		Multiplier:       cast.ToFloat64(retryCfg["multiplier"]),
+		FailureThreshold: cast.ToInt(retryCfg["failure_threshold"]),
+		OpenTimeout:      cast.ToDuration(retryCfg["open_timeout"]),
+		Logger:           logger,
+	})
+}
+
+// createSpool wraps the exporter with a spool that stores failed measurements on disk
+// if the exporter config has a spool section
+func createSpool(name string, exp exporter.Exporter, cfg map[string]any) (exporter.Exporter, error) {
+	raw, ok := cfg["spool"]
+	if !ok {
+		return exp, nil
+	}
+	spoolCfg := cast.ToStringMap(raw)
+	maxSize, err := parseSize(spoolCfg["max_size"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid spool max_size for exporter %s: %w", name, err)
+	}
+	logger.LogAttrs(context.TODO(), slog.LevelInfo, "Using spool", slog.String("name", name), slog.Any("config", spoolCfg))
+	spooled, err := spool.New(exp, spool.Config{
+		Dir:           cast.ToString(spoolCfg["dir"]),
+		MaxSize:       maxSize,
+		MaxAge:        cast.ToDuration(spoolCfg["max_age"]),
+		RetryInterval: cast.ToDuration(spoolCfg["retry_interval"]),
+		Logger:        logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool for exporter %s: %w", name, err)
+	}
+	return spooled, nil
+}
+
+// parseSize parses a size in bytes given either as a number or as a string with a
+// KB, MB or GB suffix
+func parseSize(raw any) (int64, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return cast.ToInt64E(raw)
+	}
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if trimmed, ok := strings.CutSuffix(s, suffix); ok {
+			s = strings.TrimSpace(trimmed)
+			multiplier = m
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(s, "B"), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// tlsOptions returns the TLS options shared by the exporters
+func tlsOptions(cfg map[string]any) tlsconfig.Config {
+	return tlsconfig.Config{
+		CaFile:             cast.ToString(cfg["ca_file"]),
+		CertFile:           cast.ToString(cfg["cert_file"]),
+		KeyFile:            cast.ToString(cfg["key_file"]),
+		ServerName:         cast.ToString(cfg["server_name"]),
+		MinVersion:         cast.ToString(cfg["min_tls_version"]),
+		InsecureSkipVerify: cast.ToBool(cfg["insecure_skip_verify"]),
+	}
+}
+
+// retryableStatuses returns the configured retryable HTTP statuses, or nil to use the
+// defaults of the exporter
+func retryableStatuses(raw any) []int {
+	if raw == nil {
+		return nil
+	}
+	return cast.ToIntSlice(raw)
+}
+
+// columnMap returns the configured column mapping or the default one
+func columnMap() map[string]string {
+	columns := viper.GetStringMapString("columns")
+	if len(columns) == 0 {
+		columns = sensor.DefaultColumnMap
+	}
+	return columns
+}
+
 func closeExporters() error {
 	var errs []error
 	for _, exp := range exporters {
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/file"
+)
+
+func createFileExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	maxSize, err := parseSize(cfg["max_size"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_size for exporter %s: %w", name, err)
+	}
+	return file.New(file.Config{
+		Dir:            cast.ToString(cfg["dir"]),
+		Format:         cast.ToString(cfg["format"]),
+		Template:       cast.ToString(cfg["template"]),
+		MaxSize:        maxSize,
+		RotateInterval: cast.ToDuration(cfg["rotate_interval"]),
+		Compress:       cast.ToBool(cfg["compress"]),
+		Columns:        columns,
+		Logger:         logger.With("name", name),
+	})
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/graphite"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/statsd"
+)
+
+func createGraphiteExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return graphite.New(graphite.Config{
+		Addr:     cast.ToString(cfg["addr"]),
+		Prefix:   cast.ToString(cfg["prefix"]),
+		Template: graphite.Template(cast.ToString(cfg["template"])),
+		Timeout:  cast.ToDuration(cfg["timeout"]),
+		Columns:  columns,
+		Logger:   logger.With("name", name),
+	})
+}
+
+func createStatsDExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return statsd.New(statsd.Config{
+		Addr:      cast.ToString(cfg["addr"]),
+		Prefix:    cast.ToString(cfg["prefix"]),
+		Template:  graphite.Template(cast.ToString(cfg["template"])),
+		Tags:      cast.ToBool(cfg["tags"]),
+		ExtraTags: cast.ToStringMapString(cfg["extra_tags"]),
+		Columns:   columns,
+		Logger:    logger.With("name", name),
+	})
+}
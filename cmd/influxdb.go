@@ -38,3 +38,27 @@ func createInfluxDBExporter(columns map[string]string, cfg map[string]any) (expo
 	)
 	return influxdb.New(influxCfg)
 }
+
+func createInfluxDBV1Exporter(columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	influxCfg := influxdb.V1Config{
+		Addr:            cast.ToString(cfg["addr"]),
+		Database:        cast.ToString(cfg["database"]),
+		RetentionPolicy: cast.ToString(cfg["retention_policy"]),
+		Username:        cast.ToString(cfg["username"]),
+		Password:        cast.ToString(cfg["password"]),
+		Measurement:     cast.ToString(cfg["measurement"]),
+		PayloadSize:     cast.ToInt(cfg["payload_size"]),
+		Timeout:         cast.ToDuration(cfg["timeout"]),
+		Columns:         columns,
+		Logger:          logger,
+	}
+	logger.LogAttrs(
+		nil,
+		slog.LevelInfo,
+		"Connecting to InfluxDB v1",
+		slog.String("addr", influxCfg.Addr),
+		slog.String("database", influxCfg.Database),
+		slog.Any("columns", columns),
+	)
+	return influxdb.NewV1(influxCfg)
+}
@@ -7,3 +7,7 @@ import "github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 func createInfluxDBExporter(columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
 	return nil, ErrNotEnabled
 }
+
+func createInfluxDBV1Exporter(columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return nil, ErrNotEnabled
+}
@@ -1,22 +1,38 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/configfile"
 )
 
 var (
 	initTimeout   time.Duration
 	outputCfgFile string
+	initYes       bool
+	initDryRun    bool
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init",
-	Short: "Discover all nearby RuuviTags and create a configuration file",
+	Short: "Discover all nearby RuuviTags and create or update a configuration file",
+	Long: `Discover all nearby RuuviTags and add them to a configuration file.
+
+If the output file already exists, only newly discovered RuuviTags are added to it and
+the rest of the file is left untouched. When run on a terminal, a name is asked for each
+new RuuviTag and the changes are shown for confirmation before writing.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		logger.Debug("Discovering nearby RuuviTags")
 		addrs, err := discover(initTimeout)
@@ -24,31 +40,136 @@ var initCmd = &cobra.Command{
 			return err
 		}
 		logger.Debug("Discovered RuuviTags", "addrs", addrs)
-		builder := new(strings.Builder)
-		builder.WriteString("interval = \"0m\"\n")
-		builder.WriteString("device = \"default\"\n\n")
-		builder.WriteString("[ruuvitags]\n")
-		for i, addr := range addrs {
-			if _, err := fmt.Fprintf(builder, "\"%s\" = \"RuuviTag %d\"\n", addr, i+1); err != nil {
-				panic(err)
+		baseFile := outputCfgFile
+		if baseFile == "" {
+			baseFile = viper.ConfigFileUsed()
+		}
+		content, err := readConfigFile(baseFile)
+		if err != nil {
+			return err
+		}
+		existing, err := configfile.RuuviTags(content)
+		if err != nil {
+			return err
+		}
+		newAddrs := configfile.NewRuuviTags(existing, addrs)
+		if len(newAddrs) == 0 {
+			logger.Info("No new RuuviTags discovered")
+			if outputCfgFile == "" {
+				cmd.Println(string(content))
+			}
+			return nil
+		}
+		interactive := isTerminal(os.Stdin) && isTerminal(os.Stdout)
+		in := bufio.NewReader(cmd.InOrStdin())
+		tags := make(map[string]string)
+		for i, addr := range newAddrs {
+			name := fmt.Sprintf("RuuviTag %d", len(existing)+i+1)
+			if interactive {
+				name, err = prompt(cmd, in, fmt.Sprintf("Name for RuuviTag %s [%s]: ", addr, name), name)
+				if err != nil {
+					return err
+				}
 			}
+			tags[addr] = name
+		}
+		updated, err := configfile.AddRuuviTags(content, tags)
+		if err != nil {
+			return err
 		}
-		if outputCfgFile != "" {
-			logger.Info("Writing config to file", "file", outputCfgFile)
-			//nolint:gosec
-			if err := os.WriteFile(outputCfgFile, []byte(builder.String()), 0644); err != nil { //nolint:gosec
+		if outputCfgFile == "" {
+			cmd.Println(string(updated))
+			return nil
+		}
+		cmd.Print(configfile.Diff(outputCfgFile, outputCfgFile, string(content), string(updated)))
+		if initDryRun {
+			return nil
+		}
+		if interactive && !initYes {
+			answer, err := prompt(cmd, in, fmt.Sprintf("Write changes to %s? [y/N]: ", outputCfgFile), "n")
+			if err != nil {
 				return err
 			}
-		} else {
-			cmd.Println(builder.String())
+			if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+				logger.Info("Config file not written")
+				return nil
+			}
 		}
-		return nil
+		logger.Info("Writing config to file", "file", outputCfgFile)
+		return writeConfigFile(outputCfgFile, updated)
 	},
 }
 
 func init() {
 	initCmd.Flags().DurationVar(&initTimeout, "timeout", 30*time.Second, "timeout for discovery")
-	initCmd.Flags().StringVarP(&outputCfgFile, "output", "o", "", "write config to a file")
+	initCmd.Flags().StringVarP(&outputCfgFile, "output", "o", "", "write config to a file, merging with its existing contents")
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "write config without asking for confirmation")
+	initCmd.Flags().BoolVar(&initDryRun, "dry-run", false, "only show the changes that would be written")
 
 	rootCmd.AddCommand(initCmd)
 }
+
+func readConfigFile(name string) ([]byte, error) {
+	if name == "" {
+		return []byte(configfile.Template), nil
+	}
+	content, err := os.ReadFile(name) //nolint:gosec
+	if errors.Is(err, fs.ErrNotExist) {
+		return []byte(configfile.Template), nil
+	}
+	return content, err
+}
+
+// writeConfigFile replaces the config file by writing the content to a temporary file in
+// the same directory and renaming it over the original, so that a crash cannot leave a
+// partially written config behind
+func writeConfigFile(name string, content []byte) (err error) {
+	var mode fs.FileMode = 0644
+	if fi, err := os.Stat(name); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	dir := filepath.Dir(name)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(content); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	if err := f.Chmod(mode); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	if err := errors.Join(f.Sync(), f.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
+
+func prompt(cmd *cobra.Command, in *bufio.Reader, msg, defaultValue string) (string, error) {
+	cmd.Print(msg)
+	answer, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultValue, nil
+	}
+	return answer, nil
+}
+
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
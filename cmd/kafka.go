@@ -0,0 +1,34 @@
+//go:build kafka
+
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/kafka"
+)
+
+func createKafkaExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return kafka.New(kafka.Config{
+		Brokers:                cast.ToStringSlice(cfg["brokers"]),
+		Topic:                  cast.ToString(cfg["topic"]),
+		Format:                 cast.ToString(cfg["format"]),
+		SchemaRegistry:         cast.ToString(cfg["schema_registry"]),
+		SchemaRegistryUsername: cast.ToString(cfg["schema_registry_username"]),
+		SchemaRegistryPassword: cast.ToString(cfg["schema_registry_password"]),
+		SASLMechanism:          cast.ToString(cfg["sasl_mechanism"]),
+		Username:               cast.ToString(cfg["username"]),
+		Password:               cast.ToString(cfg["password"]),
+		UseTLS:                 cast.ToBool(cfg["tls"]),
+		TLS:                    tlsOptions(cfg),
+		Acks:                   cast.ToString(cfg["acks"]),
+		DisableIdempotence:     cast.ToBool(cfg["disable_idempotence"]),
+		Compression:            cast.ToString(cfg["compression"]),
+		Linger:                 cast.ToDuration(cfg["linger"]),
+		BatchMaxBytes:          cast.ToInt32(cfg["batch_max_bytes"]),
+		Timeout:                cast.ToDuration(cfg["timeout"]),
+		Columns:                columns,
+		Logger:                 logger.With("name", name),
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !kafka
+
+package cmd
+
+import "github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+
+func createKafkaExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return nil, ErrNotEnabled
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
 )
 
 var mockCmd = &cobra.Command{
@@ -18,6 +20,9 @@ var mockCmd = &cobra.Command{
 		if err := createExporters(); err != nil {
 			return err
 		}
+		if err := createProcessors(); err != nil {
+			return err
+		}
 		err := sendMockMeasurement()
 		return errors.Join(err, closeExporters())
 	},
@@ -29,17 +34,25 @@ func init() {
 
 func sendMockMeasurement() error {
 	ts := time.Now()
-	measurements := make([]sensor.Data, 0, len(peripherals))
-	for addr, name := range peripherals {
-		measurements = append(measurements, generateMockData(addr, name, ts))
-	}
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	for _, exporter := range exporters {
-		logger.LogAttrs(ctx, slog.LevelInfo, "Sending mock measurement to exporter", slog.String("exporter", exporter.Name()))
-		for _, data := range measurements {
-			logger.LogAttrs(ctx, slog.LevelDebug, "Exporting measurement", slog.String("exporter", exporter.Name()), slog.Any("data", data))
-			if err := exporter.Export(ctx, data); err != nil {
+	measurements := make([]processor.Measurement, 0, len(peripherals))
+	for addr, name := range peripherals {
+		m, err := processors.Process(ctx, generateMockData(addr, name, ts))
+		if errors.Is(err, processor.ErrDrop) {
+			logger.LogAttrs(ctx, slog.LevelInfo, "Dropped mock measurement", slog.String("addr", addr), slog.Any("reason", err))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		measurements = append(measurements, m)
+	}
+	for _, exp := range exporters {
+		logger.LogAttrs(ctx, slog.LevelInfo, "Sending mock measurement to exporter", slog.String("exporter", exp.Name()))
+		for _, m := range measurements {
+			logger.LogAttrs(ctx, slog.LevelDebug, "Exporting measurement", slog.String("exporter", exp.Name()), slog.Any("data", m.Data))
+			if err := exp.Export(exporter.WithExtraColumns(ctx, m.Extra), m.Data); err != nil {
 				return err
 			}
 		}
@@ -3,7 +3,6 @@
 package cmd
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/spf13/cast"
@@ -12,18 +11,27 @@ import (
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/mqtt"
 )
 
-func createMQTTExporter(cfg map[string]any) (exporter.Exporter, error) {
-	addr := cast.ToString(cfg["addr"])
-	if addr == "" {
-		return nil, fmt.Errorf("MQTT broker address must be specified")
-	}
+func createMQTTExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
 	return mqtt.New(mqtt.Config{
-		Addr:              addr,
-		ClientId:          cast.ToString(cfg["client_id"]),
-		Username:          cast.ToString(cfg["username"]),
-		Password:          cast.ToString(cfg["password"]),
-		CaFile:            cast.ToString(cfg["ca_file"]),
-		AutoReconnect:     cast.ToBool(cfg["auto_reconnect"]),
-		ReconnectInterval: time.Duration(cast.ToInt(cfg["reconnect_interval"])) * time.Second,
+		Addr:                cast.ToString(cfg["addr"]),
+		ClientId:            cast.ToString(cfg["client_id"]),
+		Username:            cast.ToString(cfg["username"]),
+		Password:            cast.ToString(cfg["password"]),
+		TLS:                 tlsOptions(cfg),
+		AutoReconnect:       cast.ToBool(cfg["auto_reconnect"]),
+		ReconnectInterval:   time.Duration(cast.ToInt(cfg["reconnect_interval"])) * time.Second,
+		Topic:               cast.ToString(cfg["topic"]),
+		QoS:                 cast.ToUint8(cfg["qos"]),
+		Retain:              cast.ToBool(cfg["retain"]),
+		PerField:            cast.ToBool(cfg["per_field"]),
+		StatusTopic:         cast.ToString(cfg["status_topic"]),
+		BirthPayload:        cast.ToString(cfg["birth_payload"]),
+		WillPayload:         cast.ToString(cfg["will_payload"]),
+		HomeAssistant:       cast.ToBool(cfg["home_assistant"]),
+		DiscoveryPrefix:     cast.ToString(cfg["discovery_prefix"]),
+		AvailabilityTimeout: cast.ToDuration(cfg["availability_timeout"]),
+		Units:               cast.ToStringMapString(cfg["units"]),
+		Columns:             columns,
+		Logger:              logger.With("name", name),
 	})
 }
@@ -4,6 +4,6 @@ package cmd
 
 import "github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 
-func createMQTTExporter(cfg map[string]any) (exporter.Exporter, error) {
+func createMQTTExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
 	return nil, ErrNotEnabled
 }
@@ -0,0 +1,28 @@
+//go:build nats
+
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/nats"
+)
+
+func createNATSExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return nats.New(nats.Config{
+		URL:             cast.ToString(cfg["url"]),
+		Subject:         cast.ToString(cfg["subject"]),
+		Username:        cast.ToString(cfg["username"]),
+		Password:        cast.ToString(cfg["password"]),
+		Token:           cast.ToString(cfg["token"]),
+		CredentialsFile: cast.ToString(cfg["credentials_file"]),
+		TLS:             tlsOptions(cfg),
+		JetStream:       cast.ToBool(cfg["jetstream"]),
+		Stream:          cast.ToString(cfg["stream"]),
+		Deduplicate:     cast.ToBool(cfg["deduplicate"]),
+		Timeout:         cast.ToDuration(cfg["timeout"]),
+		Columns:         columns,
+		Logger:          logger.With("name", name),
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !nats
+
+package cmd
+
+import "github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+
+func createNATSExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return nil, ErrNotEnabled
+}
@@ -0,0 +1,25 @@
+//go:build otlp
+
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/otlp"
+)
+
+func createOTLPExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return otlp.New(otlp.Config{
+		Protocol:    cast.ToString(cfg["protocol"]),
+		Endpoint:    cast.ToString(cfg["endpoint"]),
+		Headers:     cast.ToStringMapString(cfg["headers"]),
+		Insecure:    cast.ToBool(cfg["insecure"]),
+		TLS:         tlsOptions(cfg),
+		Prefix:      cast.ToString(cfg["prefix"]),
+		ServiceName: cast.ToString(cfg["service_name"]),
+		Timeout:     cast.ToDuration(cfg["timeout"]),
+		Columns:     columns,
+		Logger:      logger.With("name", name),
+	})
+}
@@ -0,0 +1,28 @@
+//go:build parquet
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/parquet"
+)
+
+func createParquetExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	maxSize, err := parseSize(cfg["max_size"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_size for exporter %s: %w", name, err)
+	}
+	return parquet.New(parquet.Config{
+		Dir:            cast.ToString(cfg["dir"]),
+		Compression:    cast.ToString(cfg["compression"]),
+		RowGroupSize:   cast.ToInt(cfg["row_group_size"]),
+		MaxSize:        maxSize,
+		RotateInterval: cast.ToDuration(cfg["rotate_interval"]),
+		Columns:        columns,
+		Logger:         logger.With("name", name),
+	})
+}
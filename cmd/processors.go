@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
+)
+
+func createProcessors() error {
+	configs, err := parseProcessorConfig()
+	if err != nil {
+		return err
+	}
+	names := viper.GetStringSlice("pipeline")
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(configs))
+	}
+	for _, name := range names {
+		cfg, ok := configs[name]
+		if !ok {
+			return fmt.Errorf("processor %s in pipeline is not configured", name)
+		}
+		proc, err := createProcessor(name, cfg)
+		if err != nil {
+			return err
+		}
+		processors = append(processors, proc)
+	}
+	if len(processors) > 0 {
+		logger.LogAttrs(context.TODO(), slog.LevelInfo, "Using processing pipeline", slog.Any("processors", names))
+	}
+	return nil
+}
+
+func createProcessor(name string, cfg map[string]any) (proc processor.Processor, err error) {
+	tp, err := cast.ToStringE(cfg["type"])
+	if err != nil || tp == "" {
+		err = fmt.Errorf("processor type is not specified in config: %v", cfg)
+		return
+	}
+	logger.Info("Creating processor", "name", name, "type", tp)
+	switch tp {
+	case "filter":
+		var filterCfg processor.FilterConfig
+		filterCfg.Include = cast.ToStringSlice(cfg["include"])
+		filterCfg.Exclude = cast.ToStringSlice(cfg["exclude"])
+		if filterCfg.Min, err = toFloatMap(cfg["min"]); err != nil {
+			break
+		}
+		if filterCfg.Max, err = toFloatMap(cfg["max"]); err != nil {
+			break
+		}
+		proc, err = processor.NewFilter(name, filterCfg)
+	case "calibrate":
+		offsets := make(map[string]map[string]float64)
+		for tag, fields := range cast.ToStringMap(cfg["offsets"]) {
+			if offsets[tag], err = toFloatMap(fields); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+		proc, err = processor.NewCalibrate(name, processor.CalibrateConfig{
+			Offsets: offsets,
+		})
+	case "convert":
+		proc, err = processor.NewConvert(name, processor.ConvertConfig{
+			Temperature: cast.ToString(cfg["temperature"]),
+			Pressure:    cast.ToString(cfg["pressure"]),
+		})
+	case "outlier":
+		outlierCfg := processor.OutlierConfig{
+			Fields:    cast.ToStringSlice(cfg["fields"]),
+			Window:    cast.ToInt(cfg["window"]),
+			Threshold: cast.ToFloat64(cfg["threshold"]),
+			Action:    cast.ToString(cfg["action"]),
+			Logger:    logger,
+		}
+		if outlierCfg.MaxRate, err = toFloatMap(cfg["max_rate"]); err != nil {
+			break
+		}
+		if outlierCfg.Tolerance, err = toFloatMap(cfg["tolerance"]); err != nil {
+			break
+		}
+		proc, err = processor.NewOutlier(name, outlierCfg)
+	case "motion":
+		motionCfg := processor.MotionConfig{
+			Hysteresis: cast.ToFloat64(cfg["hysteresis"]),
+			Handler:    newEventHandler(),
+			Logger:     logger,
+		}
+		if motionCfg.Thresholds, err = toFloatMap(cfg["thresholds"]); err != nil {
+			break
+		}
+		proc, err = processor.NewMotion(name, motionCfg)
+	case "battery":
+		batteryCfg := processor.BatteryConfig{
+			LowVoltage:             cast.ToFloat64(cfg["low_voltage"]),
+			TemperatureCoefficient: cast.ToFloat64(cfg["temperature_coefficient"]),
+			ReferenceTemperature:   cast.ToFloat64(cfg["reference_temperature"]),
+			SampleInterval:         cast.ToDuration(cfg["sample_interval"]),
+			History:                cast.ToDuration(cfg["history"]),
+			MinHistory:             cast.ToDuration(cfg["min_history"]),
+			StateFile:              cast.ToString(cfg["state_file"]),
+			Handler:                newEventHandler(),
+			Logger:                 logger,
+		}
+		if raw, ok := cfg["thresholds"]; ok {
+			for _, t := range cast.ToSlice(raw) {
+				threshold := cast.ToStringMap(t)
+				batteryCfg.Thresholds = append(batteryCfg.Thresholds, processor.BatteryThreshold{
+					Temperature: cast.ToFloat64(threshold["temperature"]),
+					Voltage:     cast.ToFloat64(threshold["voltage"]),
+				})
+			}
+		}
+		proc, err = processor.NewBattery(name, batteryCfg)
+	default:
+		err = fmt.Errorf("invalid processor type: %s", tp)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to create processor %s: %w", name, err)
+	}
+	return
+}
+
+// newEventHandler returns a handler that logs events and sends them to all exporters
+// that support events
+func newEventHandler() event.Handler {
+	handlers := []event.Handler{event.NewLogHandler(logger)}
+	for _, exp := range exporters {
+		if ee, ok := exp.(exporter.EventExporter); ok {
+			handlers = append(handlers, event.HandlerFunc(ee.ExportEvent))
+		}
+	}
+	return event.Multi(handlers...)
+}
+
+func parseProcessorConfig() (map[string]map[string]any, error) {
+	configs := make(map[string]map[string]any)
+	raw := viper.Get("processors")
+	if raw == nil {
+		return configs, nil
+	}
+	cfgMap, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid processors config: %v", raw)
+	}
+	for name, cfg := range cfgMap {
+		values, ok := cfg.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid config for processor %s: %v", name, cfg)
+		}
+		configs[name] = values
+	}
+	return configs, nil
+}
+
+func toFloatMap(raw any) (map[string]float64, error) {
+	values := make(map[string]float64)
+	for k, v := range cast.ToStringMap(raw) {
+		f, err := cast.ToFloat64E(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", k, err)
+		}
+		values[k] = f
+	}
+	return values, nil
+}
@@ -0,0 +1,21 @@
+//go:build prometheus
+
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/prometheus"
+)
+
+func createPrometheusExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return prometheus.New(prometheus.Config{
+		Addr:         cast.ToString(cfg["addr"]),
+		Path:         cast.ToString(cfg["path"]),
+		Namespace:    cast.ToString(cfg["namespace"]),
+		StaleTimeout: cast.ToDuration(cfg["stale_timeout"]),
+		Columns:      columns,
+		Logger:       logger.With("name", name),
+	})
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/scanner"
+)
+
+func queueConfig() (scanner.QueueConfig, error) {
+	spillMaxSize, err := parseSize(viper.Get("queue.spill_max_size"))
+	if err != nil {
+		return scanner.QueueConfig{}, fmt.Errorf("invalid queue spill_max_size: %w", err)
+	}
+	return scanner.QueueConfig{
+		Size:          viper.GetInt("queue.size"),
+		Overflow:      scanner.OverflowPolicy(viper.GetString("queue.overflow")),
+		SpillDir:      viper.GetString("queue.spill_dir"),
+		SpillMaxSize:  spillMaxSize,
+		Timeout:       viper.GetDuration("queue.timeout"),
+		DrainTimeout:  viper.GetDuration("queue.drain_timeout"),
+		BatchSize:     viper.GetInt("queue.batch_size"),
+		BatchInterval: viper.GetDuration("queue.batch_interval"),
+	}, nil
+}
+
+// logQueueStats periodically logs the state of the export queues and the number of values
+// rejected by the processors until the context is done
+func logQueueStats(ctx context.Context, scn scanner.Scanner, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var rejections map[string]map[string]uint64
+	for {
+		select {
+		case <-ticker.C:
+			scan := scn.ScanStats()
+			for _, proc := range slices.Sorted(maps.Keys(scan.Rejections)) {
+				fields := scan.Rejections[proc]
+				// New rejections since the previous report are logged at info level
+				level := slog.LevelDebug
+				if !maps.Equal(fields, rejections[proc]) {
+					level = slog.LevelInfo
+				}
+				attrs := []slog.Attr{slog.String("processor", proc)}
+				for _, field := range slices.Sorted(maps.Keys(fields)) {
+					attrs = append(attrs, slog.Uint64(field, fields[field]))
+				}
+				logger.LogAttrs(ctx, level, "Rejected values", attrs...)
+			}
+			rejections = scan.Rejections
+			for _, stats := range scn.QueueStats() {
+				level := slog.LevelDebug
+				if stats.Depth == stats.Capacity || stats.Spilled > 0 {
+					level = slog.LevelWarn
+				}
+				logger.LogAttrs(ctx, level, "Export queue",
+					slog.String("exporter", stats.Exporter),
+					slog.Int("depth", stats.Depth),
+					slog.Int("capacity", stats.Capacity),
+					slog.Int64("spilled", stats.Spilled),
+					slog.Uint64("exported", stats.Exported),
+					slog.Uint64("failed", stats.Failed),
+					slog.Uint64("dropped", stats.Dropped),
+					slog.Duration("latency", stats.Latency),
+				)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
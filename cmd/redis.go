@@ -0,0 +1,23 @@
+//go:build redis
+
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/redis"
+)
+
+func createRedisExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return redis.New(redis.Config{
+		URL:       cast.ToString(cfg["url"]),
+		TLS:       tlsOptions(cfg),
+		Mode:      cast.ToString(cfg["mode"]),
+		KeyPrefix: cast.ToString(cfg["key_prefix"]),
+		MaxLen:    cast.ToInt64(cfg["max_len"]),
+		Retention: cast.ToDuration(cfg["retention"]),
+		Columns:   columns,
+		Logger:    logger.With("name", name),
+	})
+}
@@ -0,0 +1,27 @@
+//go:build prometheus
+
+package cmd
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/remotewrite"
+)
+
+func createRemoteWriteExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return remotewrite.New(remotewrite.Config{
+		URL:           cast.ToString(cfg["url"]),
+		Prefix:        cast.ToString(cfg["prefix"]),
+		Labels:        cast.ToStringMapString(cfg["labels"]),
+		Username:      cast.ToString(cfg["username"]),
+		Password:      cast.ToString(cfg["password"]),
+		Token:         cast.ToString(cfg["token"]),
+		FlushInterval: cast.ToDuration(cfg["flush_interval"]),
+		MaxSamples:    cast.ToInt(cfg["max_samples"]),
+		MaxPending:    cast.ToInt(cfg["max_pending"]),
+		Timeout:       cast.ToDuration(cfg["timeout"]),
+		Columns:       columns,
+		Logger:        logger.With("name", name),
+	})
+}
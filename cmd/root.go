@@ -6,11 +6,13 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
 )
 
 const (
@@ -26,6 +28,7 @@ var (
 	logger      *slog.Logger
 	peripherals map[string]string
 	exporters   []exporter.Exporter
+	processors  processor.Pipeline
 	device      string
 )
 
@@ -56,6 +59,7 @@ func init() {
 	viper.SetDefault(deviceConfigKey, "default")
 	viper.SetDefault(logLevelConfigKey, "info")
 	viper.SetDefault(logFormatConfigKey, "text")
+	viper.SetDefault("queue.stats_interval", time.Minute)
 }
 
 func initConfig() {
@@ -23,11 +23,20 @@ var scanCmd = &cobra.Command{
 		if err := createExporters(); err != nil {
 			return err
 		}
+		if err := createProcessors(); err != nil {
+			return err
+		}
 		cfg := scanner.DefaultConfig()
 		cfg.DeviceName = device
 		cfg.Peripherals = peripherals
 		cfg.Exporters = exporters
+		cfg.Processors = processors
 		cfg.Logger = logger
+		queueCfg, err := queueConfig()
+		if err != nil {
+			return err
+		}
+		cfg.Queue = queueCfg
 		scn, err := scanner.NewOnce(cfg)
 		if err != nil {
 			return err
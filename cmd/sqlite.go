@@ -0,0 +1,29 @@
+//go:build sqlite
+
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/sqlite"
+)
+
+func createSQLiteExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return sqlite.New(sqlite.Config{
+		Path:                cast.ToString(cfg["path"]),
+		Table:               cast.ToString(cfg["table"]),
+		Retention:           time.Duration(cast.ToInt(cfg["retention_days"])) * 24 * time.Hour,
+		RollupRetention:     time.Duration(cast.ToInt(cfg["rollup_retention_days"])) * 24 * time.Hour,
+		MaintenanceInterval: cast.ToDuration(cfg["maintenance_interval"]),
+		Columns:             columns,
+		Logger:              logger.With("name", name),
+	})
+}
+
+func readSQLite(ctx context.Context, q sqlite.Query, fn func(m exporter.Measurement) error) error {
+	return sqlite.Read(ctx, q, fn)
+}
@@ -0,0 +1,18 @@
+//go:build !sqlite
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/sqlite"
+)
+
+func createSQLiteExporter(name string, columns map[string]string, cfg map[string]any) (exporter.Exporter, error) {
+	return nil, ErrNotEnabled
+}
+
+func readSQLite(ctx context.Context, q sqlite.Query, fn func(m exporter.Measurement) error) error {
+	return ErrNotEnabled
+}
@@ -0,0 +1,170 @@
+package configfile
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+const ruuviTagsTable = "ruuvitags"
+
+// Template is the configuration written when no existing config file is found
+const Template = `interval = "0m"
+device = "default"
+
+[ruuvitags]
+`
+
+// RuuviTags returns the RuuviTag addresses and names defined in the given TOML config.
+// Addresses are returned in upper case.
+func RuuviTags(content []byte) (map[string]string, error) {
+	var cfg map[string]any
+	if err := toml.Unmarshal(content, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	tags := make(map[string]string)
+	raw, ok := cfg[ruuviTagsTable]
+	if !ok {
+		return tags, nil
+	}
+	table, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s config: %v", ruuviTagsTable, raw)
+	}
+	for addr, name := range table {
+		tags[strings.ToUpper(addr)] = fmt.Sprint(name)
+	}
+	return tags, nil
+}
+
+// NewRuuviTags returns the addresses from addrs that are not yet present in the given
+// existing RuuviTags, in sorted order.
+func NewRuuviTags(existing map[string]string, addrs []string) []string {
+	var newAddrs []string
+	for _, addr := range addrs {
+		addr = strings.ToUpper(addr)
+		if _, ok := existing[addr]; ok {
+			continue
+		}
+		if slices.Contains(newAddrs, addr) {
+			continue
+		}
+		newAddrs = append(newAddrs, addr)
+	}
+	slices.Sort(newAddrs)
+	return newAddrs
+}
+
+// AddRuuviTags adds the given RuuviTags to the [ruuvitags] table of the given TOML config.
+// The rest of the config, including comments and formatting, is left untouched. Tags whose
+// address is already present in the config are ignored.
+func AddRuuviTags(content []byte, tags map[string]string) ([]byte, error) {
+	existing, err := RuuviTags(content)
+	if err != nil {
+		return nil, err
+	}
+	addrs := NewRuuviTags(existing, slices.Collect(maps.Keys(tags)))
+	if len(addrs) == 0 {
+		return content, nil
+	}
+	added := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		added = append(added, fmt.Sprintf("%s = %s", quote(addr), quote(tags[addr])))
+	}
+	start, insertAt, err := findTable(content)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("%s must be defined as a table in order to add new entries", ruuviTagsTable)
+		}
+		// The table does not exist yet, so append it to the end of the config
+		text := strings.TrimRight(string(content), "\n")
+		if text != "" {
+			text += "\n\n"
+		}
+		text += "[" + ruuviTagsTable + "]\n" + strings.Join(added, "\n") + "\n"
+		return []byte(text), nil
+	}
+	lines := strings.Split(string(content), "\n")
+	lines = slices.Insert(lines, insertAt, added...)
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// findTable returns the line index of the header of the [ruuvitags] table and the index
+// of the line after its last entry, where new entries are inserted. Start is -1 if the
+// table is not found. RuuviTags defined with dotted keys or as an inline table cannot be
+// merged and are reported as an error.
+func findTable(content []byte) (start, insertAt int, err error) {
+	start = -1
+	line := func(offset uint32) int {
+		return bytes.Count(content[:offset], []byte("\n"))
+	}
+	var p unstable.Parser
+	p.Reset(content)
+	var table []string
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = keyOf(expr)
+			if expr.Kind == unstable.Table && slices.Equal(table, []string{ruuviTagsTable}) {
+				it := expr.Key()
+				it.Next()
+				start = line(it.Node().Raw.Offset)
+				insertAt = start + 1
+			}
+		case unstable.KeyValue:
+			switch {
+			case slices.Equal(table, []string{ruuviTagsTable}):
+				// The entry may span several lines
+				insertAt = line(expr.Raw.Offset+expr.Raw.Length-1) + 1
+			case len(table) == 0 && keyOf(expr)[0] == ruuviTagsTable:
+				return -1, 0, fmt.Errorf("%s must be defined as a [%s] table in order to add new entries", ruuviTagsTable, ruuviTagsTable)
+			}
+		}
+	}
+	if err := p.Error(); err != nil {
+		return -1, 0, fmt.Errorf("invalid config: %w", err)
+	}
+	return start, insertAt, nil
+}
+
+// keyOf returns the parts of the key of the table or key-value expression
+func keyOf(expr *unstable.Node) []string {
+	var key []string
+	it := expr.Key()
+	for it.Next() {
+		key = append(key, string(it.Node().Data))
+	}
+	return key
+}
+
+// quote quotes s as a TOML basic string
+func quote(s string) string {
+	b := new(strings.Builder)
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
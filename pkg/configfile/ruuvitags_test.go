@@ -0,0 +1,131 @@
+package configfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `interval = "0m"
+device = "default"
+
+# My tags
+[ruuvitags]
+"cc:ca:7e:52:cc:34" = "Backyard"
+"FB:E1:B7:04:95:EE" = "Upstairs"
+
+[exporters.influxdb]
+type = "influxdb"
+addr = "http://localhost:8086"
+`
+
+func TestRuuviTags(t *testing.T) {
+	tags, err := RuuviTags([]byte(testConfig))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"CC:CA:7E:52:CC:34": "Backyard",
+		"FB:E1:B7:04:95:EE": "Upstairs",
+	}, tags)
+}
+
+func TestAddRuuviTags(t *testing.T) {
+	updated, err := AddRuuviTags([]byte(testConfig), map[string]string{
+		"CC:CA:7E:52:CC:34": "RuuviTag 1",
+		"E8:E0:C6:0B:B8:C5": "Downstairs",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `interval = "0m"
+device = "default"
+
+# My tags
+[ruuvitags]
+"cc:ca:7e:52:cc:34" = "Backyard"
+"FB:E1:B7:04:95:EE" = "Upstairs"
+"E8:E0:C6:0B:B8:C5" = "Downstairs"
+
+[exporters.influxdb]
+type = "influxdb"
+addr = "http://localhost:8086"
+`, string(updated))
+}
+
+func TestAddRuuviTagsWithoutTable(t *testing.T) {
+	updated, err := AddRuuviTags([]byte("device = \"default\"\n"), map[string]string{
+		"E8:E0:C6:0B:B8:C5": "Living \"Room\"",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "device = \"default\"\n\n[ruuvitags]\n\"E8:E0:C6:0B:B8:C5\" = \"Living \\\"Room\\\"\"\n", string(updated))
+	tags, err := RuuviTags(updated)
+	require.NoError(t, err)
+	assert.Equal(t, "Living \"Room\"", tags["E8:E0:C6:0B:B8:C5"])
+}
+
+func TestAddRuuviTagsToTemplate(t *testing.T) {
+	updated, err := AddRuuviTags([]byte(Template), map[string]string{
+		"E8:E0:C6:0B:B8:C5": "RuuviTag 1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Template+"\"E8:E0:C6:0B:B8:C5\" = \"RuuviTag 1\"\n", string(updated))
+}
+
+func TestAddRuuviTagsMultiline(t *testing.T) {
+	config := `filters = [
+  ["temperature", "humidity"],
+]
+
+[ruuvitags]
+"CC:CA:7E:52:CC:34" = """
+[Backyard]"""
+[exporters.console]
+type = "console"
+`
+	updated, err := AddRuuviTags([]byte(config), map[string]string{
+		"E8:E0:C6:0B:B8:C5": "Downstairs",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `filters = [
+  ["temperature", "humidity"],
+]
+
+[ruuvitags]
+"CC:CA:7E:52:CC:34" = """
+[Backyard]"""
+"E8:E0:C6:0B:B8:C5" = "Downstairs"
+[exporters.console]
+type = "console"
+`, string(updated))
+}
+
+func TestAddRuuviTagsNotTable(t *testing.T) {
+	tags := map[string]string{"E8:E0:C6:0B:B8:C5": "Downstairs"}
+	_, err := AddRuuviTags([]byte("ruuvitags = {}\n"), tags)
+	assert.Error(t, err)
+	_, err = AddRuuviTags([]byte("ruuvitags.\"CC:CA:7E:52:CC:34\" = \"Backyard\"\n"), tags)
+	assert.Error(t, err)
+}
+
+func TestNewRuuviTags(t *testing.T) {
+	addrs := NewRuuviTags(map[string]string{
+		"CC:CA:7E:52:CC:34": "Backyard",
+	}, []string{"fb:e1:b7:04:95:ee", "cc:ca:7e:52:cc:34", "E8:E0:C6:0B:B8:C5"})
+	assert.Equal(t, []string{"E8:E0:C6:0B:B8:C5", "FB:E1:B7:04:95:EE"}, addrs)
+}
+
+func TestDiff(t *testing.T) {
+	assert.Empty(t, Diff("a", "b", testConfig, testConfig))
+	updated, err := AddRuuviTags([]byte(testConfig), map[string]string{
+		"E8:E0:C6:0B:B8:C5": "Downstairs",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `--- config.toml
++++ config.toml (new)
+@@ -5,6 +5,7 @@
+ [ruuvitags]
+ "cc:ca:7e:52:cc:34" = "Backyard"
+ "FB:E1:B7:04:95:EE" = "Upstairs"
++"E8:E0:C6:0B:B8:C5" = "Downstairs"
+`+" \n"+` [exporters.influxdb]
+ type = "influxdb"
+`, Diff("config.toml", "config.toml (new)", testConfig, string(updated)))
+}
@@ -0,0 +1,67 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Event types
+const (
+	Movement    = "movement"
+	Orientation = "orientation"
+	LowBattery  = "low_battery"
+)
+
+// Event is a discrete occurrence detected from RuuviTag measurements
+type Event struct {
+	Type       string         `json:"type"`
+	Addr       string         `json:"mac"`
+	Name       string         `json:"name"`
+	Timestamp  time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Handler receives detected events
+type Handler interface {
+	HandleEvent(ctx context.Context, e Event) error
+}
+
+// HandlerFunc adapts a function to a Handler
+type HandlerFunc func(ctx context.Context, e Event) error
+
+func (f HandlerFunc) HandleEvent(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// Multi returns a handler that passes events to all given handlers
+func Multi(handlers ...Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, e Event) error {
+		var errs []error
+		for _, h := range handlers {
+			if err := h.HandleEvent(ctx, e); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// NewLogHandler returns a handler that logs events
+func NewLogHandler(logger *slog.Logger) Handler {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return HandlerFunc(func(ctx context.Context, e Event) error {
+		logger.LogAttrs(ctx, slog.LevelInfo, "Event",
+			slog.String("type", e.Type),
+			slog.String("addr", e.Addr),
+			slog.String("name", e.Name),
+			slog.Time("time", e.Timestamp),
+			slog.Any("attributes", e.Attributes),
+		)
+		return nil
+	})
+}
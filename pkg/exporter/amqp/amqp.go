@@ -0,0 +1,240 @@
+//go:build amqp
+
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"text/template"
+	"time"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+type amqpExporter struct {
+	cfg        Config
+	amqpConfig amqp091.Config
+	routingKey *template.Template
+	mu         sync.Mutex
+	conn       *amqp091.Connection
+	ch         *amqp091.Channel
+	// returns receives the measurements that the broker could not route to any queue
+	returns <-chan amqp091.Return
+	logger  *slog.Logger
+}
+
+// New creates an exporter that publishes the measurements as JSON to an AMQP 0-9-1
+// exchange such as RabbitMQ and waits for the publisher confirms
+func New(cfg Config) (exporter.Exporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	routingKey, err := parseRoutingKey(cfg.RoutingKey)
+	if err != nil {
+		return nil, err
+	}
+	properties := amqp091.NewConnectionProperties()
+	properties.SetClientConnectionName("ruuvitag-gollector")
+	e := &amqpExporter{
+		cfg: cfg,
+		amqpConfig: amqp091.Config{
+			Properties: properties,
+		},
+		routingKey: routingKey,
+		logger:     cfg.Logger.With("exporter", "AMQP"),
+	}
+	if cfg.TLS.Enabled() {
+		e.amqpConfig.TLSClientConfig, err = tlsconfig.New(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.channel(); err != nil {
+		e.close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// channel returns the open channel, reconnecting and reopening the channel if the
+// broker has closed it. The caller must hold mu.
+func (e *amqpExporter) channel() (*amqp091.Channel, error) {
+	if e.ch != nil && !e.ch.IsClosed() {
+		return e.ch, nil
+	}
+	reopen := e.ch != nil
+	if e.conn == nil || e.conn.IsClosed() {
+		conn, err := amqp091.DialConfig(e.cfg.URL, e.amqpConfig)
+		if err != nil {
+			return nil, err
+		}
+		e.conn = conn
+	}
+	ch, err := e.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if e.cfg.ExchangeType != "" {
+		if err := ch.ExchangeDeclare(e.cfg.Exchange, e.cfg.ExchangeType, true, false, false, false, nil); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+	returns := ch.NotifyReturn(make(chan amqp091.Return, 1))
+	closes := ch.NotifyClose(make(chan *amqp091.Error, 1))
+	go func() {
+		if err, ok := <-closes; ok {
+			e.logger.LogAttrs(context.Background(), slog.LevelWarn, "AMQP channel closed", slog.Any("error", err))
+		}
+	}()
+	if reopen {
+		e.logger.LogAttrs(context.Background(), slog.LevelInfo, "Reopened AMQP channel")
+	}
+	e.ch = ch
+	e.returns = returns
+	return ch, nil
+}
+
+func (e *amqpExporter) Name() string {
+	if e.cfg.Exchange == "" {
+		return "AMQP"
+	}
+	return fmt.Sprintf("AMQP (%s)", e.cfg.Exchange)
+}
+
+func (e *amqpExporter) Export(ctx context.Context, data sensor.Data) error {
+	return e.ExportBatch(ctx, []exporter.Measurement{{Data: data, Extra: exporter.ExtraColumns(ctx)}})
+}
+
+// ExportBatch publishes the measurements as mandatory and waits until the broker has
+// confirmed all of them. The export fails if the broker returns any of the measurements
+// because they could not be routed to a queue.
+func (e *amqpExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ch, err := e.channel()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Confirms and returns of a failed batch could still arrive, so they are left
+		// behind with the channel
+		if err != nil {
+			ch.Close()
+		}
+	}()
+	confirms := make([]*amqp091.DeferredConfirmation, 0, len(batch))
+	for _, m := range batch {
+		key, msg, err := e.publishing(m.Context(ctx), m.Data)
+		if err != nil {
+			return err
+		}
+		confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, e.cfg.Exchange, key, true, false, msg)
+		if err != nil {
+			return err
+		}
+		confirms = append(confirms, confirm)
+	}
+	// The broker returns an unroutable message before confirming it, so the returns of
+	// the batch have been received once all of the measurements have been confirmed
+	var returned []amqp091.Return
+	returns := e.returns
+	for _, confirm := range confirms {
+		done := false
+		for !done {
+			select {
+			case r, ok := <-returns:
+				if !ok {
+					returns = nil
+					continue
+				}
+				returned = append(returned, r)
+			case <-confirm.Done():
+				done = true
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if !confirm.Acked() {
+			return fmt.Errorf("broker did not confirm the measurement")
+		}
+	}
+	for drained := false; !drained; {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				drained = true
+				continue
+			}
+			returned = append(returned, r)
+		default:
+			drained = true
+		}
+	}
+	if len(returned) > 0 {
+		return fmt.Errorf("%d measurements could not be routed: %s", len(returned), returned[0].ReplyText)
+	}
+	return nil
+}
+
+func (e *amqpExporter) publishing(ctx context.Context, data sensor.Data) (string, amqp091.Publishing, error) {
+	key, err := executeRoutingKey(e.routingKey, data)
+	if err != nil {
+		return "", amqp091.Publishing{}, exporter.Permanent(err)
+	}
+	body, err := json.Marshal(exporter.Transform(ctx, e.cfg.Columns, data))
+	if err != nil {
+		return "", amqp091.Publishing{}, exporter.Permanent(err)
+	}
+	deliveryMode := amqp091.Persistent
+	if e.cfg.Transient {
+		deliveryMode = amqp091.Transient
+	}
+	return key, amqp091.Publishing{
+		Headers: amqp091.Table{
+			"mac":  data.Addr,
+			"name": data.Name,
+		},
+		ContentType:  "application/json",
+		DeliveryMode: deliveryMode,
+		Timestamp:    data.Timestamp,
+		AppId:        "ruuvitag-gollector",
+		Body:         body,
+	}, nil
+}
+
+func (e *amqpExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.close()
+}
+
+func (e *amqpExporter) close() error {
+	if e.conn == nil || e.conn.IsClosed() {
+		return nil
+	}
+	return e.conn.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !amqp
+
+package amqp
+
+import (
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+func New(cfg Config) (exporter.Exporter, error) {
+	return exporter.NoOp{ReportedName: "AMQP"}, nil
+}
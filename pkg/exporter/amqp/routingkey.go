@@ -0,0 +1,44 @@
+package amqp
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+// DefaultRoutingKey is the default routing key template of the measurements
+const DefaultRoutingKey = "ruuvitag.{{.Name}}"
+
+// RoutingKeyData is the data of the routing key template
+type RoutingKeyData struct {
+	// Name is the name of the RuuviTag, or MAC if the RuuviTag has no name. Dots, spaces
+	// and the wildcards of topic exchanges are replaced with underscores.
+	Name string
+	// MAC is the MAC address of the RuuviTag without colons
+	MAC string
+}
+
+var wordReplacer = strings.NewReplacer(".", "_", "*", "_", "#", "_", " ", "_")
+
+func parseRoutingKey(key string) (*template.Template, error) {
+	if key == "" {
+		key = DefaultRoutingKey
+	}
+	return template.New("routing_key").Option("missingkey=error").Parse(key)
+}
+
+// executeRoutingKey returns the routing key of the measurements of the RuuviTag
+func executeRoutingKey(tmpl *template.Template, data sensor.Data) (string, error) {
+	mac := strings.ReplaceAll(data.Addr, ":", "")
+	name := wordReplacer.Replace(data.Name)
+	if name == "" {
+		name = mac
+	}
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, RoutingKeyData{
+		Name: name,
+		MAC:  mac,
+	})
+	return sb.String(), err
+}
@@ -0,0 +1,52 @@
+package amqp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+var testData = sensor.Data{
+	Addr:        "CC:CA:7E:52:CC:34",
+	Name:        "Living room",
+	Temperature: 21.5,
+	Timestamp:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestRoutingKey(t *testing.T) {
+	tmpl, err := parseRoutingKey("")
+	require.NoError(t, err)
+	key, err := executeRoutingKey(tmpl, testData)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.Living_room", key)
+
+	data := testData
+	data.Name = "attic.north#*"
+	key, err = executeRoutingKey(tmpl, data)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.attic_north__", key)
+
+	data.Name = ""
+	key, err = executeRoutingKey(tmpl, data)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.CCCA7E52CC34", key)
+
+	tmpl, err = parseRoutingKey("{{.MAC}}")
+	require.NoError(t, err)
+	key, err = executeRoutingKey(tmpl, testData)
+	require.NoError(t, err)
+	assert.Equal(t, "CCCA7E52CC34", key)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(Config{URL: "amqp://localhost"}))
+	assert.NoError(t, Validate(Config{URL: "amqp://localhost", Exchange: "ruuvitag", ExchangeType: "topic"}))
+	assert.Error(t, Validate(Config{}))
+	assert.Error(t, Validate(Config{URL: "amqp://localhost", RoutingKey: "{{.Name"}))
+	assert.Error(t, Validate(Config{URL: "amqp://localhost", Exchange: "ruuvitag", ExchangeType: "x-delayed"}))
+	assert.Error(t, Validate(Config{URL: "amqp://localhost", ExchangeType: "topic"}))
+}
@@ -6,4 +6,7 @@ type Config struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	SessionToken    string
+	// Columns maps the additional columns computed by processors to the names they are
+	// added to the items with. Measurement fields are always stored.
+	Columns map[string]string
 }
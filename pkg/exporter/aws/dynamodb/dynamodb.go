@@ -4,6 +4,9 @@ package dynamodb
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -17,10 +20,17 @@ import (
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 )
 
+const (
+	// maxBatchSize is the maximum number of items in a BatchWriteItem request
+	maxBatchSize     = 25
+	maxBatchAttempts = 3
+)
+
 type dynamoDBExporter struct {
-	sess  *session.Session
-	db    dynamodbiface.DynamoDBAPI
-	table string
+	sess    *session.Session
+	db      dynamodbiface.DynamoDBAPI
+	table   string
+	columns map[string]string
 }
 
 func New(cfg Config) (exporter.Exporter, error) {
@@ -33,9 +43,10 @@ func New(cfg Config) (exporter.Exporter, error) {
 	}
 	db := dynamodb.New(sess)
 	return &dynamoDBExporter{
-		sess:  sess,
-		db:    db,
-		table: cfg.Table,
+		sess:    sess,
+		db:      db,
+		table:   cfg.Table,
+		columns: cfg.Columns,
 	}, nil
 }
 
@@ -44,9 +55,9 @@ func (e *dynamoDBExporter) Name() string {
 }
 
 func (e *dynamoDBExporter) Export(ctx context.Context, data sensor.Data) error {
-	item, err := dynamodbattribute.MarshalMap(data)
+	item, err := e.item(ctx, data)
 	if err != nil {
-		return err
+		return exporter.Permanent(err)
 	}
 	input := &dynamodb.PutItemInput{
 		Item:      item,
@@ -59,6 +70,69 @@ func (e *dynamoDBExporter) Export(ctx context.Context, data sensor.Data) error {
 	return nil
 }
 
+// ExportBatch writes the measurements with BatchWriteItem in chunks of up to 25 items.
+// Unprocessed items are retried a few times before giving up.
+func (e *dynamoDBExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	for chunk := range slices.Chunk(batch, maxBatchSize) {
+		var requests []*dynamodb.WriteRequest
+		for _, m := range chunk {
+			item, err := e.item(m.Context(ctx), m.Data)
+			if err != nil {
+				return exporter.Permanent(err)
+			}
+			requests = append(requests, &dynamodb.WriteRequest{
+				PutRequest: &dynamodb.PutRequest{Item: item},
+			})
+		}
+		if err := e.batchWrite(ctx, requests); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *dynamoDBExporter) batchWrite(ctx context.Context, requests []*dynamodb.WriteRequest) error {
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		resp, err := e.db.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{
+				e.table: requests,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		requests = resp.UnprocessedItems[e.table]
+		if len(requests) == 0 {
+			return nil
+		}
+		if attempt == maxBatchAttempts {
+			return fmt.Errorf("%d items were not processed", len(requests))
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// item returns the measurement as a DynamoDB item with the additional columns carried by
+// the context
+func (e *dynamoDBExporter) item(ctx context.Context, data sensor.Data) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(data)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range exporter.ExtraFields(ctx, e.columns) {
+		if item[name], err = dynamodbattribute.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return item, nil
+}
+
 func (e *dynamoDBExporter) Close() error {
 	return nil
 }
@@ -14,11 +14,15 @@ import (
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 )
 
 type mockDynamoDBClient struct {
 	dynamodbiface.DynamoDBAPI
-	t *testing.T
+	t           *testing.T
+	written     []*dynamodb.WriteRequest
+	unprocessed int
 }
 
 func (m *mockDynamoDBClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
@@ -30,6 +34,20 @@ func (m *mockDynamoDBClient) PutItemWithContext(ctx aws.Context, input *dynamodb
 	return &dynamodb.PutItemOutput{}, nil
 }
 
+func (m *mockDynamoDBClient) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	requests := input.RequestItems["test_table"]
+	assert.LessOrEqual(m.t, len(requests), 25)
+	// Leave some items unprocessed on the first request
+	n := len(requests) - m.unprocessed
+	m.unprocessed = 0
+	m.written = append(m.written, requests[:n]...)
+	out := &dynamodb.BatchWriteItemOutput{}
+	if n < len(requests) {
+		out.UnprocessedItems = map[string][]*dynamodb.WriteRequest{"test_table": requests[n:]}
+	}
+	return out, nil
+}
+
 func TestExport(t *testing.T) {
 	exp := &dynamoDBExporter{
 		db:    &mockDynamoDBClient{t: t},
@@ -52,3 +70,30 @@ func TestExport(t *testing.T) {
 	err := exp.Export(ctx, data)
 	require.NoError(t, err)
 }
+
+func TestExportBatch(t *testing.T) {
+	client := &mockDynamoDBClient{t: t, unprocessed: 2}
+	exp := &dynamoDBExporter{
+		db:      client,
+		table:   "test_table",
+		columns: map[string]string{"battery_low": "battery_low"},
+	}
+	var batch []exporter.Measurement
+	for i := range 30 {
+		batch = append(batch, exporter.Measurement{Data: sensor.Data{
+			Addr:              "CC:CA:7E:52:CC:34",
+			Name:              "Backyard",
+			MeasurementNumber: i,
+		}})
+	}
+	batch[0].SetExtra("battery_low", true)
+	batch[0].SetExtra("outlier", true)
+	err := exp.ExportBatch(context.Background(), batch)
+	require.NoError(t, err)
+	require.Len(t, client.written, 30)
+	item := client.written[0].PutRequest.Item
+	assert.Equal(t, "Backyard", *item["name"].S)
+	assert.True(t, *item["battery_low"].BOOL)
+	// Columns that are not mapped are not stored
+	assert.NotContains(t, item, "outlier")
+}
@@ -7,4 +7,7 @@ type Config struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	SessionToken    string
+	// Columns maps the additional columns computed by processors to the names they are
+	// added to the messages with. Measurement fields are always sent.
+	Columns map[string]string
 }
@@ -5,6 +5,13 @@ package sqs
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -17,10 +24,32 @@ import (
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 )
 
+const (
+	// maxBatchSize is the maximum number of messages in a SendMessageBatch request
+	maxBatchSize     = 10
+	maxBatchAttempts = 3
+)
+
 type sqsExporter struct {
 	sess     *session.Session
 	sqs      sqsiface.SQSAPI
 	queueUrl string
+	columns  map[string]string
+	mu       sync.Mutex
+	// delivered are the measurements of a failed batch that were sent before the failure.
+	// They are skipped when the batch is exported again.
+	delivered map[key]bool
+}
+
+// key identifies a measurement in a batch
+type key struct {
+	addr      string
+	number    int
+	timestamp int64
+}
+
+func keyOf(data sensor.Data) key {
+	return key{addr: data.Addr, number: data.MeasurementNumber, timestamp: data.Timestamp.UnixNano()}
 }
 
 func New(cfg Config) (exporter.Exporter, error) {
@@ -48,6 +77,7 @@ func New(cfg Config) (exporter.Exporter, error) {
 		sess:     sess,
 		sqs:      sqs,
 		queueUrl: queueUrl,
+		columns:  cfg.Columns,
 	}, nil
 }
 
@@ -56,23 +86,14 @@ func (e *sqsExporter) Name() string {
 }
 
 func (e *sqsExporter) Export(ctx context.Context, data sensor.Data) error {
-	body, err := json.Marshal(data)
+	body, err := e.messageBody(ctx, data)
 	if err != nil {
-		return err
+		return exporter.Permanent(err)
 	}
 	input := &awssqs.SendMessageInput{
-		MessageAttributes: map[string]*awssqs.MessageAttributeValue{
-			"mac": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String(data.Addr),
-			},
-			"name": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String(data.Name),
-			},
-		},
-		MessageBody: aws.String(string(body)),
-		QueueUrl:    aws.String(e.queueUrl),
+		MessageAttributes: messageAttributes(data),
+		MessageBody:       aws.String(string(body)),
+		QueueUrl:          aws.String(e.queueUrl),
 	}
 	_, err = e.sqs.SendMessageWithContext(ctx, input)
 	if err != nil {
@@ -81,6 +102,136 @@ func (e *sqsExporter) Export(ctx context.Context, data sensor.Data) error {
 	return nil
 }
 
+// ExportBatch sends the measurements with SendMessageBatch in chunks of up to 10 messages.
+// Messages that fail are sent again on their own, and the messages delivered before a
+// failed export are skipped when the same batch is exported again, so that the delivered
+// ones are not duplicated.
+func (e *sqsExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delivered := make(map[key]bool)
+	var pending []exporter.Measurement
+	for _, m := range batch {
+		if k := keyOf(m.Data); e.delivered[k] {
+			delivered[k] = true
+			continue
+		}
+		pending = append(pending, m)
+	}
+	e.delivered = delivered
+	var rejected []error
+	for chunk := range slices.Chunk(pending, maxBatchSize) {
+		var entries []*awssqs.SendMessageBatchRequestEntry
+		keys := make(map[string]key, len(chunk))
+		for i, m := range chunk {
+			body, err := e.messageBody(m.Context(ctx), m.Data)
+			if err != nil {
+				e.delivered = nil
+				return exporter.Permanent(err)
+			}
+			id := strconv.Itoa(i)
+			keys[id] = keyOf(m.Data)
+			entries = append(entries, &awssqs.SendMessageBatchRequestEntry{
+				Id:                aws.String(id),
+				MessageAttributes: messageAttributes(m.Data),
+				MessageBody:       aws.String(string(body)),
+			})
+		}
+		errs, err := e.sendBatch(ctx, entries, keys)
+		if err != nil {
+			return err
+		}
+		rejected = append(rejected, errs...)
+	}
+	e.delivered = nil
+	if len(rejected) > 0 {
+		return exporter.Permanent(fmt.Errorf("%d messages were rejected: %w", len(rejected), errors.Join(rejected...)))
+	}
+	return nil
+}
+
+// sendBatch sends the entries and retries the ones that fail because of SQS. The keys of
+// the entries that are sent are added to the delivered measurements. It returns the
+// errors of the entries that SQS rejected because of the sender.
+func (e *sqsExporter) sendBatch(ctx context.Context, entries []*awssqs.SendMessageBatchRequestEntry, keys map[string]key) ([]error, error) {
+	var rejected []error
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		resp, err := e.sqs.SendMessageBatchWithContext(ctx, &awssqs.SendMessageBatchInput{
+			QueueUrl: aws.String(e.queueUrl),
+			Entries:  entries,
+		})
+		if err != nil {
+			return rejected, err
+		}
+		for _, s := range resp.Successful {
+			e.delivered[keys[aws.StringValue(s.Id)]] = true
+		}
+		byID := make(map[string]*awssqs.SendMessageBatchRequestEntry, len(entries))
+		for _, entry := range entries {
+			byID[aws.StringValue(entry.Id)] = entry
+		}
+		var failed []*awssqs.SendMessageBatchRequestEntry
+		var last error
+		for _, f := range resp.Failed {
+			err := fmt.Errorf("%s: %s", aws.StringValue(f.Code), aws.StringValue(f.Message))
+			if aws.BoolValue(f.SenderFault) {
+				rejected = append(rejected, err)
+				continue
+			}
+			if entry, ok := byID[aws.StringValue(f.Id)]; ok {
+				failed = append(failed, entry)
+				last = err
+			}
+		}
+		if len(failed) == 0 {
+			return rejected, nil
+		}
+		if attempt == maxBatchAttempts {
+			return rejected, fmt.Errorf("%d messages were not sent: %w", len(failed), last)
+		}
+		entries = failed
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return rejected, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
 func (e *sqsExporter) Close() error {
 	return nil
 }
+
+// messageBody returns the measurement as JSON with the additional columns carried by
+// the context
+func (e *sqsExporter) messageBody(ctx context.Context, data sensor.Data) ([]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	extra := exporter.ExtraFields(ctx, e.columns)
+	if len(extra) == 0 {
+		return body, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	maps.Copy(fields, extra)
+	return json.Marshal(fields)
+}
+
+func messageAttributes(data sensor.Data) map[string]*awssqs.MessageAttributeValue {
+	return map[string]*awssqs.MessageAttributeValue{
+		"mac": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(data.Addr),
+		},
+		"name": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(data.Name),
+		},
+	}
+}
@@ -4,6 +4,8 @@ package sqs
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -14,11 +16,19 @@ import (
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 )
 
 type mockSQSClient struct {
 	sqsiface.SQSAPI
-	t *testing.T
+	t       *testing.T
+	batches []*sqs.SendMessageBatchInput
+	// failures are the IDs of the entries that fail in each request, mapped to whether the
+	// failure is the sender's fault
+	failures []map[string]bool
+	// errs are the errors returned by each request
+	errs []error
 }
 
 func (m *mockSQSClient) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
@@ -28,6 +38,37 @@ func (m *mockSQSClient) SendMessageWithContext(ctx aws.Context, input *sqs.SendM
 	return &sqs.SendMessageOutput{}, nil
 }
 
+func (m *mockSQSClient) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	m.batches = append(m.batches, input)
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	out := &sqs.SendMessageBatchOutput{}
+	var failures map[string]bool
+	if len(m.failures) > 0 {
+		failures = m.failures[0]
+		m.failures = m.failures[1:]
+	}
+	for _, entry := range input.Entries {
+		senderFault, ok := failures[*entry.Id]
+		if !ok {
+			out.Successful = append(out.Successful, &sqs.SendMessageBatchResultEntry{Id: entry.Id})
+			continue
+		}
+		out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{
+			Id:          entry.Id,
+			Code:        aws.String("InternalError"),
+			Message:     aws.String("failed"),
+			SenderFault: aws.Bool(senderFault),
+		})
+	}
+	return out, nil
+}
+
 func TestExport(t *testing.T) {
 	exp := &sqsExporter{
 		sqs:      &mockSQSClient{t: t},
@@ -50,3 +91,111 @@ func TestExport(t *testing.T) {
 	err := exp.Export(ctx, data)
 	require.NoError(t, err)
 }
+
+func TestExportBatch(t *testing.T) {
+	client := &mockSQSClient{t: t}
+	exp := &sqsExporter{
+		sqs:      client,
+		queueUrl: "http://localhost/test_queue",
+		columns:  map[string]string{"battery_low": "battery_low"},
+	}
+	var batch []exporter.Measurement
+	for i := range 12 {
+		batch = append(batch, exporter.Measurement{Data: sensor.Data{
+			Addr:              "CC:CA:7E:52:CC:34",
+			Name:              "Backyard",
+			MeasurementNumber: i,
+		}})
+	}
+	batch[11].SetExtra("battery_low", true)
+	err := exp.ExportBatch(context.Background(), batch)
+	require.NoError(t, err)
+	require.Len(t, client.batches, 2)
+	assert.Len(t, client.batches[0].Entries, 10)
+	assert.Len(t, client.batches[1].Entries, 2)
+	entry := client.batches[1].Entries[1]
+	assert.Equal(t, "1", *entry.Id)
+	assert.Equal(t, "Backyard", *entry.MessageAttributes["name"].StringValue)
+	assert.Contains(t, *entry.MessageBody, `"measurement_number":11`)
+	assert.Contains(t, *entry.MessageBody, `"battery_low":true`)
+}
+
+func TestExportBatchPartialFailure(t *testing.T) {
+	client := &mockSQSClient{
+		t: t,
+		failures: []map[string]bool{
+			{"1": false, "3": true},
+			{"1": false},
+		},
+	}
+	exp := &sqsExporter{
+		sqs:      client,
+		queueUrl: "http://localhost/test_queue",
+	}
+	var batch []exporter.Measurement
+	for i := range 5 {
+		batch = append(batch, exporter.Measurement{Data: sensor.Data{
+			Addr:              "CC:CA:7E:52:CC:34",
+			Name:              "Backyard",
+			MeasurementNumber: i,
+		}})
+	}
+	err := exp.ExportBatch(context.Background(), batch)
+	// The message rejected because of the sender is not retried
+	require.Error(t, err)
+	assert.True(t, exporter.IsPermanent(err))
+	// Only the message that failed because of SQS is sent again
+	require.Len(t, client.batches, 3)
+	assert.Len(t, client.batches[0].Entries, 5)
+	for _, input := range client.batches[1:] {
+		require.Len(t, input.Entries, 1)
+		assert.Equal(t, "1", *input.Entries[0].Id)
+		assert.Contains(t, *input.Entries[0].MessageBody, `"measurement_number":1`)
+	}
+
+	// Messages that keep failing fail the export so that it can be retried
+	client = &mockSQSClient{
+		t:        t,
+		failures: []map[string]bool{{"2": false}, {"2": false}, {"2": false}},
+	}
+	exp.sqs = client
+	err = exp.ExportBatch(context.Background(), batch)
+	require.Error(t, err)
+	assert.False(t, exporter.IsPermanent(err))
+	assert.Len(t, client.batches, maxBatchAttempts)
+}
+
+func TestExportBatchRetry(t *testing.T) {
+	client := &mockSQSClient{
+		t:        t,
+		errs:     []error{nil, errors.New("unavailable")},
+		failures: []map[string]bool{{"2": false}},
+	}
+	exp := &sqsExporter{
+		sqs:      client,
+		queueUrl: "http://localhost/test_queue",
+	}
+	var batch []exporter.Measurement
+	for i := range 12 {
+		batch = append(batch, exporter.Measurement{Data: sensor.Data{
+			Addr:              "CC:CA:7E:52:CC:34",
+			MeasurementNumber: i,
+		}})
+	}
+	// The first chunk is sent apart from one message, and sending that message again fails
+	// before the second chunk is sent
+	err := exp.ExportBatch(context.Background(), batch)
+	require.Error(t, err)
+	assert.False(t, exporter.IsPermanent(err))
+	require.Len(t, client.batches, 2)
+
+	// Exporting the batch again sends only the messages that were not delivered
+	client.batches = nil
+	require.NoError(t, exp.ExportBatch(context.Background(), batch))
+	require.Len(t, client.batches, 1)
+	require.Len(t, client.batches[0].Entries, 3)
+	for i, number := range []int{2, 10, 11} {
+		assert.Contains(t, *client.batches[0].Entries[i].MessageBody, fmt.Sprintf(`"measurement_number":%d`, number))
+	}
+	assert.Empty(t, exp.delivered)
+}
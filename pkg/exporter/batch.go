@@ -0,0 +1,82 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+// Measurement is a sensor reading together with any additional column values computed
+// for it
+type Measurement struct {
+	sensor.Data
+	Extra map[string]any `json:"extra,omitempty"`
+}
+
+// SetExtra sets the value of an additional column for the measurement
+func (m *Measurement) SetExtra(column string, value any) {
+	if m.Extra == nil {
+		m.Extra = make(map[string]any)
+	}
+	m.Extra[column] = value
+}
+
+// Context returns a context carrying the additional column values of the measurement
+func (m Measurement) Context(ctx context.Context) context.Context {
+	return WithExtraColumns(ctx, m.Extra)
+}
+
+// BatchExporter is implemented by exporters that can send several measurements at once
+// more efficiently than one at a time
+type BatchExporter interface {
+	ExportBatch(ctx context.Context, batch []Measurement) error
+}
+
+// Wrapper is implemented by exporters that add functionality to another exporter
+type Wrapper interface {
+	Unwrap() Exporter
+}
+
+// As finds the first exporter in the chain of wrapped exporters that implements T
+func As[T any](exp Exporter) (T, bool) {
+	for {
+		if t, ok := exp.(T); ok {
+			return t, true
+		}
+		w, ok := exp.(Wrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		exp = w.Unwrap()
+	}
+}
+
+// SupportsBatch returns true if the exporter, or the exporter wrapped by it, implements
+// BatchExporter natively
+func SupportsBatch(exp Exporter) bool {
+	for {
+		w, ok := exp.(Wrapper)
+		if !ok {
+			_, ok := exp.(BatchExporter)
+			return ok
+		}
+		exp = w.Unwrap()
+	}
+}
+
+// ExportBatch sends the measurements with the exporter's ExportBatch method if it has one
+// and otherwise one at a time with Export
+func ExportBatch(ctx context.Context, exp Exporter, batch []Measurement) error {
+	if be, ok := exp.(BatchExporter); ok {
+		return be.ExportBatch(ctx, batch)
+	}
+	var errs []error
+	for _, m := range batch {
+		if err := exp.Export(m.Context(ctx), m.Data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
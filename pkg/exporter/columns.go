@@ -0,0 +1,162 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/columnmap"
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+type extraColumnsKey struct{}
+
+// WithExtraColumns returns a context carrying additional column values computed for the
+// measurement being exported
+func WithExtraColumns(ctx context.Context, extra map[string]any) context.Context {
+	if len(extra) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, extraColumnsKey{}, extra)
+}
+
+// ExtraColumns returns the additional column values carried by the context
+func ExtraColumns(ctx context.Context) map[string]any {
+	extra, _ := ctx.Value(extraColumnsKey{}).(map[string]any)
+	return extra
+}
+
+// Transform maps sensor data fields to column names like columnmap.Transform and adds any
+// additional column values carried by the context that are present in the column map
+func Transform(ctx context.Context, columns map[string]string, data sensor.Data) map[string]any {
+	fields := columnmap.Transform(columns, data)
+	maps.Copy(fields, ExtraFields(ctx, columns))
+	return fields
+}
+
+// ExtraFields returns the additional column values carried by the context that are
+// present in the column map, keyed by their column names
+func ExtraFields(ctx context.Context, columns map[string]string) map[string]any {
+	fields := make(map[string]any)
+	for column, value := range ExtraColumns(ctx) {
+		if name, ok := columns[column]; ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// IntegerColumns are the columns of sensor.Data with integer values
+var IntegerColumns = []string{"acceleration_x", "acceleration_y", "acceleration_z", "movement_counter", "measurement_number", "tx_power"}
+
+var booleanColumns = make(map[string]bool)
+
+// RegisterBooleanColumn registers an additional column with boolean values so that
+// exporters with typed schemas store it as a boolean. It is meant to be called from the
+// init function of the package that computes the column.
+func RegisterBooleanColumn(column string) {
+	booleanColumns[column] = true
+}
+
+// IsBooleanColumn returns true if the column has been registered with RegisterBooleanColumn
+func IsBooleanColumn(column string) bool {
+	return booleanColumns[column]
+}
+
+// ColumnOrder returns the keys of the column map in the order of sensor.DefaultColumns,
+// followed by the other keys in alphabetical order
+func ColumnOrder(columns map[string]string) []string {
+	var keys []string
+	for _, key := range sensor.DefaultColumns {
+		if _, ok := columns[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	var other []string
+	for key := range columns {
+		if !slices.Contains(sensor.DefaultColumns, key) {
+			other = append(other, key)
+		}
+	}
+	sort.Strings(other)
+	return append(keys, other...)
+}
+
+// NumericFields returns the numeric column values of the measurement, excluding the time,
+// MAC address and name columns. Booleans are converted to 0 or 1.
+func NumericFields(ctx context.Context, columns map[string]string, data sensor.Data) map[string]float64 {
+	fields := make(map[string]float64)
+	for column, value := range Transform(ctx, columns, data) {
+		switch column {
+		case columns["time"], columns["mac"], columns["name"]:
+			continue
+		}
+		if v, ok := toFloat(value); ok {
+			fields[column] = v
+		}
+	}
+	return fields
+}
+
+// FormatValue formats a column value as a string for exporters that write plain text
+// values. Missing values are formatted as an empty string.
+func FormatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toFloat(value any) (float64, bool) {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	return ToFloat64(value)
+}
+
+// ToFloat64 converts an integer or floating point column value to float64
+func ToFloat64(value any) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.CanInt():
+		return float64(rv.Int()), true
+	case rv.CanUint():
+		return float64(rv.Uint()), true
+	case rv.CanFloat():
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// ToInt64 converts an integer or floating point column value to int64. Floating point
+// values are truncated.
+func ToInt64(value any) (int64, bool) {
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.CanInt():
+		return rv.Int(), true
+	case rv.CanUint():
+		return int64(rv.Uint()), true //nolint:gosec
+	case rv.CanFloat():
+		return int64(rv.Float()), true
+	}
+	return 0, false
+}
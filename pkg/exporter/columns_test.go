@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+func TestColumnOrder(t *testing.T) {
+	columns := map[string]string{
+		"tilt_x":      "tilt_x",
+		"temperature": "temp",
+		"mac":         "mac",
+		"time":        "ts",
+		"battery_low": "battery_low",
+	}
+	assert.Equal(t, []string{"time", "mac", "temperature", "battery_low", "tilt_x"}, ColumnOrder(columns))
+}
+
+func TestNumericFields(t *testing.T) {
+	columns := map[string]string{
+		"time":        "ts",
+		"mac":         "mac",
+		"name":        "name",
+		"temperature": "temp",
+		"tx_power":    "tx_power",
+		"battery_low": "battery_low",
+	}
+	ctx := WithExtraColumns(context.Background(), map[string]any{"battery_low": true})
+	fields := NumericFields(ctx, columns, sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.5, TxPower: 4})
+	assert.Equal(t, map[string]float64{"temp": 21.5, "tx_power": 4, "battery_low": 1}, fields)
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "21.5", FormatValue(21.5))
+	assert.Equal(t, "42", FormatValue(42))
+	assert.Equal(t, "true", FormatValue(true))
+	assert.Equal(t, "Backyard", FormatValue("Backyard"))
+	assert.Equal(t, "2024-05-01T12:00:00Z", FormatValue(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "", FormatValue(nil))
+}
+
+func TestNumericConversion(t *testing.T) {
+	i, ok := ToInt64(uint8(42))
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), i)
+	i, ok = ToInt64(21.5)
+	assert.True(t, ok)
+	assert.Equal(t, int64(21), i)
+	f, ok := ToFloat64(int16(-40))
+	assert.True(t, ok)
+	assert.Equal(t, -40.0, f)
+	_, ok = ToFloat64(true)
+	assert.False(t, ok)
+	_, ok = ToInt64(nil)
+	assert.False(t, ok)
+}
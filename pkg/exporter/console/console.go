@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 )
 
@@ -30,6 +31,15 @@ func (e *consoleExporter) Export(ctx context.Context, data sensor.Data) error {
 	return nil
 }
 
+func (e *consoleExporter) ExportEvent(ctx context.Context, ev event.Event) error {
+	j, err := json.MarshalIndent(ev, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(j))
+	return nil
+}
+
 func (e *consoleExporter) Close() error {
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
 )
 
 type Exporter interface {
@@ -11,3 +12,8 @@ type Exporter interface {
 	Export(ctx context.Context, data sensor.Data) error
 	Close() error
 }
+
+// EventExporter is implemented by exporters that can also send events detected from measurements
+type EventExporter interface {
+	ExportEvent(ctx context.Context, e event.Event) error
+}
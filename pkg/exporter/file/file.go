@@ -0,0 +1,453 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// DefaultTemplate writes all measurements to a single file
+const DefaultTemplate = "ruuvitag"
+
+var invalidFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+type Config struct {
+	// Dir is the directory of the files, which is created if it doesn't exist
+	Dir string
+	// Format is either csv (default) or jsonl
+	Format string
+	// Template is the file name without the extension. {mac}, {name} and {date} are
+	// replaced with the MAC address and name of the RuuviTag and the date of the
+	// measurement. Defaults to DefaultTemplate.
+	Template string
+	// MaxSize is the size in bytes after which the file is rotated. Zero disables size
+	// based rotation.
+	MaxSize int64
+	// RotateInterval is the age after which the file is rotated. Zero disables time based
+	// rotation.
+	RotateInterval time.Duration
+	// Compress compresses rotated files with gzip
+	Compress bool
+	Columns  map[string]string
+	Logger   *slog.Logger
+}
+
+// activeFile is a file being written to
+type activeFile struct {
+	f *os.File
+	// key is the path of the file from the template and path the path of the file
+	// itself, which differ when late measurements are written to a part file
+	key     string
+	path    string
+	date    string
+	size    int64
+	created time.Time
+}
+
+type fileExporter struct {
+	cfg    Config
+	keys   []string
+	header []byte
+	ext    string
+	logger *slog.Logger
+	now    func() time.Time
+	mu     sync.Mutex
+	files  map[string]*activeFile
+	// pending are the files being compressed and the compressed files being written
+	pending map[string]bool
+	wg      sync.WaitGroup
+}
+
+// New creates an exporter that writes measurements to CSV or JSON Lines files
+func New(cfg Config) (exporter.Exporter, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("directory must be specified")
+	}
+	if len(cfg.Columns) == 0 {
+		return nil, fmt.Errorf("columns must be non-empty")
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatCSV
+	}
+	if cfg.Format != FormatCSV && cfg.Format != FormatJSONL {
+		return nil, fmt.Errorf("invalid file format %s, must be %s or %s", cfg.Format, FormatCSV, FormatJSONL)
+	}
+	if cfg.Template == "" {
+		cfg.Template = DefaultTemplate
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	e := &fileExporter{
+		cfg:     cfg,
+		keys:    exporter.ColumnOrder(cfg.Columns),
+		ext:     "." + cfg.Format,
+		logger:  cfg.Logger.With("exporter", "File"),
+		now:     time.Now,
+		files:   make(map[string]*activeFile),
+		pending: make(map[string]bool),
+	}
+	if cfg.Format == FormatCSV {
+		var names []string
+		for _, key := range e.keys {
+			names = append(names, cfg.Columns[key])
+		}
+		header, err := csvLine(names)
+		if err != nil {
+			return nil, err
+		}
+		e.header = header
+	}
+	return e, nil
+}
+
+func (e *fileExporter) Name() string {
+	return fmt.Sprintf("File (%s)", e.cfg.Dir)
+}
+
+func (e *fileExporter) Export(ctx context.Context, data sensor.Data) error {
+	record, err := e.record(ctx, data)
+	if err != nil {
+		return exporter.Permanent(err)
+	}
+	ts := data.Timestamp
+	if ts.IsZero() {
+		ts = e.now()
+	}
+	date := ts.Format(time.DateOnly)
+	path := filepath.Join(e.cfg.Dir, e.filename(data, date))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.closePreviousDates(date); err != nil {
+		e.logger.LogAttrs(ctx, slog.LevelError, "Failed to close file of previous date", slog.Any("error", err))
+	}
+	af, err := e.file(path, date)
+	if err != nil {
+		return err
+	}
+	if e.needsRotation(af, len(record)) {
+		if err := e.rotate(af); err != nil {
+			return err
+		}
+		if af, err = e.file(path, date); err != nil {
+			return err
+		}
+	}
+	n, err := af.f.Write(record)
+	af.size += int64(n)
+	return err
+}
+
+// record formats the measurement as a CSV or JSON line
+func (e *fileExporter) record(ctx context.Context, data sensor.Data) ([]byte, error) {
+	fields := exporter.Transform(ctx, e.cfg.Columns, data)
+	if e.cfg.Format == FormatJSONL {
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	values := make([]string, len(e.keys))
+	for i, key := range e.keys {
+		values[i] = exporter.FormatValue(fields[e.cfg.Columns[key]])
+	}
+	return csvLine(values)
+}
+
+func csvLine(values []string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	if err := w.Write(values); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// filename returns the name of the file of the measurement from the template
+func (e *fileExporter) filename(data sensor.Data, date string) string {
+	mac := strings.ReplaceAll(strings.ToUpper(data.Addr), ":", "")
+	name := data.Name
+	if name == "" {
+		name = mac
+	}
+	base := strings.NewReplacer(
+		"{mac}", mac,
+		"{name}", name,
+		"{date}", date,
+	).Replace(e.cfg.Template)
+	return invalidFilenameChars.ReplaceAllString(base, "_") + e.ext
+}
+
+// file returns the open file of the path, opening it if necessary. If the file of the
+// path is still being compressed, for example when a late measurement arrives for a
+// previous date, the measurements are written to a new part file instead.
+func (e *fileExporter) file(path, date string) (*activeFile, error) {
+	if af, ok := e.files[path]; ok {
+		return af, nil
+	}
+	target := path
+	if e.pending[path] {
+		target = e.partName(path)
+	}
+	af, err := e.open(target, date)
+	if err != nil {
+		return nil, err
+	}
+	af.key = path
+	e.files[path] = af
+	return af, nil
+}
+
+// partName returns an unused name for a part file of the path
+func (e *fileExporter) partName(path string) string {
+	base := strings.TrimSuffix(path, e.ext)
+	for i := 1; ; i++ {
+		part := fmt.Sprintf("%s.%d%s", base, i, e.ext)
+		if !e.pending[part] && !exists(part) && !exists(part+".gz") {
+			return part
+		}
+	}
+}
+
+// open opens the file for appending. A file written with a different header is rotated
+// first so that each CSV file has a single header.
+func (e *fileExporter) open(path, date string) (*activeFile, error) {
+	if e.header != nil {
+		header, err := readHeader(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if header != nil && !bytes.Equal(header, e.header) {
+			e.logger.LogAttrs(context.TODO(), slog.LevelInfo, "Columns have changed, rotating file", slog.String("path", path))
+			if err := e.archive(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+	af := &activeFile{f: f, key: path, path: path, date: date, size: info.Size(), created: e.now()}
+	if af.size == 0 {
+		if err := syncDir(e.cfg.Dir); err != nil {
+			return nil, errors.Join(err, f.Close())
+		}
+		if e.header != nil {
+			n, err := f.Write(e.header)
+			af.size += int64(n)
+			if err != nil {
+				return nil, errors.Join(err, f.Close())
+			}
+		}
+	} else {
+		// The creation time of an existing file is not known, so its age counts from
+		// when it was last modified
+		af.created = info.ModTime()
+	}
+	return af, nil
+}
+
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	return line, nil
+}
+
+func (e *fileExporter) needsRotation(af *activeFile, recordSize int) bool {
+	if e.cfg.MaxSize > 0 && af.size > int64(len(e.header)) && af.size+int64(recordSize) > e.cfg.MaxSize {
+		return true
+	}
+	return e.cfg.RotateInterval > 0 && e.now().Sub(af.created) >= e.cfg.RotateInterval
+}
+
+// rotate closes the file and moves it aside with the rotation time in its name
+func (e *fileExporter) rotate(af *activeFile) error {
+	delete(e.files, af.key)
+	if err := closeFile(af.f); err != nil {
+		return err
+	}
+	return e.archive(af.path)
+}
+
+func (e *fileExporter) archive(path string) error {
+	base := strings.TrimSuffix(path, e.ext)
+	suffix := e.now().Format("20060102T150405")
+	rotated := base + "-" + suffix + e.ext
+	for i := 1; e.pending[rotated] || exists(rotated) || exists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s-%s.%d%s", base, suffix, i, e.ext)
+	}
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+	if err := syncDir(e.cfg.Dir); err != nil {
+		return err
+	}
+	e.logger.LogAttrs(context.TODO(), slog.LevelInfo, "Rotated file", slog.String("path", rotated))
+	if e.cfg.Compress {
+		e.compressAsync(rotated)
+	}
+	return nil
+}
+
+// closePreviousDates closes the files of dates before the given one. With a {date}
+// template those files are complete and are compressed like rotated files. A late
+// measurement of a previous date does not close the files of later dates.
+func (e *fileExporter) closePreviousDates(date string) error {
+	if !strings.Contains(e.cfg.Template, "{date}") {
+		return nil
+	}
+	var errs []error
+	for path, af := range e.files {
+		if af.date >= date {
+			continue
+		}
+		delete(e.files, path)
+		if err := closeFile(af.f); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if e.cfg.Compress {
+			e.compressAsync(af.path)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compressAsync compresses the file in the background. The caller must hold mu.
+func (e *fileExporter) compressAsync(path string) {
+	dst := e.compressedName(path)
+	e.pending[path] = true
+	e.pending[dst] = true
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		if err := compress(path, dst); err != nil {
+			e.logger.LogAttrs(context.TODO(), slog.LevelError, "Failed to compress file", slog.String("path", path), slog.Any("error", err))
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.pending, path)
+		delete(e.pending, dst)
+	}()
+}
+
+// compressedName returns the name of the compressed copy of the file. An existing
+// compressed file of the same name, such as the one of the earlier measurements of a
+// date, is never overwritten.
+func (e *fileExporter) compressedName(path string) string {
+	dst := path + ".gz"
+	base := strings.TrimSuffix(path, e.ext)
+	for i := 1; e.pending[dst] || exists(dst); i++ {
+		dst = fmt.Sprintf("%s.%d%s.gz", base, i, e.ext)
+	}
+	return dst
+}
+
+// compress replaces the file with a gzip compressed copy dst
+func compress(path, dst string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, src); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	if err := closeFile(out); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// closeFile flushes the file to disk before closing it
+func closeFile(f *os.File) error {
+	return errors.Join(f.Sync(), f.Close())
+}
+
+// syncDir flushes the directory entries so that created and renamed files survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (e *fileExporter) Close() error {
+	e.mu.Lock()
+	var errs []error
+	for path, af := range e.files {
+		delete(e.files, path)
+		errs = append(errs, closeFile(af.f))
+	}
+	e.mu.Unlock()
+	e.wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,160 @@
+package file
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestCSV(t *testing.T) {
+	dir := t.TempDir()
+	columns := map[string]string{"time": "time", "name": "name", "temperature": "temperature"}
+	ts := time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)
+	exp, err := New(Config{Dir: dir, Columns: columns})
+	require.NoError(t, err)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Name: "Back, yard", Temperature: 21.5, Timestamp: ts}))
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Name: "Back, yard", Temperature: 21.7, Timestamp: ts.Add(time.Minute)}))
+	require.NoError(t, exp.Close())
+	assert.Equal(t, "time,name,temperature\n"+
+		"2024-05-01T23:58:00Z,\"Back, yard\",21.5\n"+
+		"2024-05-01T23:59:00Z,\"Back, yard\",21.7\n",
+		read(t, filepath.Join(dir, "ruuvitag.csv")))
+
+	// The file is appended to without another header
+	exp, err = New(Config{Dir: dir, Columns: columns})
+	require.NoError(t, err)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: ts.Add(2 * time.Minute)}))
+	require.NoError(t, exp.Close())
+	lines := strings.Split(strings.TrimSpace(read(t, filepath.Join(dir, "ruuvitag.csv"))), "\n")
+	assert.Len(t, lines, 4)
+}
+
+func TestJSONL(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	exp, err := New(Config{Dir: dir, Format: FormatJSONL, Template: "{name}-{date}", Columns: map[string]string{"time": "time", "name": "name", "temperature": "temperature"}})
+	require.NoError(t, err)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Name: "Backyard", Temperature: 21.5, Timestamp: ts}))
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Timestamp: ts}))
+	require.NoError(t, exp.Close())
+	assert.Equal(t, []string{"Backyard-2024-05-01.jsonl", "CCCA7E52CC34-2024-05-01.jsonl"}, files(t, dir))
+	assert.Equal(t,
+		`{"name":"Backyard","temperature":21.5,"time":"2024-05-01T12:00:00Z"}`+"\n",
+		read(t, filepath.Join(dir, "Backyard-2024-05-01.jsonl")))
+}
+
+func TestSizeRotation(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{Dir: dir, MaxSize: 40, Compress: true, Columns: map[string]string{"time": "time"}})
+	require.NoError(t, err)
+	exp := e.(*fileExporter)
+	ts := time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)
+	exp.now = func() time.Time { return ts }
+	for i := range 3 {
+		require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: ts.Add(time.Duration(i) * time.Minute)}))
+	}
+	require.NoError(t, exp.Close())
+	assert.Equal(t, []string{"ruuvitag-20240501T235800.1.csv.gz", "ruuvitag-20240501T235800.csv.gz", "ruuvitag.csv"}, files(t, dir))
+	assert.Equal(t, "time\n2024-05-01T23:58:00Z\n", read(t, filepath.Join(dir, "ruuvitag-20240501T235800.csv.gz")))
+	assert.Equal(t, "time\n2024-05-02T00:00:00Z\n", read(t, filepath.Join(dir, "ruuvitag.csv")))
+}
+
+func TestTimeRotation(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{Dir: dir, RotateInterval: time.Hour, Columns: map[string]string{"time": "time"}})
+	require.NoError(t, err)
+	exp := e.(*fileExporter)
+	now := time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)
+	exp.now = func() time.Time { return now }
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: now}))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: now}))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: now}))
+	require.NoError(t, exp.Close())
+	assert.Equal(t, []string{"ruuvitag-20240502T005800.csv", "ruuvitag.csv"}, files(t, dir))
+}
+
+func TestDailyFiles(t *testing.T) {
+	dir := t.TempDir()
+	exp, err := New(Config{Dir: dir, Template: "ruuvitag-{date}", Compress: true, Columns: map[string]string{"time": "time"}})
+	require.NoError(t, err)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)}))
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: time.Date(2024, 5, 2, 0, 3, 0, 0, time.UTC)}))
+	require.NoError(t, exp.Close())
+	// The file of the previous day is compressed once the next day begins
+	assert.Equal(t, []string{"ruuvitag-2024-05-01.csv.gz", "ruuvitag-2024-05-02.csv"}, files(t, dir))
+}
+
+func TestLateMeasurements(t *testing.T) {
+	dir := t.TempDir()
+	exp, err := New(Config{Dir: dir, Template: "ruuvitag-{date}", Compress: true, Columns: map[string]string{"time": "time"}})
+	require.NoError(t, err)
+	for _, ts := range []string{"2024-05-01T23:58:00Z", "2024-05-02T00:03:00Z", "2024-05-01T23:59:00Z", "2024-05-02T00:04:00Z"} {
+		timestamp, err := time.Parse(time.RFC3339, ts)
+		require.NoError(t, err)
+		require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: timestamp}))
+	}
+	require.NoError(t, exp.Close())
+	// A late measurement of the previous day does not overwrite its compressed file
+	assert.Equal(t, []string{"ruuvitag-2024-05-01.1.csv.gz", "ruuvitag-2024-05-01.csv.gz", "ruuvitag-2024-05-02.csv"}, files(t, dir))
+	assert.Equal(t, "time\n2024-05-01T23:58:00Z\n", read(t, filepath.Join(dir, "ruuvitag-2024-05-01.csv.gz")))
+	assert.Equal(t, "time\n2024-05-01T23:59:00Z\n", read(t, filepath.Join(dir, "ruuvitag-2024-05-01.1.csv.gz")))
+	assert.Equal(t, "time\n2024-05-02T00:03:00Z\n2024-05-02T00:04:00Z\n", read(t, filepath.Join(dir, "ruuvitag-2024-05-02.csv")))
+}
+
+func TestChangedColumns(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	exp, err := New(Config{Dir: dir, Columns: map[string]string{"time": "time"}})
+	require.NoError(t, err)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: ts}))
+	require.NoError(t, exp.Close())
+	exp, err = New(Config{Dir: dir, Columns: map[string]string{"time": "time", "temperature": "temperature"}})
+	require.NoError(t, err)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Timestamp: ts.Add(time.Minute)}))
+	require.NoError(t, exp.Close())
+	names := files(t, dir)
+	require.Len(t, names, 2)
+	assert.True(t, strings.HasPrefix(read(t, filepath.Join(dir, "ruuvitag.csv")), "time,temperature\n"))
+	assert.True(t, strings.HasPrefix(read(t, filepath.Join(dir, names[0])), "time\n"))
+}
@@ -5,6 +5,7 @@ package pubsub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -12,7 +13,6 @@ import (
 	"cloud.google.com/go/pubsub"
 	"google.golang.org/api/option"
 
-	"github.com/niktheblak/ruuvitag-common/pkg/columnmap"
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
 
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
@@ -58,23 +58,50 @@ func (e *pubsubExporter) Name() string {
 }
 
 func (e *pubsubExporter) Export(ctx context.Context, data sensor.Data) error {
-	fields := columnmap.Transform(e.columns, data)
+	msg, err := e.message(ctx, data)
+	if err != nil {
+		return err
+	}
+	_, err = e.topic.Publish(ctx, msg).Get(ctx)
+	return err
+}
+
+// ExportBatch publishes all measurements before waiting for the results so that the client
+// can bundle them into as few requests as possible
+func (e *pubsubExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	results := make([]*pubsub.PublishResult, 0, len(batch))
+	for _, m := range batch {
+		msg, err := e.message(m.Context(ctx), m.Data)
+		if err != nil {
+			return err
+		}
+		results = append(results, e.topic.Publish(ctx, msg))
+	}
+	var errs []error
+	for _, r := range results {
+		if _, err := r.Get(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *pubsubExporter) message(ctx context.Context, data sensor.Data) (*pubsub.Message, error) {
+	fields := exporter.Transform(ctx, e.columns, data)
 	delete(fields, e.columns["mac"])  // included as attribute
 	delete(fields, e.columns["name"]) // included as attribute
 	jsonData, err := json.Marshal(fields)
 	if err != nil {
-		return err
+		return nil, exporter.Permanent(err)
 	}
 	e.logger.LogAttrs(ctx, slog.LevelInfo, "Publishing measurement", slog.String("data", string(jsonData)), slog.String("mac", data.Addr), slog.String("name", data.Name))
 	attrs := make(map[string]string)
 	attrs[e.columns["mac"]] = data.Addr
 	attrs[e.columns["name"]] = data.Name
-	msg := &pubsub.Message{
+	return &pubsub.Message{
 		Data:       jsonData,
 		Attributes: attrs,
-	}
-	_, err = e.topic.Publish(ctx, msg).Get(ctx)
-	return err
+	}, nil
 }
 
 func (e *pubsubExporter) Close() error {
@@ -0,0 +1,57 @@
+//go:build gcp
+
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+func TestExportBatch(t *testing.T) {
+	ctx := context.Background()
+	srv := pstest.NewServer()
+	defer srv.Close()
+	conn, err := grpc.NewClient(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	client, err := pubsub.NewClient(ctx, "test-project", option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	topic, err := client.CreateTopic(ctx, "measurements")
+	require.NoError(t, err)
+	exp := &pubsubExporter{
+		client:  client,
+		topic:   topic,
+		columns: map[string]string{"mac": "mac", "name": "name", "temperature": "temperature", "tilt_x": "tilt_x"},
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	defer exp.Close()
+	batch := []exporter.Measurement{
+		{Data: sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.5}},
+		{Data: sensor.Data{Addr: "FB:E1:B7:04:95:EE", Name: "Upstairs", Temperature: 22.5}, Extra: map[string]any{"tilt_x": 12.5}},
+	}
+	require.NoError(t, exp.ExportBatch(ctx, batch))
+	msgs := srv.Messages()
+	require.Len(t, msgs, 2)
+	names := make(map[string]map[string]any)
+	for _, msg := range msgs {
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(msg.Data, &fields))
+		names[msg.Attributes["name"]] = fields
+	}
+	assert.Equal(t, map[string]any{"temperature": 21.5}, names["Backyard"])
+	assert.Equal(t, map[string]any{"temperature": 22.5, "tilt_x": 12.5}, names["Upstairs"])
+}
@@ -0,0 +1,211 @@
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// maxPacketSize keeps UDP packets within the MTU of typical networks
+const maxPacketSize = 1432
+
+type Config struct {
+	// Addr is the address of the Carbon plaintext listener, such as tcp://localhost:2003 or
+	// udp://localhost:2003. Plain host:port addresses use TCP.
+	Addr string
+	// Prefix is the {prefix} of the path template. Defaults to ruuvitag.
+	Prefix string
+	// Template is the metric path template. Defaults to DefaultTemplate.
+	Template Template
+	Timeout  time.Duration
+	Columns  map[string]string
+	Logger   *slog.Logger
+}
+
+type graphiteExporter struct {
+	network  string
+	addr     string
+	prefix   string
+	template Template
+	timeout  time.Duration
+	columns  map[string]string
+	logger   *slog.Logger
+	mu       sync.Mutex
+	conn     net.Conn
+}
+
+// New creates an exporter that sends measurements to Graphite as plaintext protocol lines.
+// The connection is opened on the first export and reopened after write errors.
+func New(cfg Config) (exporter.Exporter, error) {
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("Graphite address must be specified")
+	}
+	if len(cfg.Columns) == 0 {
+		return nil, fmt.Errorf("columns must be non-empty")
+	}
+	network, addr, err := parseAddr(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "ruuvitag"
+	}
+	if cfg.Template == "" {
+		cfg.Template = DefaultTemplate
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &graphiteExporter{
+		network:  network,
+		addr:     addr,
+		prefix:   cfg.Prefix,
+		template: cfg.Template,
+		timeout:  cfg.Timeout,
+		columns:  cfg.Columns,
+		logger:   cfg.Logger.With("exporter", "Graphite"),
+	}, nil
+}
+
+func parseAddr(addr string) (network, hostPort string, err error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		// host:port without a scheme
+		return "tcp", addr, nil
+	}
+	switch u.Scheme {
+	case "tcp", "udp":
+		return u.Scheme, u.Host, nil
+	default:
+		return "", "", fmt.Errorf("unsupported Graphite address scheme: %s", u.Scheme)
+	}
+}
+
+func (e *graphiteExporter) Name() string {
+	return fmt.Sprintf("Graphite (%s)", e.addr)
+}
+
+func (e *graphiteExporter) Export(ctx context.Context, data sensor.Data) error {
+	return e.write(ctx, e.lines(ctx, data))
+}
+
+func (e *graphiteExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	buf := new(bytes.Buffer)
+	for _, m := range batch {
+		buf.Write(e.lines(m.Context(ctx), m.Data))
+	}
+	return e.write(ctx, buf.Bytes())
+}
+
+// lines formats the numeric columns of the measurement as plaintext protocol lines
+func (e *graphiteExporter) lines(ctx context.Context, data sensor.Data) []byte {
+	ts := data.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	buf := new(bytes.Buffer)
+	for column, v := range exporter.NumericFields(ctx, e.columns, data) {
+		fmt.Fprintf(buf, "%s %s %d\n", e.template.Path(e.prefix, column, data), strconv.FormatFloat(v, 'f', -1, 64), ts.Unix())
+	}
+	return buf.Bytes()
+}
+
+// write sends the lines, reconnecting once if the connection has been lost
+func (e *graphiteExporter) write(ctx context.Context, lines []byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	reconnected := false
+	if e.conn == nil {
+		if err := e.connect(ctx); err != nil {
+			return err
+		}
+		reconnected = true
+	}
+	err := e.send(lines)
+	if err == nil || reconnected {
+		return err
+	}
+	e.logger.LogAttrs(ctx, slog.LevelWarn, "Write failed, reconnecting", slog.Any("error", err))
+	if err := e.connect(ctx); err != nil {
+		return err
+	}
+	return e.send(lines)
+}
+
+func (e *graphiteExporter) connect(ctx context.Context) error {
+	if e.conn != nil {
+		_ = e.conn.Close()
+		e.conn = nil
+	}
+	dialer := net.Dialer{Timeout: e.timeout}
+	conn, err := dialer.DialContext(ctx, e.network, e.addr)
+	if err != nil {
+		return err
+	}
+	e.logger.LogAttrs(ctx, slog.LevelDebug, "Connected", slog.String("network", e.network), slog.String("addr", e.addr))
+	e.conn = conn
+	return nil
+}
+
+func (e *graphiteExporter) send(lines []byte) error {
+	err := e.conn.SetWriteDeadline(time.Now().Add(e.timeout))
+	if err == nil {
+		if e.network == "udp" {
+			err = writePackets(e.conn, lines)
+		} else {
+			_, err = e.conn.Write(lines)
+		}
+	}
+	if err != nil {
+		_ = e.conn.Close()
+		e.conn = nil
+	}
+	return err
+}
+
+// writePackets splits the lines into UDP packets of at most maxPacketSize bytes
+func writePackets(conn net.Conn, lines []byte) error {
+	for len(lines) > 0 {
+		n := len(lines)
+		if n > maxPacketSize {
+			// Split after the last complete line that fits in the packet
+			n = bytes.LastIndexByte(lines[:maxPacketSize], '\n') + 1
+			if n == 0 {
+				n = bytes.IndexByte(lines, '\n') + 1
+			}
+		}
+		if _, err := conn.Write(lines[:n]); err != nil {
+			return err
+		}
+		lines = lines[n:]
+	}
+	return nil
+}
+
+func (e *graphiteExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
@@ -0,0 +1,158 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var (
+	columns = map[string]string{
+		"time":        "time",
+		"mac":         "mac",
+		"name":        "name",
+		"temperature": "temperature",
+		"humidity":    "humidity",
+	}
+	testData = sensor.Data{
+		Addr:        "cc:ca:7e:52:cc:34",
+		Name:        "Back yard",
+		Temperature: 21.5,
+		Humidity:    60,
+		Timestamp:   time.Unix(1714564800, 0),
+	}
+)
+
+func TestTemplate(t *testing.T) {
+	assert.Equal(t, "ruuvitag.Back_yard.temperature", Template(DefaultTemplate).Path("ruuvitag", "temperature", testData))
+	assert.Equal(t, "sensors.CCCA7E52CC34.temp_c", Template("{prefix}.{mac}.{column}").Path("sensors", "temp.c", testData))
+	assert.Equal(t, "CCCA7E52CC34.humidity", Template(DefaultTemplate).Path("", "humidity", sensor.Data{Addr: testData.Addr}))
+}
+
+// server accepts TCP connections and sends the received lines to a channel
+type server struct {
+	ln    net.Listener
+	lines chan string
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func listen(t *testing.T, addr string, lines chan string) *server {
+	ln, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	s := &server{ln: ln, lines: lines}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func receive(t *testing.T, lines chan string, n int) []string {
+	t.Helper()
+	var received []string
+	for range n {
+		select {
+		case line := <-lines:
+			received = append(received, line)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for lines")
+		}
+	}
+	sort.Strings(received)
+	return received
+}
+
+func TestExportTCP(t *testing.T) {
+	lines := make(chan string, 100)
+	srv := listen(t, "127.0.0.1:0", lines)
+	defer srv.Close()
+	exp, err := New(Config{Addr: srv.ln.Addr().String(), Columns: columns})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.NoError(t, exp.Export(context.Background(), testData))
+	assert.Equal(t, []string{
+		"ruuvitag.Back_yard.humidity 60 1714564800",
+		"ruuvitag.Back_yard.temperature 21.5 1714564800",
+	}, receive(t, lines, 2))
+}
+
+func TestReconnect(t *testing.T) {
+	lines := make(chan string, 100)
+	srv := listen(t, "127.0.0.1:0", lines)
+	addr := srv.ln.Addr().String()
+	exp, err := New(Config{Addr: "tcp://" + addr, Columns: map[string]string{"temperature": "temperature"}})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.NoError(t, exp.Export(context.Background(), testData))
+	receive(t, lines, 1)
+	// Restart the server. Writes to the closed connection fail once the peer has reset it,
+	// after which the exporter reconnects.
+	srv.Close()
+	srv = listen(t, addr, lines)
+	defer srv.Close()
+	assert.Eventually(t, func() bool {
+		_ = exp.Export(context.Background(), testData)
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return len(srv.conns) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"ruuvitag.Back_yard.temperature 21.5 1714564800"}, receive(t, lines, 1))
+}
+
+func TestExportUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	exp, err := New(Config{Addr: "udp://" + conn.LocalAddr().String(), Prefix: "home", Columns: columns})
+	require.NoError(t, err)
+	defer exp.Close()
+	batch := []exporter.Measurement{{Data: testData}, {Data: testData}}
+	require.NoError(t, exporter.ExportBatch(context.Background(), exp, batch))
+	buf := make([]byte, 65536)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	received := strings.Split(strings.TrimSpace(string(buf[:n])), "\n")
+	sort.Strings(received)
+	assert.Equal(t, []string{
+		"home.Back_yard.humidity 60 1714564800",
+		"home.Back_yard.humidity 60 1714564800",
+		"home.Back_yard.temperature 21.5 1714564800",
+		"home.Back_yard.temperature 21.5 1714564800",
+	}, received)
+}
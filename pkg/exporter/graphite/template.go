@@ -0,0 +1,42 @@
+package graphite
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+// DefaultTemplate is the default metric path template
+const DefaultTemplate = "{prefix}.{name}.{column}"
+
+var invalidPathChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Template builds metric paths from a template where {prefix}, {mac}, {name} and {column}
+// are replaced with the prefix, the MAC address and name of the RuuviTag and the name of
+// the column in the column map
+type Template string
+
+// Path returns the metric path of the column. The name of the RuuviTag is replaced with its
+// MAC address if the RuuviTag has no name.
+func (t Template) Path(prefix, column string, data sensor.Data) string {
+	mac := Sanitize(strings.ReplaceAll(strings.ToUpper(data.Addr), ":", ""))
+	name := Sanitize(data.Name)
+	if name == "" {
+		name = mac
+	}
+	path := strings.NewReplacer(
+		"{prefix}", prefix,
+		"{mac}", mac,
+		"{name}", name,
+		"{column}", Sanitize(column),
+	).Replace(string(t))
+	// An empty prefix leaves a leading dot
+	return strings.Trim(path, ".")
+}
+
+// Sanitize replaces characters that are not allowed in a metric path component with
+// underscores
+func Sanitize(s string) string {
+	return invalidPathChars.ReplaceAllString(s, "_")
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"fmt"
+	"log/slog"
+	nethttp "net/http"
+	"net/url"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+// DefaultSignatureHeader is the default header of the HMAC-SHA256 signature
+const DefaultSignatureHeader = "X-Signature-256"
+
+// DefaultRetryableStatuses are the response statuses after which an export is retried by
+// default. Other non-2xx statuses fail the export permanently. Authentication failures and
+// a missing endpoint are retried since they are caused by the configuration or the server
+// rather than the measurement, so that the measurements are kept until they are fixed.
+var DefaultRetryableStatuses = []int{
+	nethttp.StatusUnauthorized,
+	nethttp.StatusForbidden,
+	nethttp.StatusNotFound,
+	nethttp.StatusProxyAuthRequired,
+	nethttp.StatusRequestTimeout,
+	nethttp.StatusTooEarly,
+	nethttp.StatusTooManyRequests,
+	nethttp.StatusInternalServerError,
+	nethttp.StatusBadGateway,
+	nethttp.StatusServiceUnavailable,
+	nethttp.StatusGatewayTimeout,
+}
+
+type Config struct {
+	URL   string
+	Token string
+	// EventURL is the URL that events detected from the measurements are sent to as JSON.
+	// Events are not sent if empty.
+	EventURL string
+	// Method is the HTTP method of the requests. Defaults to POST.
+	Method string
+	// Headers are additional request headers, which may override the default ones
+	Headers map[string]string
+	// Secret signs the request body with HMAC-SHA256. The signature is sent as
+	// sha256=<hex digest> in SignatureHeader.
+	Secret string
+	// SignatureHeader is the header of the signature. Defaults to DefaultSignatureHeader.
+	SignatureHeader string
+	// Gzip compresses the request body with gzip
+	Gzip bool
+	// Template is a text/template of the request body, executed with the measurement as
+	// a map of column names to values. The body is the measurement as a JSON object if
+	// empty.
+	Template string
+	// ContentType is the content type of the request body. Defaults to application/json.
+	ContentType string
+	// RetryableStatuses are the response statuses after which the export is retried.
+	// Defaults to DefaultRetryableStatuses.
+	RetryableStatuses []int
+	Timeout           time.Duration
+	TLS               tlsconfig.Config
+	Columns           map[string]string
+	Logger            *slog.Logger
+}
+
+func Validate(cfg Config) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("parameter url must be non-empty")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if _, err := url.Parse(cfg.EventURL); err != nil {
+		return fmt.Errorf("invalid event url: %w", err)
+	}
+	if len(cfg.Columns) == 0 {
+		return fmt.Errorf("columns must be non-empty")
+	}
+	if cfg.SignatureHeader != "" && cfg.Secret == "" {
+		return fmt.Errorf("signature header requires a secret")
+	}
+	tmpl, err := parseTemplate(cfg.Template)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	if tmpl != nil {
+		if err := checkTemplate(tmpl, cfg.Columns); err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+	}
+	for _, status := range cfg.RetryableStatuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid retryable status: %d", status)
+		}
+	}
+	return tlsconfig.Validate(cfg.TLS)
+}
@@ -2,86 +2,179 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	nethttp "net/http"
-	"time"
+	"slices"
+	"text/template"
 
-	"github.com/niktheblak/ruuvitag-common/pkg/columnmap"
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
 )
 
-type Config struct {
-	URL     string
-	Token   string
-	Timeout time.Duration
-	Columns map[string]string
-	Logger  *slog.Logger
-}
-
 type httpExporter struct {
-	client  *nethttp.Client
-	url     string
-	token   string
-	columns map[string]string
-	logger  *slog.Logger
+	cfg      Config
+	client   *nethttp.Client
+	template *template.Template
+	logger   *slog.Logger
 }
 
 func New(cfg Config) (exporter.Exporter, error) {
-	if cfg.URL == "" {
-		return nil, fmt.Errorf("parameter url must be non-empty")
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Method == "" {
+		cfg.Method = nethttp.MethodPost
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+	if cfg.SignatureHeader == "" {
+		cfg.SignatureHeader = DefaultSignatureHeader
 	}
-	if len(cfg.Columns) == 0 {
-		return nil, fmt.Errorf("columns must be non-empty")
+	if cfg.RetryableStatuses == nil {
+		cfg.RetryableStatuses = DefaultRetryableStatuses
 	}
 	if cfg.Logger == nil {
 		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	}
-	cfg.Logger = cfg.Logger.With("exporter", "HTTP")
+	tmpl, err := parseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
 	client := &nethttp.Client{
 		Timeout: cfg.Timeout,
 	}
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := tlsconfig.New(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
 	return &httpExporter{
-		client:  client,
-		url:     cfg.URL,
-		token:   cfg.Token,
-		columns: cfg.Columns,
-		logger:  cfg.Logger,
+		cfg:      cfg,
+		client:   client,
+		template: tmpl,
+		logger:   cfg.Logger.With("exporter", "HTTP"),
 	}, nil
 }
 
 func (h *httpExporter) Name() string {
-	return fmt.Sprintf("HTTP (%s)", h.url)
+	return fmt.Sprintf("HTTP (%s)", h.cfg.URL)
 }
 
 func (h *httpExporter) Export(ctx context.Context, data sensor.Data) error {
-	buf := new(bytes.Buffer)
-	enc := json.NewEncoder(buf)
-	err := enc.Encode(columnmap.Transform(h.columns, data))
+	body, err := h.body(exporter.Transform(ctx, h.cfg.Columns, data))
 	if err != nil {
-		return err
+		return exporter.Permanent(err)
 	}
-	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, h.url, buf)
+	h.logger.LogAttrs(ctx, slog.LevelDebug, "Sending measurement", slog.String("url", h.cfg.URL), slog.String("data", string(body)))
+	return h.send(ctx, h.cfg.URL, h.cfg.ContentType, body)
+}
+
+// ExportEvent sends the event as JSON to the event URL. Events are not sent if the event
+// URL is not set.
+func (h *httpExporter) ExportEvent(ctx context.Context, ev event.Event) error {
+	if h.cfg.EventURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(ev)
 	if err != nil {
-		return err
+		return exporter.Permanent(err)
+	}
+	h.logger.LogAttrs(ctx, slog.LevelDebug, "Sending event", slog.String("url", h.cfg.EventURL), slog.String("data", string(body)))
+	return h.send(ctx, h.cfg.EventURL, "application/json", body)
+}
+
+// send sends the body to the URL and checks the response status
+func (h *httpExporter) send(ctx context.Context, url, contentType string, body []byte) error {
+	var err error
+	if h.cfg.Gzip {
+		if body, err = compress(body); err != nil {
+			return err
+		}
+	}
+	req, err := nethttp.NewRequestWithContext(ctx, h.cfg.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return exporter.Permanent(err)
 	}
-	h.logger.LogAttrs(ctx, slog.LevelDebug, "Sending measurement", slog.String("url", h.url), slog.String("data", buf.String()))
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("From", "ruuvitag-gollector")
-	if h.token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.token))
+	if h.cfg.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.cfg.Token))
+	}
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if h.cfg.Secret != "" {
+		req.Header.Set(h.cfg.SignatureHeader, sign(h.cfg.Secret, body))
 	}
 	resp, err := h.client.Do(req)
 	if err != nil {
 		return err
 	}
-	content, _ := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	_, _ = io.Copy(io.Discard, resp.Body)
 	h.logger.LogAttrs(ctx, slog.LevelDebug, "Server response", slog.Int("status", resp.StatusCode), slog.String("body", string(content)))
-	return resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(content))
+	if !slices.Contains(h.cfg.RetryableStatuses, resp.StatusCode) {
+		return exporter.Permanent(err)
+	}
+	return err
+}
+
+// body returns the request body of the measurement, either as JSON or rendered with the
+// template
+func (h *httpExporter) body(fields map[string]any) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if h.template != nil {
+		if err := h.template.Execute(buf, templateFields(fields, h.cfg.Columns)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if err := json.NewEncoder(buf).Encode(fields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func compress(body []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sign returns the HMAC-SHA256 signature of the body as sent, that is after compression
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
 }
 
 func (h *httpExporter) Close() error {
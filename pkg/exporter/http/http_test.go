@@ -0,0 +1,200 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var (
+	columns = map[string]string{
+		"time":        "time",
+		"mac":         "mac",
+		"name":        "name",
+		"temperature": "temperature",
+	}
+	testData = sensor.Data{
+		Addr:        "CC:CA:7E:52:CC:34",
+		Name:        "Backyard",
+		Temperature: 21.5,
+		Timestamp:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+)
+
+type request struct {
+	method string
+	header nethttp.Header
+	body   []byte
+}
+
+// newServer returns a server that records the requests and responds with the status
+func newServer(t *testing.T, status int) (*httptest.Server, chan request) {
+	t.Helper()
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests <- request{method: r.Method, header: r.Header, body: body}
+		w.WriteHeader(status)
+		io.WriteString(w, nethttp.StatusText(status))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func newExporter(t *testing.T, cfg Config) exporter.Exporter {
+	t.Helper()
+	if cfg.Columns == nil {
+		cfg.Columns = columns
+	}
+	exp, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		exp.Close()
+	})
+	return exp
+}
+
+func TestExport(t *testing.T) {
+	srv, requests := newServer(t, nethttp.StatusNoContent)
+	exp := newExporter(t, Config{URL: srv.URL, Token: "token"})
+	require.NoError(t, exp.Export(context.Background(), testData))
+
+	req := <-requests
+	assert.Equal(t, nethttp.MethodPost, req.method)
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", req.header.Get("Authorization"))
+	assert.Empty(t, req.header.Get(DefaultSignatureHeader))
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(req.body, &payload))
+	assert.Equal(t, map[string]any{
+		"time":        "2024-05-01T12:00:00Z",
+		"mac":         "CC:CA:7E:52:CC:34",
+		"name":        "Backyard",
+		"temperature": 21.5,
+	}, payload)
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newServer(t, nethttp.StatusServiceUnavailable)
+	err := newExporter(t, Config{URL: srv.URL}).Export(ctx, testData)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503 Service Unavailable")
+	assert.False(t, exporter.IsPermanent(err))
+
+	srv, _ = newServer(t, nethttp.StatusBadRequest)
+	err = newExporter(t, Config{URL: srv.URL}).Export(ctx, testData)
+	require.Error(t, err)
+	assert.True(t, exporter.IsPermanent(err))
+
+	// Authentication failures are retried so that the measurements are kept until the
+	// credentials are fixed
+	srv, _ = newServer(t, nethttp.StatusUnauthorized)
+	err = newExporter(t, Config{URL: srv.URL}).Export(ctx, testData)
+	require.Error(t, err)
+	assert.False(t, exporter.IsPermanent(err))
+
+	// Only the configured statuses are retried
+	srv, _ = newServer(t, nethttp.StatusServiceUnavailable)
+	err = newExporter(t, Config{URL: srv.URL, RetryableStatuses: []int{nethttp.StatusConflict}}).Export(ctx, testData)
+	require.Error(t, err)
+	assert.True(t, exporter.IsPermanent(err))
+}
+
+func TestSignedGzip(t *testing.T) {
+	srv, requests := newServer(t, nethttp.StatusOK)
+	exp := newExporter(t, Config{
+		URL:     srv.URL,
+		Method:  nethttp.MethodPut,
+		Headers: map[string]string{"X-Api-Key": "key", "From": "backyard"},
+		Secret:  "secret",
+		Gzip:    true,
+	})
+	require.NoError(t, exp.Export(context.Background(), testData))
+
+	req := <-requests
+	assert.Equal(t, nethttp.MethodPut, req.method)
+	assert.Equal(t, "key", req.header.Get("X-Api-Key"))
+	assert.Equal(t, "backyard", req.header.Get("From"))
+	assert.Equal(t, "gzip", req.header.Get("Content-Encoding"))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(req.body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.header.Get(DefaultSignatureHeader))
+
+	r, err := gzip.NewReader(bytes.NewReader(req.body))
+	require.NoError(t, err)
+	var payload map[string]any
+	require.NoError(t, json.NewDecoder(r).Decode(&payload))
+	assert.Equal(t, 21.5, payload["temperature"])
+}
+
+func TestTemplate(t *testing.T) {
+	srv, requests := newServer(t, nethttp.StatusAccepted)
+	exp := newExporter(t, Config{
+		URL:             srv.URL,
+		Template:        `{"device": {{json .name}}, "readings": {"temp_c": {{.temperature}}, "battery_low": {{json .battery_low}}}, "at": {{json .time}}}`,
+		Secret:          "secret",
+		SignatureHeader: "X-Hub-Signature-256",
+		Columns:         map[string]string{"name": "name", "temperature": "temperature", "time": "time", "battery_low": "battery_low"},
+	})
+	require.NoError(t, exp.Export(context.Background(), testData))
+
+	req := <-requests
+	assert.JSONEq(t, `{"device": "Backyard", "readings": {"temp_c": 21.5, "battery_low": null}, "at": "2024-05-01T12:00:00Z"}`, string(req.body))
+	assert.NotEmpty(t, req.header.Get("X-Hub-Signature-256"))
+}
+
+func TestExportEvent(t *testing.T) {
+	ctx := context.Background()
+	ev := event.Event{
+		Type:       event.LowBattery,
+		Addr:       testData.Addr,
+		Name:       testData.Name,
+		Timestamp:  testData.Timestamp,
+		Attributes: map[string]any{"battery_voltage": 2.2},
+	}
+	srv, requests := newServer(t, nethttp.StatusNoContent)
+	exp := newExporter(t, Config{URL: srv.URL, EventURL: srv.URL + "/events", Template: `{"device": {{json .name}}}`, Token: "token"})
+	require.NoError(t, exp.(exporter.EventExporter).ExportEvent(ctx, ev))
+
+	req := <-requests
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", req.header.Get("Authorization"))
+	// The template applies only to the measurements
+	assert.JSONEq(t, `{"type":"low_battery","mac":"CC:CA:7E:52:CC:34","name":"Backyard","time":"2024-05-01T12:00:00Z","attributes":{"battery_voltage":2.2}}`, string(req.body))
+
+	// Events are not sent without an event URL
+	exp = newExporter(t, Config{URL: srv.URL})
+	require.NoError(t, exp.(exporter.EventExporter).ExportEvent(ctx, ev))
+	assert.Empty(t, requests)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(Config{URL: "http://localhost", Columns: columns}))
+	assert.Error(t, Validate(Config{Columns: columns}))
+	assert.Error(t, Validate(Config{URL: "http://localhost"}))
+	assert.Error(t, Validate(Config{URL: "http://localhost", Columns: columns, Template: "{{.name"}))
+	// Columns that are not in the column map are rejected instead of rendered as <no value>
+	assert.Error(t, Validate(Config{URL: "http://localhost", Columns: columns, Template: "{{.humidity}}"}))
+	assert.NoError(t, Validate(Config{URL: "http://localhost", Columns: columns, Template: "{{if gt .temperature 0.0}}warm{{end}}"}))
+	assert.Error(t, Validate(Config{URL: "http://localhost", Columns: columns, SignatureHeader: "X-Signature"}))
+	assert.Error(t, Validate(Config{URL: "http://localhost", Columns: columns, RetryableStatuses: []int{42}}))
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"text/template"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, for example to quote strings and times
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseTemplate parses the request body template. It returns nil if the template is empty.
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("body").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// checkTemplate executes the template with a measurement of zero values so that templates
+// referring to columns that are not in the column map fail at startup
+func checkTemplate(tmpl *template.Template, columns map[string]string) error {
+	fields := exporter.Transform(context.Background(), columns, sensor.Data{})
+	return tmpl.Execute(io.Discard, templateFields(fields, columns))
+}
+
+// templateFields adds the columns that are missing from the measurement, such as
+// additional columns that were not computed for it, as nil values
+func templateFields(fields map[string]any, columns map[string]string) map[string]any {
+	for _, name := range columns {
+		if _, ok := fields[name]; !ok {
+			fields[name] = nil
+		}
+	}
+	return fields
+}
@@ -3,6 +3,7 @@ package influxdb
 import (
 	"fmt"
 	"log/slog"
+	"net/url"
 	"time"
 )
 
@@ -31,3 +32,42 @@ func Validate(cfg Config) error {
 	}
 	return nil
 }
+
+// V1Config configures an exporter that writes line protocol to InfluxDB 1.x or to a
+// Telegraf listener
+type V1Config struct {
+	// Addr is the URL of the InfluxDB 1.x server, such as http://localhost:8086, or the
+	// address of a UDP listener, such as udp://localhost:8089
+	Addr            string
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+	// Measurement defaults to ruuvitag
+	Measurement string
+	// PayloadSize is the maximum size of a UDP packet. Defaults to 512 bytes.
+	PayloadSize int
+	Timeout     time.Duration
+	Columns     map[string]string
+	Logger      *slog.Logger
+}
+
+func ValidateV1(cfg V1Config) error {
+	u, err := url.Parse(cfg.Addr)
+	if err != nil || cfg.Addr == "" {
+		return fmt.Errorf("InfluxDB address must be a http, https or udp URL")
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if cfg.Database == "" {
+			return fmt.Errorf("database must be specified")
+		}
+	case "udp":
+	default:
+		return fmt.Errorf("unsupported InfluxDB address scheme: %s", u.Scheme)
+	}
+	if len(cfg.Columns) == 0 {
+		return fmt.Errorf("columns must be non-empty")
+	}
+	return nil
+}
@@ -15,7 +15,6 @@ import (
 	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 
-	"github.com/niktheblak/ruuvitag-common/pkg/columnmap"
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
 
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
@@ -126,15 +125,20 @@ func (e *influxdbExporter) Name() string {
 }
 
 func (e *influxdbExporter) Export(ctx context.Context, data sensor.Data) error {
-	fields := columnmap.Transform(e.columns, data)
-	delete(fields, e.columns["time"]) // included as primary InfluxDB key
-	delete(fields, e.columns["mac"])  // included as tag
-	delete(fields, e.columns["name"]) // included as tag
+	return e.WritePoint(ctx, newPoint(ctx, e.measurement, e.columns, data))
+}
+
+// newPoint creates a point with the MAC address and name of the RuuviTag as tags and the
+// other columns as fields
+func newPoint(ctx context.Context, measurement string, columns map[string]string, data sensor.Data) *write.Point {
+	fields := exporter.Transform(ctx, columns, data)
+	delete(fields, columns["time"]) // included as primary InfluxDB key
+	delete(fields, columns["mac"])  // included as tag
+	delete(fields, columns["name"]) // included as tag
 	tags := make(map[string]string)
-	tags[e.columns["mac"]] = strings.ToUpper(data.Addr)
-	tags[e.columns["name"]] = data.Name
-	point := influxdb2.NewPoint(e.measurement, tags, fields, data.Timestamp)
-	return e.WritePoint(ctx, point)
+	tags[columns["mac"]] = strings.ToUpper(data.Addr)
+	tags[columns["name"]] = data.Name
+	return influxdb2.NewPoint(measurement, tags, fields, data.Timestamp)
 }
 
 func (e *influxdbExporter) Close() error {
@@ -9,3 +9,7 @@ import (
 func New(cfg Config) (exporter.Exporter, error) {
 	return exporter.NoOp{ReportedName: "InfluxDB"}, nil
 }
+
+func NewV1(cfg V1Config) (exporter.Exporter, error) {
+	return exporter.NoOp{ReportedName: "InfluxDB v1"}, nil
+}
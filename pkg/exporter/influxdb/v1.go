@@ -0,0 +1,190 @@
+//go:build influxdb
+
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	lp "github.com/influxdata/line-protocol"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// lineWriter sends encoded line protocol to InfluxDB
+type lineWriter interface {
+	write(ctx context.Context, lines [][]byte) error
+	io.Closer
+}
+
+type v1Exporter struct {
+	lineWriter
+	name        string
+	measurement string
+	columns     map[string]string
+	logger      *slog.Logger
+}
+
+// NewV1 creates an exporter that writes line protocol to the /write endpoint of InfluxDB 1.x
+// or to a UDP listener of InfluxDB or Telegraf
+func NewV1(cfg V1Config) (exporter.Exporter, error) {
+	if err := ValidateV1(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Measurement == "" {
+		cfg.Measurement = "ruuvitag"
+	}
+	if cfg.PayloadSize <= 0 {
+		cfg.PayloadSize = 512
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	u, err := url.Parse(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	e := &v1Exporter{
+		measurement: cfg.Measurement,
+		columns:     cfg.Columns,
+		logger:      cfg.Logger.With("exporter", "InfluxDB v1"),
+	}
+	if u.Scheme == "udp" {
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		e.name = fmt.Sprintf("InfluxDB v1 (%s)", u.Host)
+		e.lineWriter = &udpWriter{conn: conn, payloadSize: cfg.PayloadSize}
+		return e, nil
+	}
+	query := url.Values{}
+	query.Set("db", cfg.Database)
+	if cfg.RetentionPolicy != "" {
+		query.Set("rp", cfg.RetentionPolicy)
+	}
+	query.Set("precision", "ns")
+	u = u.JoinPath("write")
+	u.RawQuery = query.Encode()
+	e.name = fmt.Sprintf("InfluxDB v1 (%s)", cfg.Database)
+	e.lineWriter = &httpWriter{
+		client:   &http.Client{Timeout: cfg.Timeout},
+		url:      u.String(),
+		username: cfg.Username,
+		password: cfg.Password,
+	}
+	return e, nil
+}
+
+func (e *v1Exporter) Name() string {
+	return e.name
+}
+
+func (e *v1Exporter) Export(ctx context.Context, data sensor.Data) error {
+	line, err := e.encode(ctx, data)
+	if err != nil {
+		return err
+	}
+	return e.write(ctx, [][]byte{line})
+}
+
+func (e *v1Exporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	lines := make([][]byte, 0, len(batch))
+	for _, m := range batch {
+		line, err := e.encode(m.Context(ctx), m.Data)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	}
+	return e.write(ctx, lines)
+}
+
+func (e *v1Exporter) encode(ctx context.Context, data sensor.Data) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := lp.NewEncoder(buf)
+	enc.FailOnFieldErr(true)
+	if _, err := enc.Encode(newPoint(ctx, e.measurement, e.columns, data)); err != nil {
+		return nil, exporter.Permanent(err)
+	}
+	return buf.Bytes(), nil
+}
+
+type httpWriter struct {
+	client   *http.Client
+	url      string
+	username string
+	password string
+}
+
+func (w *httpWriter) write(ctx context.Context, lines [][]byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(bytes.Join(lines, nil)))
+	if err != nil {
+		return exporter.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("InfluxDB returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return exporter.Permanent(err)
+	}
+	return err
+}
+
+func (w *httpWriter) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+type udpWriter struct {
+	conn        net.Conn
+	payloadSize int
+}
+
+// write packs as many lines as fit in each packet. Lines longer than the payload size are
+// sent in packets of their own.
+func (w *udpWriter) write(ctx context.Context, lines [][]byte) error {
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+len(line) > w.payloadSize {
+			if _, err := w.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		_, err := w.conn.Write(packet)
+		return err
+	}
+	return nil
+}
+
+func (w *udpWriter) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,126 @@
+//go:build influxdb
+
+package influxdb
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var (
+	testColumns = map[string]string{
+		"time":        "time",
+		"mac":         "mac",
+		"name":        "name",
+		"temperature": "temperature",
+		"humidity":    "humidity",
+	}
+	testData = sensor.Data{
+		Addr:        "cc:ca:7e:52:cc:34",
+		Name:        "Backyard",
+		Temperature: 21.5,
+		Humidity:    60,
+		Timestamp:   time.Unix(1714564800, 0),
+	}
+)
+
+const testLine = "ruuvitag,mac=CC:CA:7E:52:CC:34,name=Backyard humidity=60,temperature=21.5 1714564800000000000\n"
+
+func TestV1HTTP(t *testing.T) {
+	var (
+		req  *http.Request
+		body string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		req, body = r, string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	exp, err := NewV1(V1Config{
+		Addr:            srv.URL,
+		Database:        "ruuvitag",
+		RetentionPolicy: "autogen",
+		Username:        "user",
+		Password:        "secret",
+		Columns:         testColumns,
+	})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.NoError(t, exp.Export(context.Background(), testData))
+	assert.Equal(t, "/write", req.URL.Path)
+	assert.Equal(t, "ruuvitag", req.URL.Query().Get("db"))
+	assert.Equal(t, "autogen", req.URL.Query().Get("rp"))
+	assert.Equal(t, "ns", req.URL.Query().Get("precision"))
+	user, pass, ok := req.BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", pass)
+	assert.Equal(t, testLine, body)
+
+	// Batches are written in a single request
+	require.NoError(t, exporter.ExportBatch(context.Background(), exp, []exporter.Measurement{{Data: testData}, {Data: testData}}))
+	assert.Equal(t, testLine+testLine, body)
+}
+
+func TestV1HTTPError(t *testing.T) {
+	status := http.StatusBadRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error":"database not found"}`))
+	}))
+	defer srv.Close()
+	exp, err := NewV1(V1Config{Addr: srv.URL, Database: "ruuvitag", Columns: testColumns})
+	require.NoError(t, err)
+	defer exp.Close()
+	err = exp.Export(context.Background(), testData)
+	assert.ErrorContains(t, err, "database not found")
+	assert.True(t, exporter.IsPermanent(err))
+	status = http.StatusServiceUnavailable
+	err = exp.Export(context.Background(), testData)
+	require.Error(t, err)
+	assert.False(t, exporter.IsPermanent(err))
+}
+
+func TestV1UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	exp, err := NewV1(V1Config{
+		Addr:        "udp://" + conn.LocalAddr().String(),
+		PayloadSize: len(testLine) * 2,
+		Columns:     testColumns,
+	})
+	require.NoError(t, err)
+	defer exp.Close()
+	batch := []exporter.Measurement{{Data: testData}, {Data: testData}, {Data: testData}}
+	require.NoError(t, exporter.ExportBatch(context.Background(), exp, batch))
+	var packets []string
+	buf := make([]byte, 65536)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for range 2 {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		packets = append(packets, string(buf[:n]))
+	}
+	assert.Equal(t, []string{strings.Repeat(testLine, 2), testLine}, packets)
+}
+
+func TestValidateV1(t *testing.T) {
+	assert.Error(t, ValidateV1(V1Config{Addr: "http://localhost:8086", Columns: testColumns}))
+	assert.Error(t, ValidateV1(V1Config{Addr: "tcp://localhost:8089", Columns: testColumns}))
+	assert.NoError(t, ValidateV1(V1Config{Addr: "udp://localhost:8089", Columns: testColumns}))
+}
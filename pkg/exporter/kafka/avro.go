@@ -0,0 +1,158 @@
+//go:build kafka
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/sr"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+type avroField struct {
+	Name string `json:"name"`
+	Type any    `json:"type"`
+}
+
+type avroColumn struct {
+	name string
+	typ  string
+}
+
+// avroEncoder encodes measurements as Avro records with a schema derived from the
+// column map
+type avroEncoder struct {
+	columns  map[string]string
+	schema   avro.Schema
+	registry *sr.Client
+	subject  string
+	fields   []avroColumn
+	mu       sync.Mutex
+	header   []byte
+}
+
+func newAvroEncoder(cfg Config) (*avroEncoder, error) {
+	e := &avroEncoder{
+		columns: cfg.Columns,
+		subject: cfg.Topic + "-value",
+	}
+	var fields []any
+	for _, key := range exporter.ColumnOrder(cfg.Columns) {
+		name := cfg.Columns[key]
+		switch {
+		case key == "time":
+			fields = append(fields, avroField{Name: name, Type: map[string]string{"type": "long", "logicalType": "timestamp-millis"}})
+			e.fields = append(e.fields, avroColumn{name: name, typ: "timestamp"})
+			continue
+		case key == "mac":
+			fields = append(fields, avroField{Name: name, Type: "string"})
+			e.fields = append(e.fields, avroColumn{name: name, typ: "string"})
+			continue
+		}
+		typ := "double"
+		switch {
+		case key == "name":
+			typ = "string"
+		case slices.Contains(exporter.IntegerColumns, key):
+			typ = "long"
+		case exporter.IsBooleanColumn(key):
+			typ = "boolean"
+		}
+		// Optional fields are unions with null, whose null default must be given explicitly
+		fields = append(fields, map[string]any{"name": name, "type": []string{"null", typ}, "default": nil})
+		e.fields = append(e.fields, avroColumn{name: name, typ: typ})
+	}
+	raw, err := json.Marshal(map[string]any{
+		"type":      "record",
+		"name":      "ruuvitag",
+		"namespace": "com.github.niktheblak.ruuvitag_gollector",
+		"fields":    fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.schema, err = avro.Parse(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SchemaRegistry != "" {
+		opts := []sr.ClientOpt{sr.URLs(cfg.SchemaRegistry)}
+		if cfg.SchemaRegistryUsername != "" {
+			opts = append(opts, sr.BasicAuth(cfg.SchemaRegistryUsername, cfg.SchemaRegistryPassword))
+		}
+		e.registry, err = sr.NewClient(opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// encode returns the Avro record of the measurement. With a schema registry the schema
+// is registered when the first record is encoded and the record is prefixed with the
+// Confluent wire format header.
+func (e *avroEncoder) encode(ctx context.Context, data sensor.Data) ([]byte, error) {
+	header, err := e.schemaHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fields := exporter.Transform(ctx, e.columns, data)
+	record := make(map[string]any, len(e.fields))
+	for _, f := range e.fields {
+		if v, ok := avroValue(f.typ, fields[f.name]); ok {
+			record[f.name] = v
+		}
+	}
+	body, err := avro.Marshal(e.schema, record)
+	if err != nil {
+		return nil, exporter.Permanent(err)
+	}
+	return append(slices.Clone(header), body...), nil
+}
+
+func (e *avroEncoder) schemaHeader(ctx context.Context) ([]byte, error) {
+	if e.registry == nil {
+		return nil, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.header != nil {
+		return e.header, nil
+	}
+	id, err := e.registry.RegisterSchema(ctx, e.subject, sr.Schema{Schema: e.schema.String(), Type: sr.TypeAvro}, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+	var h sr.ConfluentHeader
+	e.header, err = h.AppendEncode(nil, id, nil)
+	return e.header, err
+}
+
+// avroValue converts a column value to the Go type of its Avro type
+func avroValue(typ string, value any) (any, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case time.Time:
+		return v, typ == "timestamp" && !v.IsZero()
+	case string:
+		return v, typ == "string" && v != ""
+	case bool:
+		return v, typ == "boolean"
+	}
+	switch typ {
+	case "long":
+		return exporter.ToInt64(value)
+	case "double":
+		return exporter.ToFloat64(value)
+	}
+	return nil, false
+}
@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+var avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type Config struct {
+	// Brokers are the addresses of the seed brokers
+	Brokers []string
+	Topic   string
+	// Format is json (default) or avro
+	Format string
+	// SchemaRegistry is the URL of a Confluent compatible schema registry. The Avro schema
+	// is registered under the subject <Topic>-value and the records are prefixed with the
+	// schema ID. Without a registry the records are plain Avro binary.
+	SchemaRegistry         string
+	SchemaRegistryUsername string
+	SchemaRegistryPassword string
+	// SASLMechanism is plain, scram-sha-256 or scram-sha-512. SASL is disabled if empty.
+	SASLMechanism string
+	Username      string
+	Password      string
+	// UseTLS connects to the brokers with TLS. TLS is also used if any TLS option is set.
+	UseTLS bool
+	TLS    tlsconfig.Config
+	// Acks is the number of acknowledgements required for a write: all (default), leader
+	// or none
+	Acks string
+	// DisableIdempotence disables the idempotent producer, which is required if Acks is
+	// not all
+	DisableIdempotence bool
+	// Compression is the compression codec of record batches: none, gzip, snappy
+	// (default), lz4 or zstd
+	Compression string
+	// Linger is how long to wait for more records before sending a batch
+	Linger time.Duration
+	// BatchMaxBytes is the maximum size of a record batch. Defaults to 1 MB.
+	BatchMaxBytes int32
+	// Timeout is how long a record may take to be written before the export fails.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+	Columns map[string]string
+	Logger  *slog.Logger
+}
+
+func Validate(cfg Config) error {
+	if len(cfg.Brokers) == 0 {
+		return fmt.Errorf("at least one broker must be specified")
+	}
+	if cfg.Topic == "" {
+		return fmt.Errorf("topic must be specified")
+	}
+	if cfg.Columns["time"] == "" || cfg.Columns["mac"] == "" {
+		return fmt.Errorf("columns must include time and mac")
+	}
+	switch cfg.Format {
+	case "", FormatJSON:
+	case FormatAvro:
+		for _, column := range cfg.Columns {
+			if !avroName.MatchString(column) {
+				return fmt.Errorf("column name %s is not a valid Avro field name", column)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid format: %s", cfg.Format)
+	}
+	switch cfg.SASLMechanism {
+	case "", "plain", "scram-sha-256", "scram-sha-512":
+	default:
+		return fmt.Errorf("invalid SASL mechanism: %s", cfg.SASLMechanism)
+	}
+	switch cfg.Acks {
+	case "", "all":
+	case "leader", "none":
+		if !cfg.DisableIdempotence {
+			return fmt.Errorf("the idempotent producer requires acks to be all")
+		}
+	default:
+		return fmt.Errorf("invalid acks: %s", cfg.Acks)
+	}
+	switch cfg.Compression {
+	case "", "none", "gzip", "snappy", "lz4", "zstd":
+	default:
+		return fmt.Errorf("invalid compression: %s", cfg.Compression)
+	}
+	return tlsconfig.Validate(cfg.TLS)
+}
@@ -0,0 +1,173 @@
+//go:build kafka
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+type kafkaExporter struct {
+	cfg    Config
+	client *kgo.Client
+	avro   *avroEncoder
+	logger *slog.Logger
+}
+
+// New creates an exporter that produces the measurements to a Kafka topic as JSON or
+// Avro records keyed by the MAC address of the RuuviTag
+func New(cfg Config) (exporter.Exporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.DefaultProduceTopic(cfg.Topic),
+		kgo.ProducerBatchCompression(compression(cfg.Compression)),
+		kgo.RecordDeliveryTimeout(cfg.Timeout),
+	}
+	switch cfg.Acks {
+	case "leader":
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()))
+	case "none":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()))
+	default:
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+	if cfg.DisableIdempotence {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+	if cfg.Linger > 0 {
+		opts = append(opts, kgo.ProducerLinger(cfg.Linger))
+	}
+	if cfg.BatchMaxBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(cfg.BatchMaxBytes))
+	}
+	if cfg.UseTLS || cfg.TLS.Enabled() {
+		tlsConfig, err := tlsconfig.New(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+	if mechanism := saslMechanism(cfg); mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	e := &kafkaExporter{
+		cfg:    cfg,
+		logger: cfg.Logger.With("exporter", "Kafka"),
+	}
+	if cfg.Format == FormatAvro {
+		var err error
+		e.avro, err = newAvroEncoder(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	e.client = client
+	return e, nil
+}
+
+func compression(codec string) kgo.CompressionCodec {
+	switch codec {
+	case "none":
+		return kgo.NoCompression()
+	case "gzip":
+		return kgo.GzipCompression()
+	case "lz4":
+		return kgo.Lz4Compression()
+	case "zstd":
+		return kgo.ZstdCompression()
+	default:
+		return kgo.SnappyCompression()
+	}
+}
+
+func saslMechanism(cfg Config) sasl.Mechanism {
+	switch cfg.SASLMechanism {
+	case "plain":
+		return plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism()
+	case "scram-sha-256":
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha256Mechanism()
+	case "scram-sha-512":
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha512Mechanism()
+	default:
+		return nil
+	}
+}
+
+func (e *kafkaExporter) Name() string {
+	return fmt.Sprintf("Kafka (%s)", e.cfg.Topic)
+}
+
+func (e *kafkaExporter) Export(ctx context.Context, data sensor.Data) error {
+	return e.ExportBatch(ctx, []exporter.Measurement{{Data: data, Extra: exporter.ExtraColumns(ctx)}})
+}
+
+// ExportBatch produces the measurements and waits until all of them have been written.
+// The client batches the records by partition.
+func (e *kafkaExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	records := make([]*kgo.Record, 0, len(batch))
+	for _, m := range batch {
+		value, err := e.encode(m.Context(ctx), m.Data)
+		if err != nil {
+			return err
+		}
+		records = append(records, &kgo.Record{
+			// Records of a RuuviTag go to the same partition, which preserves their order
+			Key:   []byte(m.Data.Addr),
+			Value: value,
+			Headers: []kgo.RecordHeader{
+				{Key: "mac", Value: []byte(m.Data.Addr)},
+				{Key: "name", Value: []byte(m.Data.Name)},
+			},
+		})
+	}
+	err := e.client.ProduceSync(ctx, records...).FirstErr()
+	if errors.Is(err, kerr.MessageTooLarge) || errors.Is(err, kerr.InvalidRecord) {
+		return exporter.Permanent(err)
+	}
+	return err
+}
+
+func (e *kafkaExporter) encode(ctx context.Context, data sensor.Data) ([]byte, error) {
+	if e.avro != nil {
+		return e.avro.encode(ctx, data)
+	}
+	value, err := json.Marshal(exporter.Transform(ctx, e.cfg.Columns, data))
+	if err != nil {
+		return nil, exporter.Permanent(err)
+	}
+	return value, nil
+}
+
+func (e *kafkaExporter) Close() error {
+	e.client.Close()
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !kafka
+
+package kafka
+
+import (
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+func New(cfg Config) (exporter.Exporter, error) {
+	return exporter.NoOp{ReportedName: "Kafka"}, nil
+}
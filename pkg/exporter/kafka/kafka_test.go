@@ -0,0 +1,192 @@
+//go:build kafka
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
+)
+
+const topic = "ruuvitag"
+
+func newCluster(t *testing.T, opts ...kfake.Opt) *kfake.Cluster {
+	t.Helper()
+	c, err := kfake.NewCluster(append(opts, kfake.NumBrokers(1), kfake.SeedTopics(3, topic))...)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+// consume reads n records from the topic
+func consume(t *testing.T, c *kfake.Cluster, n int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(c.ListenAddrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		require.NoError(t, ctx.Err())
+		records = append(records, fetches.Records()...)
+	}
+	return records
+}
+
+func header(r *kgo.Record, key string) string {
+	for _, h := range r.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestExportJSON(t *testing.T) {
+	c := newCluster(t)
+	columns := map[string]string{"time": "time", "mac": "mac", "name": "name"}
+	exp, err := New(Config{Brokers: c.ListenAddrs(), Topic: topic, Compression: "zstd", Columns: columns})
+	require.NoError(t, err)
+	defer exp.Close()
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, exp.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Timestamp: ts}))
+	require.NoError(t, exp.(exporter.BatchExporter).ExportBatch(context.Background(), []exporter.Measurement{
+		{Data: sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Timestamp: ts}},
+		{Data: sensor.Data{Addr: "FB:E1:B7:04:95:EE", Name: "Sauna", Timestamp: ts}},
+	}))
+
+	records := consume(t, c, 3)
+	partitions := make(map[string]int32)
+	for _, r := range records {
+		mac := string(r.Key)
+		assert.Equal(t, mac, header(r, "mac"))
+		if p, ok := partitions[mac]; ok {
+			assert.Equal(t, p, r.Partition, "records of a RuuviTag must be in the same partition")
+		}
+		partitions[mac] = r.Partition
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal(r.Value, &payload))
+		assert.Equal(t, mac, payload["mac"])
+		assert.Equal(t, header(r, "name"), payload["name"])
+		assert.Equal(t, "2024-05-01T12:00:00Z", payload["time"])
+	}
+	assert.Len(t, partitions, 2)
+}
+
+func TestExportAvro(t *testing.T) {
+	var registered map[string]any
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/subjects/ruuvitag-value/versions" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &registered)
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		_, _ = w.Write([]byte(`{"id":7}`))
+	}))
+	defer registry.Close()
+
+	c := newCluster(t)
+	columns := map[string]string{
+		"time":                     "time",
+		"mac":                      "mac",
+		"name":                     "name",
+		"temperature":              "temperature",
+		"movement_counter":         "movement_counter",
+		processor.BatteryLowColumn: "battery_low",
+	}
+	e, err := New(Config{Brokers: c.ListenAddrs(), Topic: topic, Format: FormatAvro, SchemaRegistry: registry.URL, Columns: columns})
+	require.NoError(t, err)
+	defer e.Close()
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ctx := exporter.WithExtraColumns(context.Background(), map[string]any{processor.BatteryLowColumn: true})
+	require.NoError(t, e.Export(ctx, sensor.Data{
+		Addr:            "CC:CA:7E:52:CC:34",
+		Name:            "Backyard",
+		Temperature:     21.5,
+		MovementCounter: 42,
+		Timestamp:       ts,
+	}))
+	require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Timestamp: ts}))
+	assert.Contains(t, registered["schema"], `"logicalType":"timestamp-millis"`)
+
+	records := consume(t, c, 2)
+	schema := e.(*kafkaExporter).avro.schema
+	// The Confluent wire format header is a zero byte followed by the schema ID
+	require.Equal(t, []byte{0, 0, 0, 0, 7}, records[0].Value[:5])
+	var record map[string]any
+	require.NoError(t, avro.Unmarshal(schema, records[0].Value[5:], &record))
+	assert.True(t, ts.Equal(record["time"].(time.Time)))
+	assert.Equal(t, "CC:CA:7E:52:CC:34", record["mac"])
+	assert.Equal(t, "Backyard", record["name"])
+	assert.Equal(t, 21.5, record["temperature"])
+	assert.Equal(t, int64(42), record["movement_counter"])
+	assert.Equal(t, true, record["battery_low"])
+
+	record = nil
+	require.NoError(t, avro.Unmarshal(schema, records[1].Value[5:], &record))
+	assert.Nil(t, record["name"])
+	assert.Nil(t, record["battery_low"])
+}
+
+func TestSASL(t *testing.T) {
+	c := newCluster(t, kfake.EnableSASL(), kfake.Superuser("PLAIN", "ruuvi", "secret"))
+	columns := map[string]string{"time": "time", "mac": "mac"}
+	data := sensor.Data{Addr: "CC:CA:7E:52:CC:34", Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	exp, err := New(Config{Brokers: c.ListenAddrs(), Topic: topic, SASLMechanism: "plain", Username: "ruuvi", Password: "secret", Columns: columns})
+	require.NoError(t, err)
+	require.NoError(t, exp.Export(context.Background(), data))
+	require.NoError(t, exp.Close())
+
+	exp, err = New(Config{Brokers: c.ListenAddrs(), Topic: topic, SASLMechanism: "plain", Username: "ruuvi", Password: "wrong", Timeout: time.Second, Columns: columns})
+	require.NoError(t, err)
+	assert.Error(t, exp.Export(context.Background(), data))
+	require.NoError(t, exp.Close())
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Config{Brokers: []string{"localhost:9092"}, Topic: topic, Columns: map[string]string{"time": "time", "mac": "mac"}}
+	assert.NoError(t, Validate(cfg))
+	invalid := []func(cfg *Config){
+		func(cfg *Config) { cfg.Brokers = nil },
+		func(cfg *Config) { cfg.Topic = "" },
+		func(cfg *Config) { cfg.Format = "xml" },
+		func(cfg *Config) { cfg.Acks = "leader" },
+		func(cfg *Config) { cfg.Compression = "brotli" },
+		func(cfg *Config) { cfg.SASLMechanism = "gssapi" },
+		func(cfg *Config) {
+			cfg.Format = FormatAvro
+			cfg.Columns = map[string]string{"time": "time", "mac": "mac", "dew_point": "dew-point"}
+		},
+	}
+	for _, modify := range invalid {
+		c := cfg
+		modify(&c)
+		assert.Error(t, Validate(c))
+	}
+	cfg.Acks = "leader"
+	cfg.DisableIdempotence = true
+	assert.NoError(t, Validate(cfg))
+}
@@ -1,7 +1,11 @@
 package mqtt
 
 import (
+	"fmt"
+	"log/slog"
 	"time"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
 )
 
 type Config struct {
@@ -9,7 +13,53 @@ type Config struct {
 	ClientId          string
 	Username          string
 	Password          string
-	CaFile            string
+	TLS               tlsconfig.Config
 	AutoReconnect     bool
 	ReconnectInterval time.Duration
+	// Topic is a text/template of the topic of the measurements, executed with TopicData.
+	// Defaults to DefaultTopic.
+	Topic string
+	// QoS is the quality of service level of the measurements: 0, 1 or 2
+	QoS byte
+	// Retain sets the retain flag of the measurements
+	Retain bool
+	// PerField publishes each column of a measurement as a plain value to its own
+	// subtopic <topic>/<column> instead of publishing a single JSON message
+	PerField bool
+	// StatusTopic is the topic of the retained birth message published on connect and of
+	// the last will published by the broker when the connection is lost. Defaults to
+	// DefaultStatusTopic with Home Assistant discovery, otherwise no birth or last will
+	// messages are sent.
+	StatusTopic string
+	// BirthPayload is the payload of the birth message. Defaults to online.
+	BirthPayload string
+	// WillPayload is the payload of the last will. Defaults to offline.
+	WillPayload string
+	// HomeAssistant publishes retained Home Assistant MQTT discovery messages for each
+	// RuuviTag and tracks their availability
+	HomeAssistant bool
+	// DiscoveryPrefix is the Home Assistant discovery topic prefix. Defaults to
+	// DefaultDiscoveryPrefix.
+	DiscoveryPrefix string
+	// AvailabilityTimeout is how long after its last measurement a RuuviTag is marked
+	// unavailable in Home Assistant. Defaults to 5 minutes.
+	AvailabilityTimeout time.Duration
+	// Units overrides the units of measurement announced to Home Assistant by column,
+	// for example when the values are converted to other units
+	Units   map[string]string
+	Columns map[string]string
+	Logger  *slog.Logger
+}
+
+func Validate(cfg Config) error {
+	if cfg.Addr == "" {
+		return fmt.Errorf("MQTT broker address must be specified")
+	}
+	if cfg.QoS > 2 {
+		return fmt.Errorf("invalid QoS: %d", cfg.QoS)
+	}
+	if _, err := parseTopic(cfg.Topic); err != nil {
+		return fmt.Errorf("invalid topic template: %w", err)
+	}
+	return tlsconfig.Validate(cfg.TLS)
 }
@@ -0,0 +1,199 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// DefaultDiscoveryPrefix is the default topic prefix of Home Assistant MQTT discovery
+const DefaultDiscoveryPrefix = "homeassistant"
+
+// DefaultStatusTopic is the default topic of the birth and last will messages with Home
+// Assistant discovery
+const DefaultStatusTopic = "ruuvitag-gollector/status"
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+)
+
+// entity describes how a measurement field is presented in Home Assistant
+type entity struct {
+	name        string
+	deviceClass string
+	unit        string
+	stateClass  string
+	category    string
+}
+
+var entities = map[string]entity{
+	"temperature":        {name: "Temperature", deviceClass: "temperature", unit: "°C", stateClass: "measurement"},
+	"humidity":           {name: "Humidity", deviceClass: "humidity", unit: "%", stateClass: "measurement"},
+	"pressure":           {name: "Pressure", deviceClass: "atmospheric_pressure", unit: "hPa", stateClass: "measurement"},
+	"dew_point":          {name: "Dew point", deviceClass: "temperature", unit: "°C", stateClass: "measurement"},
+	"wet_bulb":           {name: "Wet bulb temperature", deviceClass: "temperature", unit: "°C", stateClass: "measurement"},
+	"acceleration_x":     {name: "Acceleration X", unit: "mG", stateClass: "measurement", category: "diagnostic"},
+	"acceleration_y":     {name: "Acceleration Y", unit: "mG", stateClass: "measurement", category: "diagnostic"},
+	"acceleration_z":     {name: "Acceleration Z", unit: "mG", stateClass: "measurement", category: "diagnostic"},
+	"movement_counter":   {name: "Movement counter", stateClass: "total_increasing"},
+	"measurement_number": {name: "Measurement number", stateClass: "total_increasing", category: "diagnostic"},
+	"battery_voltage":    {name: "Battery voltage", deviceClass: "voltage", unit: "V", stateClass: "measurement", category: "diagnostic"},
+	"tx_power":           {name: "Transmit power", deviceClass: "signal_strength", unit: "dBm", stateClass: "measurement", category: "diagnostic"},
+}
+
+func deviceID(data sensor.Data) string {
+	return "ruuvitag_" + strings.ToLower(strings.ReplaceAll(data.Addr, ":", ""))
+}
+
+type discoveryDevice struct {
+	Identifiers  []string   `json:"identifiers"`
+	Connections  [][]string `json:"connections"`
+	Name         string     `json:"name"`
+	Manufacturer string     `json:"manufacturer"`
+	Model        string     `json:"model"`
+}
+
+type discoveryAvailability struct {
+	Topic               string `json:"topic"`
+	PayloadAvailable    string `json:"payload_available,omitempty"`
+	PayloadNotAvailable string `json:"payload_not_available,omitempty"`
+}
+
+type discoveryConfig struct {
+	Name              string                  `json:"name"`
+	UniqueID          string                  `json:"unique_id"`
+	StateTopic        string                  `json:"state_topic"`
+	ValueTemplate     string                  `json:"value_template,omitempty"`
+	DeviceClass       string                  `json:"device_class,omitempty"`
+	UnitOfMeasurement string                  `json:"unit_of_measurement,omitempty"`
+	StateClass        string                  `json:"state_class,omitempty"`
+	EntityCategory    string                  `json:"entity_category,omitempty"`
+	Availability      []discoveryAvailability `json:"availability"`
+	AvailabilityMode  string                  `json:"availability_mode"`
+	Device            discoveryDevice         `json:"device"`
+	Origin            map[string]string       `json:"origin"`
+}
+
+// discoveryMessages returns the retained discovery config messages of the sensor
+// entities of the RuuviTag, one for each field in the column map. Topic is the topic of
+// the measurements of the RuuviTag.
+func discoveryMessages(cfg Config, topic string, data sensor.Data) ([]message, error) {
+	id := deviceID(data)
+	name := data.Name
+	if name == "" {
+		name = "RuuviTag " + data.Addr
+	}
+	device := discoveryDevice{
+		Identifiers:  []string{id},
+		Connections:  [][]string{{"mac", strings.ToLower(data.Addr)}},
+		Name:         name,
+		Manufacturer: "Ruuvi Innovations",
+		Model:        "RuuviTag",
+	}
+	var messages []message
+	for _, field := range exporter.ColumnOrder(cfg.Columns) {
+		e, ok := entities[field]
+		if !ok {
+			continue
+		}
+		if unit, ok := cfg.Units[field]; ok {
+			e.unit = unit
+		}
+		column := cfg.Columns[field]
+		state := topic
+		valueTemplate := fmt.Sprintf("{{ value_json['%s'] }}", column)
+		if cfg.PerField {
+			state = topic + "/" + column
+			valueTemplate = ""
+		}
+		payload, err := json.Marshal(discoveryConfig{
+			Name:              e.name,
+			UniqueID:          id + "_" + field,
+			StateTopic:        state,
+			ValueTemplate:     valueTemplate,
+			DeviceClass:       e.deviceClass,
+			UnitOfMeasurement: e.unit,
+			StateClass:        e.stateClass,
+			EntityCategory:    e.category,
+			Availability: []discoveryAvailability{
+				{Topic: cfg.StatusTopic, PayloadAvailable: cfg.BirthPayload, PayloadNotAvailable: cfg.WillPayload},
+				{Topic: availabilityTopic(topic)},
+			},
+			AvailabilityMode: "all",
+			Device:           device,
+			Origin:           map[string]string{"name": "ruuvitag-gollector"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message{
+			topic:    fmt.Sprintf("%s/sensor/%s/%s/config", cfg.DiscoveryPrefix, id, field),
+			payload:  payload,
+			qos:      1,
+			retained: true,
+		})
+	}
+	return messages, nil
+}
+
+// tagState is the last seen state of a RuuviTag
+type tagState struct {
+	data     sensor.Data
+	lastSeen time.Time
+	online   bool
+}
+
+// availability tracks when each RuuviTag was last seen
+type availability struct {
+	timeout time.Duration
+	tags    map[string]*tagState
+}
+
+func newAvailability(timeout time.Duration) *availability {
+	return &availability{
+		timeout: timeout,
+		tags:    make(map[string]*tagState),
+	}
+}
+
+// changes returns whether discovery messages need to be published for a measurement of
+// a RuuviTag because the RuuviTag is new or has been renamed, and whether it becomes
+// available
+func (a *availability) changes(data sensor.Data) (discover, online bool) {
+	t, ok := a.tags[data.Addr]
+	discover = !ok || t.data.Name != data.Name
+	online = discover || !t.online
+	return
+}
+
+// seen records a measurement of a RuuviTag after its discovery and availability messages
+// have been published
+func (a *availability) seen(data sensor.Data, now time.Time) {
+	t, ok := a.tags[data.Addr]
+	if !ok {
+		t = &tagState{}
+		a.tags[data.Addr] = t
+	}
+	t.data = data
+	t.lastSeen = now
+	t.online = true
+}
+
+// expired marks the RuuviTags that have not been seen within the timeout unavailable
+// and returns them
+func (a *availability) expired(now time.Time) []sensor.Data {
+	var expired []sensor.Data
+	for _, t := range a.tags {
+		if t.online && now.Sub(t.lastSeen) >= a.timeout {
+			t.online = false
+			expired = append(expired, t.data)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,118 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+var testData = sensor.Data{
+	Addr:        "CC:CA:7E:52:CC:34",
+	Name:        "Backyard",
+	Temperature: 21.5,
+	Timestamp:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestDiscoveryMessages(t *testing.T) {
+	columns := map[string]string{
+		"time":            "time",
+		"mac":             "mac",
+		"name":            "name",
+		"temperature":     "temperature",
+		"pressure":        "pressure",
+		"battery_voltage": "battery",
+		"tilt_x":          "tilt_x",
+	}
+	cfg := Config{
+		DiscoveryPrefix: DefaultDiscoveryPrefix,
+		StatusTopic:     DefaultStatusTopic,
+		BirthPayload:    "up",
+		WillPayload:     "down",
+		Units:           map[string]string{"pressure": "kPa"},
+		Columns:         columns,
+	}
+	messages, err := discoveryMessages(cfg, "ruuvitag-gollector/Backyard/CCCA7E52CC34", testData)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "homeassistant/sensor/ruuvitag_ccca7e52cc34/temperature/config", messages[0].topic)
+	assert.Equal(t, "homeassistant/sensor/ruuvitag_ccca7e52cc34/pressure/config", messages[1].topic)
+	assert.Equal(t, "homeassistant/sensor/ruuvitag_ccca7e52cc34/battery_voltage/config", messages[2].topic)
+	for _, msg := range messages {
+		assert.True(t, msg.retained)
+	}
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(messages[0].payload, &payload))
+	assert.Equal(t, "Temperature", payload["name"])
+	assert.Equal(t, "ruuvitag_ccca7e52cc34_temperature", payload["unique_id"])
+	assert.Equal(t, "ruuvitag-gollector/Backyard/CCCA7E52CC34", payload["state_topic"])
+	assert.Equal(t, "{{ value_json['temperature'] }}", payload["value_template"])
+	assert.Equal(t, "temperature", payload["device_class"])
+	assert.Equal(t, "°C", payload["unit_of_measurement"])
+	assert.Equal(t, "measurement", payload["state_class"])
+	assert.NotContains(t, payload, "entity_category")
+	assert.Equal(t, []any{
+		map[string]any{"topic": "ruuvitag-gollector/status", "payload_available": "up", "payload_not_available": "down"},
+		map[string]any{"topic": "ruuvitag-gollector/Backyard/CCCA7E52CC34/availability"},
+	}, payload["availability"])
+	assert.Equal(t, "all", payload["availability_mode"])
+	device := payload["device"].(map[string]any)
+	assert.Equal(t, "Backyard", device["name"])
+	assert.Equal(t, []any{"ruuvitag_ccca7e52cc34"}, device["identifiers"])
+	assert.Equal(t, []any{[]any{"mac", "cc:ca:7e:52:cc:34"}}, device["connections"])
+
+	require.NoError(t, json.Unmarshal(messages[1].payload, &payload))
+	assert.Equal(t, "kPa", payload["unit_of_measurement"])
+	require.NoError(t, json.Unmarshal(messages[2].payload, &payload))
+	assert.Equal(t, "diagnostic", payload["entity_category"])
+	assert.Equal(t, "{{ value_json['battery'] }}", payload["value_template"])
+
+	// With per-field publishing each entity has its own state topic
+	cfg.PerField = true
+	messages, err = discoveryMessages(cfg, "ruuvitag-gollector/Backyard/CCCA7E52CC34", testData)
+	require.NoError(t, err)
+	payload = nil
+	require.NoError(t, json.Unmarshal(messages[2].payload, &payload))
+	assert.Equal(t, "ruuvitag-gollector/Backyard/CCCA7E52CC34/battery", payload["state_topic"])
+	assert.NotContains(t, payload, "value_template")
+}
+
+func TestAvailability(t *testing.T) {
+	start := testData.Timestamp
+	a := newAvailability(5 * time.Minute)
+
+	discover, online := a.changes(testData)
+	assert.True(t, discover)
+	assert.True(t, online)
+	// Nothing changes until the messages have been published and the RuuviTag is seen
+	discover, online = a.changes(testData)
+	assert.True(t, discover)
+	assert.True(t, online)
+	a.seen(testData, start)
+	a.seen(testData, start.Add(time.Minute))
+	discover, online = a.changes(testData)
+	assert.False(t, discover)
+	assert.False(t, online)
+
+	assert.Empty(t, a.expired(start.Add(5*time.Minute)))
+	assert.Equal(t, []sensor.Data{testData}, a.expired(start.Add(6*time.Minute)))
+	assert.Empty(t, a.expired(start.Add(7*time.Minute)))
+
+	// A RuuviTag that reports again becomes available without being announced again
+	discover, online = a.changes(testData)
+	assert.False(t, discover)
+	assert.True(t, online)
+	a.seen(testData, start.Add(8*time.Minute))
+
+	// A renamed RuuviTag is announced again since its state topic changes
+	renamed := testData
+	renamed.Name = "Garden"
+	discover, online = a.changes(renamed)
+	assert.True(t, discover)
+	assert.True(t, online)
+}
@@ -3,28 +3,65 @@
 package mqtt
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"strings"
+	"io"
+	"log/slog"
+	"sync"
+	"text/template"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
 
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
 )
 
 type mqttExporter struct {
-	client    mqtt.Client
-	tlsConfig *tls.Config
+	cfg    Config
+	client mqtt.Client
+	topic  *template.Template
+	logger *slog.Logger
+	now    func() time.Time
+	mu     sync.Mutex
+	avail  *availability
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 func New(cfg Config) (exporter.Exporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	topic, err := parseTopic(cfg.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HomeAssistant {
+		if cfg.StatusTopic == "" {
+			cfg.StatusTopic = DefaultStatusTopic
+		}
+		if cfg.DiscoveryPrefix == "" {
+			cfg.DiscoveryPrefix = DefaultDiscoveryPrefix
+		}
+	}
+	if cfg.BirthPayload == "" {
+		cfg.BirthPayload = payloadOnline
+	}
+	if cfg.WillPayload == "" {
+		cfg.WillPayload = payloadOffline
+	}
+	if cfg.AvailabilityTimeout <= 0 {
+		cfg.AvailabilityTimeout = 5 * time.Minute
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Addr)
 	opts.SetClientID(cfg.ClientId)
@@ -34,57 +71,176 @@ func New(cfg Config) (exporter.Exporter, error) {
 	}
 	opts.SetAutoReconnect(cfg.AutoReconnect)
 	opts.SetMaxReconnectInterval(cfg.ReconnectInterval)
-	tlsConfig, err := newTlsConfig(cfg)
-	if err != nil {
-		return nil, err
-	}
-	if tlsConfig != nil {
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := tlsconfig.New(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
 		opts.SetTLSConfig(tlsConfig)
 	}
+	if cfg.StatusTopic != "" {
+		opts.SetWill(cfg.StatusTopic, cfg.WillPayload, 1, true)
+		opts.SetOnConnectHandler(func(client mqtt.Client) {
+			// Published asynchronously since the handler must not block
+			client.Publish(cfg.StatusTopic, 1, true, cfg.BirthPayload)
+		})
+	}
 	client := mqtt.NewClient(opts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
 		return nil, token.Error()
 	}
-	return &mqttExporter{
-		client:    client,
-		tlsConfig: tlsConfig,
-	}, nil
+	m := &mqttExporter{
+		cfg:    cfg,
+		client: client,
+		topic:  topic,
+		logger: cfg.Logger,
+		now:    time.Now,
+	}
+	if cfg.HomeAssistant {
+		m.avail = newAvailability(cfg.AvailabilityTimeout)
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
+		m.wg.Add(1)
+		go m.run(ctx)
+	}
+	return m, nil
+}
+
+func (m *mqttExporter) Name() string {
+	return fmt.Sprintf("MQTT")
 }
 
-func newTlsConfig(cfg Config) (*tls.Config, error) {
-	if cfg.CaFile != "" {
-		certpool := x509.NewCertPool()
-		ca, err := ioutil.ReadFile(cfg.CaFile)
+func (m *mqttExporter) Export(ctx context.Context, data sensor.Data) error {
+	topic, err := executeTopic(m.topic, data)
+	if err != nil {
+		return err
+	}
+	if m.avail != nil {
+		if err := m.announce(data, topic); err != nil {
+			return err
+		}
+	}
+	fields := exporter.Transform(ctx, m.cfg.Columns, data)
+	if !m.cfg.PerField {
+		payload, err := json.Marshal(fields)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		certpool.AppendCertsFromPEM(ca)
-		return &tls.Config{
-			RootCAs: certpool,
-		}, nil
+		return m.publish(message{topic: topic, payload: payload, qos: m.cfg.QoS, retained: m.cfg.Retain})
 	}
-	return nil, nil
-}
-
-func (m mqttExporter) Name() string {
-	return fmt.Sprintf("MQTT")
+	var messages []message
+	for _, key := range exporter.ColumnOrder(m.cfg.Columns) {
+		column := m.cfg.Columns[key]
+		value, ok := fields[column]
+		if !ok {
+			continue
+		}
+		messages = append(messages, message{
+			topic:    topic + "/" + column,
+			payload:  []byte(exporter.FormatValue(value)),
+			qos:      m.cfg.QoS,
+			retained: m.cfg.Retain,
+		})
+	}
+	return m.publish(messages...)
 }
 
-func (m mqttExporter) Export(ctx context.Context, data sensor.Data) error {
-	buf := new(bytes.Buffer)
-	enc := json.NewEncoder(buf)
-	err := enc.Encode(data)
+// ExportEvent publishes the event as JSON to the events subtopic of the RuuviTag
+func (m *mqttExporter) ExportEvent(ctx context.Context, ev event.Event) error {
+	topic, err := executeTopic(m.topic, sensor.Data{Addr: ev.Addr, Name: ev.Name})
 	if err != nil {
 		return err
 	}
-	mac := strings.Replace(data.Addr, ":", "", -1)
-	topic := fmt.Sprintf("ruuvitag-gollector/%s/%s", data.Name, mac)
-	token := m.client.Publish(topic, 0, false, buf.String())
-	token.Wait()
-	return token.Error()
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return m.publish(message{topic: eventTopic(topic), payload: payload, qos: m.cfg.QoS})
 }
 
-func (m mqttExporter) Close() error {
-	m.client.Disconnect(0)
+// announce publishes the Home Assistant discovery messages of a new or renamed RuuviTag
+// and marks the RuuviTag available. The RuuviTag is recorded as seen only after the
+// messages have been published so that they are published again if publishing fails.
+func (m *mqttExporter) announce(data sensor.Data, topic string) error {
+	m.mu.Lock()
+	discover, online := m.avail.changes(data)
+	m.mu.Unlock()
+	var messages []message
+	if discover {
+		discovery, err := discoveryMessages(m.cfg, topic, data)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, discovery...)
+	}
+	if online {
+		messages = append(messages, message{topic: availabilityTopic(topic), payload: []byte(payloadOnline), qos: 1, retained: true})
+	}
+	if err := m.publish(messages...); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.avail.seen(data, m.now())
+	m.mu.Unlock()
 	return nil
 }
+
+// publish publishes the messages and waits until all of them have been sent
+func (m *mqttExporter) publish(messages ...message) error {
+	tokens := make([]mqtt.Token, len(messages))
+	for i, msg := range messages {
+		tokens[i] = m.client.Publish(msg.topic, msg.qos, msg.retained, msg.payload)
+	}
+	var errs []error
+	for _, token := range tokens {
+		token.Wait()
+		errs = append(errs, token.Error())
+	}
+	return errors.Join(errs...)
+}
+
+func (m *mqttExporter) run(ctx context.Context) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(min(m.cfg.AvailabilityTimeout, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.expire(ctx)
+	}
+}
+
+// expire marks the RuuviTags that have not been seen within the availability timeout
+// unavailable
+func (m *mqttExporter) expire(ctx context.Context) {
+	m.mu.Lock()
+	expired := m.avail.expired(m.now())
+	m.mu.Unlock()
+	for _, data := range expired {
+		m.logger.LogAttrs(ctx, slog.LevelInfo, "RuuviTag is unavailable", slog.String("mac", data.Addr), slog.String("name", data.Name))
+		topic, err := executeTopic(m.topic, data)
+		if err == nil {
+			err = m.publish(message{topic: availabilityTopic(topic), payload: []byte(payloadOffline), qos: 1, retained: true})
+		}
+		if err != nil {
+			m.logger.LogAttrs(ctx, slog.LevelError, "Failed to publish availability", slog.String("mac", data.Addr), slog.Any("error", err))
+		}
+	}
+}
+
+func (m *mqttExporter) Close() error {
+	if m.avail != nil {
+		m.cancel()
+		m.wg.Wait()
+	}
+	var err error
+	if m.cfg.StatusTopic != "" {
+		// Published explicitly because the last will is only sent on an unexpected disconnect
+		err = m.publish(message{topic: m.cfg.StatusTopic, payload: []byte(m.cfg.WillPayload), qos: 1, retained: true})
+	}
+	m.client.Disconnect(250)
+	return err
+}
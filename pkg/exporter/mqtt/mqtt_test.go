@@ -0,0 +1,271 @@
+//go:build mqtt
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+)
+
+var columns = map[string]string{
+	"time":             "time",
+	"mac":              "mac",
+	"name":             "name",
+	"temperature":      "temp",
+	"movement_counter": "movement_counter",
+}
+
+type received struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+}
+
+// broker is an in-process MQTT broker that records the messages published to it
+type broker struct {
+	*server.Server
+	addr     string
+	mu       sync.Mutex
+	messages []received
+}
+
+func newBroker(t *testing.T) *broker {
+	t.Helper()
+	b := &broker{Server: server.New(&server.Options{InlineClient: true})}
+	require.NoError(t, b.AddHook(new(auth.AllowHook), nil))
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	require.NoError(t, b.AddListener(tcp))
+	require.NoError(t, b.Serve())
+	b.addr = "tcp://" + tcp.Address()
+	t.Cleanup(func() { _ = b.Close() })
+	err := b.Subscribe("#", 1, func(cl *server.Client, sub packets.Subscription, pk packets.Packet) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.messages = append(b.messages, received{
+			topic:   pk.TopicName,
+			payload: string(pk.Payload),
+			qos:     pk.FixedHeader.Qos,
+			retain:  pk.FixedHeader.Retain,
+		})
+	})
+	require.NoError(t, err)
+	return b
+}
+
+// wait waits until a message has been published to the topic and returns the last one
+func (b *broker) wait(t *testing.T, topic string) received {
+	t.Helper()
+	var msg received
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i := len(b.messages) - 1; i >= 0; i-- {
+			if b.messages[i].topic == topic {
+				msg = b.messages[i]
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "no message on %s", topic)
+	return msg
+}
+
+func (b *broker) topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var topics []string
+	for _, msg := range b.messages {
+		topics = append(topics, msg.topic)
+	}
+	return topics
+}
+
+var testMeasurement = sensor.Data{
+	Addr:            "CC:CA:7E:52:CC:34",
+	Name:            "Backyard",
+	Temperature:     21.5,
+	MovementCounter: 42,
+	Timestamp:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func newTestExporter(t *testing.T, b *broker, cfg Config) *mqttExporter {
+	t.Helper()
+	cfg.Addr = b.addr
+	cfg.ClientId = "ruuvitag-gollector"
+	cfg.Columns = columns
+	exp, err := New(cfg)
+	require.NoError(t, err)
+	return exp.(*mqttExporter)
+}
+
+func TestExport(t *testing.T) {
+	b := newBroker(t)
+	exp := newTestExporter(t, b, Config{})
+	require.NoError(t, exp.Export(context.Background(), testMeasurement))
+	require.NoError(t, exp.Close())
+
+	msg := b.wait(t, "ruuvitag-gollector/Backyard/CCCA7E52CC34")
+	assert.Equal(t, byte(0), msg.qos)
+	assert.False(t, msg.retain)
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal([]byte(msg.payload), &payload))
+	assert.Equal(t, map[string]any{
+		"time":             "2024-05-01T12:00:00Z",
+		"mac":              "CC:CA:7E:52:CC:34",
+		"name":             "Backyard",
+		"temp":             21.5,
+		"movement_counter": float64(42),
+	}, payload)
+}
+
+func TestTopicTemplateQoSAndRetain(t *testing.T) {
+	b := newBroker(t)
+	exp := newTestExporter(t, b, Config{Topic: "sensors/{{.MAC}}", QoS: 1, Retain: true})
+	require.NoError(t, exp.Export(context.Background(), testMeasurement))
+	require.NoError(t, exp.Close())
+
+	msg := b.wait(t, "sensors/CCCA7E52CC34")
+	assert.Equal(t, byte(1), msg.qos)
+	assert.True(t, msg.retain)
+	assert.Len(t, b.Topics.Messages("sensors/CCCA7E52CC34"), 1)
+}
+
+func TestPerField(t *testing.T) {
+	b := newBroker(t)
+	exp := newTestExporter(t, b, Config{Topic: "ruuvitag/{{.Name}}", PerField: true})
+	require.NoError(t, exp.Export(context.Background(), testMeasurement))
+	require.NoError(t, exp.Close())
+
+	assert.Equal(t, "2024-05-01T12:00:00Z", b.wait(t, "ruuvitag/Backyard/time").payload)
+	assert.Equal(t, "CC:CA:7E:52:CC:34", b.wait(t, "ruuvitag/Backyard/mac").payload)
+	assert.Equal(t, "21.5", b.wait(t, "ruuvitag/Backyard/temp").payload)
+	assert.Equal(t, "42", b.wait(t, "ruuvitag/Backyard/movement_counter").payload)
+	assert.NotContains(t, b.topics(), "ruuvitag/Backyard")
+}
+
+func TestExportEvent(t *testing.T) {
+	b := newBroker(t)
+	exp := newTestExporter(t, b, Config{QoS: 1, Retain: true})
+	require.NoError(t, exp.ExportEvent(context.Background(), event.Event{
+		Type:       event.Movement,
+		Addr:       testMeasurement.Addr,
+		Name:       testMeasurement.Name,
+		Timestamp:  testMeasurement.Timestamp,
+		Attributes: map[string]any{"movement_counter": 42},
+	}))
+	require.NoError(t, exp.Close())
+
+	msg := b.wait(t, "ruuvitag-gollector/Backyard/CCCA7E52CC34/events")
+	assert.Equal(t, byte(1), msg.qos)
+	// Events are not retained even if the measurements are
+	assert.False(t, msg.retain)
+	assert.JSONEq(t, `{"type":"movement","mac":"CC:CA:7E:52:CC:34","name":"Backyard","time":"2024-05-01T12:00:00Z","attributes":{"movement_counter":42}}`, msg.payload)
+}
+
+func TestBirthAndLastWill(t *testing.T) {
+	b := newBroker(t)
+	exp := newTestExporter(t, b, Config{StatusTopic: "gateway/status", BirthPayload: "up", WillPayload: "down"})
+	msg := b.wait(t, "gateway/status")
+	assert.Equal(t, "up", msg.payload)
+	assert.True(t, msg.retain)
+
+	// The broker publishes the last will when the connection is lost
+	cl, ok := b.Clients.Get("ruuvitag-gollector")
+	require.True(t, ok)
+	cl.Stop(errors.New("connection lost"))
+	require.Eventually(t, func() bool {
+		return b.wait(t, "gateway/status").payload == "down"
+	}, 5*time.Second, 10*time.Millisecond)
+	exp.client.Disconnect(0)
+}
+
+func TestHomeAssistant(t *testing.T) {
+	b := newBroker(t)
+	exp := newTestExporter(t, b, Config{HomeAssistant: true, AvailabilityTimeout: time.Minute})
+	now := testMeasurement.Timestamp
+	exp.now = func() time.Time { return now }
+	require.NoError(t, exp.Export(context.Background(), testMeasurement))
+
+	assert.Equal(t, "online", b.wait(t, "ruuvitag-gollector/status").payload)
+	discovery := b.wait(t, "homeassistant/sensor/ruuvitag_ccca7e52cc34/temperature/config")
+	assert.True(t, discovery.retain)
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal([]byte(discovery.payload), &payload))
+	assert.Equal(t, "{{ value_json['temp'] }}", payload["value_template"])
+	b.wait(t, "homeassistant/sensor/ruuvitag_ccca7e52cc34/movement_counter/config")
+	assert.Equal(t, "online", b.wait(t, "ruuvitag-gollector/Backyard/CCCA7E52CC34/availability").payload)
+
+	now = now.Add(time.Minute)
+	exp.expire(context.Background())
+	assert.Equal(t, "offline", b.wait(t, "ruuvitag-gollector/Backyard/CCCA7E52CC34/availability").payload)
+
+	require.NoError(t, exp.Close())
+	assert.Equal(t, "offline", b.wait(t, "ruuvitag-gollector/status").payload)
+}
+
+// failingClient fails the publishes until fail is set to false
+type failingClient struct {
+	mqtt.Client
+	fail bool
+}
+
+func (c *failingClient) Publish(topic string, qos byte, retained bool, payload any) mqtt.Token {
+	if c.fail {
+		return errorToken{err: errors.New("not connected")}
+	}
+	return c.Client.Publish(topic, qos, retained, payload)
+}
+
+type errorToken struct {
+	err error
+}
+
+func (t errorToken) Wait() bool {
+	return true
+}
+
+func (t errorToken) WaitTimeout(time.Duration) bool {
+	return true
+}
+
+func (t errorToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (t errorToken) Error() error {
+	return t.err
+}
+
+func TestHomeAssistantPublishFailure(t *testing.T) {
+	b := newBroker(t)
+	exp := newTestExporter(t, b, Config{HomeAssistant: true, AvailabilityTimeout: time.Minute})
+	client := &failingClient{Client: exp.client, fail: true}
+	exp.client = client
+	require.Error(t, exp.Export(context.Background(), testMeasurement))
+
+	// The discovery messages are published with the next measurement
+	client.fail = false
+	require.NoError(t, exp.Export(context.Background(), testMeasurement))
+	b.wait(t, "homeassistant/sensor/ruuvitag_ccca7e52cc34/temperature/config")
+	assert.Equal(t, "online", b.wait(t, "ruuvitag-gollector/Backyard/CCCA7E52CC34/availability").payload)
+	require.NoError(t, exp.Close())
+}
@@ -0,0 +1,52 @@
+package mqtt
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+// DefaultTopic is the default topic template of the measurements
+const DefaultTopic = "ruuvitag-gollector/{{.Name}}/{{.MAC}}"
+
+// TopicData is the data of the topic template
+type TopicData struct {
+	// Name is the name of the RuuviTag
+	Name string
+	// MAC is the MAC address of the RuuviTag without colons
+	MAC string
+}
+
+func parseTopic(topic string) (*template.Template, error) {
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	return template.New("topic").Option("missingkey=error").Parse(topic)
+}
+
+// executeTopic returns the topic of the measurements of the RuuviTag
+func executeTopic(tmpl *template.Template, data sensor.Data) (string, error) {
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, TopicData{
+		Name: data.Name,
+		MAC:  strings.ReplaceAll(data.Addr, ":", ""),
+	})
+	return sb.String(), err
+}
+
+func availabilityTopic(topic string) string {
+	return topic + "/availability"
+}
+
+func eventTopic(topic string) string {
+	return topic + "/events"
+}
+
+// message is an MQTT message to publish
+type message struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retained bool
+}
@@ -0,0 +1,57 @@
+package nats
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+type Config struct {
+	// URL is the server URL, or a comma separated list of server URLs
+	URL string
+	// Subject is a text/template of the subject of the measurements, executed with
+	// SubjectData. Defaults to DefaultSubject.
+	Subject string
+	// Username and Password authenticate with a user and password
+	Username string
+	Password string
+	// Token authenticates with a token
+	Token string
+	// CredentialsFile is a NATS credentials file containing a user JWT and NKey seed
+	CredentialsFile string
+	TLS             tlsconfig.Config
+	// JetStream publishes the measurements to a JetStream stream and waits for the
+	// publish acknowledgements. A stream capturing the subjects must exist.
+	JetStream bool
+	// Stream is the name of the stream the measurements are expected to be stored in.
+	// JetStream rejects the measurements if the subject belongs to another stream.
+	Stream string
+	// Deduplicate sets the message ID of the measurements to <MAC>-<measurement number>,
+	// or <MAC>-0-<timestamp in Unix nanoseconds> if the measurement number is not
+	// available, so that JetStream discards measurements that have already been stored
+	// within the duplicate window of the stream
+	Deduplicate bool
+	// Timeout is how long a publish may take before the export fails. Defaults to 10
+	// seconds.
+	Timeout time.Duration
+	Columns map[string]string
+	Logger  *slog.Logger
+}
+
+func Validate(cfg Config) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("NATS server URL must be specified")
+	}
+	if _, err := parseSubject(cfg.Subject); err != nil {
+		return fmt.Errorf("invalid subject template: %w", err)
+	}
+	if cfg.Token != "" && cfg.Username != "" {
+		return fmt.Errorf("token and username cannot both be specified")
+	}
+	if (cfg.Stream != "" || cfg.Deduplicate) && !cfg.JetStream {
+		return fmt.Errorf("stream and deduplication require JetStream")
+	}
+	return tlsconfig.Validate(cfg.TLS)
+}
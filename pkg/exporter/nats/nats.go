@@ -0,0 +1,186 @@
+//go:build nats
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/template"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+type natsExporter struct {
+	cfg     Config
+	subject *template.Template
+	conn    *natsgo.Conn
+	js      jetstream.JetStream
+	logger  *slog.Logger
+}
+
+// New creates an exporter that publishes the measurements as JSON to NATS subjects,
+// optionally waiting for JetStream publish acknowledgements
+func New(cfg Config) (exporter.Exporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	subject, err := parseSubject(cfg.Subject)
+	if err != nil {
+		return nil, err
+	}
+	e := &natsExporter{
+		cfg:     cfg,
+		subject: subject,
+		logger:  cfg.Logger.With("exporter", "NATS"),
+	}
+	opts := []natsgo.Option{
+		natsgo.Name("ruuvitag-gollector"),
+		// Keep reconnecting for as long as the exporter is running since the server
+		// may be unreachable for long periods on the edge
+		natsgo.MaxReconnects(-1),
+		natsgo.RetryOnFailedConnect(true),
+		natsgo.DisconnectErrHandler(func(_ *natsgo.Conn, err error) {
+			if err != nil {
+				e.logger.LogAttrs(context.Background(), slog.LevelWarn, "Disconnected from NATS", slog.Any("error", err))
+			}
+		}),
+		natsgo.ReconnectHandler(func(conn *natsgo.Conn) {
+			e.logger.LogAttrs(context.Background(), slog.LevelInfo, "Reconnected to NATS", slog.String("url", conn.ConnectedUrlRedacted()))
+		}),
+	}
+	switch {
+	case cfg.Username != "":
+		opts = append(opts, natsgo.UserInfo(cfg.Username, cfg.Password))
+	case cfg.Token != "":
+		opts = append(opts, natsgo.Token(cfg.Token))
+	}
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, natsgo.UserCredentials(cfg.CredentialsFile))
+	}
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := tlsconfig.New(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, natsgo.Secure(tlsConfig))
+	}
+	e.conn, err = natsgo.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.JetStream {
+		e.js, err = jetstream.New(e.conn)
+		if err != nil {
+			e.conn.Close()
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *natsExporter) Name() string {
+	return "NATS"
+}
+
+func (e *natsExporter) Export(ctx context.Context, data sensor.Data) error {
+	return e.ExportBatch(ctx, []exporter.Measurement{{Data: data, Extra: exporter.ExtraColumns(ctx)}})
+}
+
+// ExportBatch publishes the measurements and waits until the server has received all
+// of them, or with JetStream until all of them have been acknowledged
+func (e *natsExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	msgs := make([]*natsgo.Msg, 0, len(batch))
+	for _, m := range batch {
+		msg, err := e.message(m.Context(ctx), m.Data)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+	if e.js != nil {
+		return e.publishJetStream(ctx, msgs)
+	}
+	for _, msg := range msgs {
+		if err := e.conn.PublishMsg(msg); err != nil {
+			return publishError(err)
+		}
+	}
+	return e.conn.FlushWithContext(ctx)
+}
+
+func (e *natsExporter) publishJetStream(ctx context.Context, msgs []*natsgo.Msg) error {
+	futures := make([]jetstream.PubAckFuture, 0, len(msgs))
+	for _, msg := range msgs {
+		var opts []jetstream.PublishOpt
+		if e.cfg.Stream != "" {
+			opts = append(opts, jetstream.WithExpectStream(e.cfg.Stream))
+		}
+		future, err := e.js.PublishMsgAsync(msg, opts...)
+		if err != nil {
+			return publishError(err)
+		}
+		futures = append(futures, future)
+	}
+	for _, future := range futures {
+		select {
+		case ack := <-future.Ok():
+			if ack.Duplicate {
+				e.logger.LogAttrs(ctx, slog.LevelDebug, "Discarded duplicate measurement", slog.String("subject", future.Msg().Subject), slog.String("msg_id", future.Msg().Header.Get(jetstream.MsgIDHeader)))
+			}
+		case err := <-future.Err():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (e *natsExporter) message(ctx context.Context, data sensor.Data) (*natsgo.Msg, error) {
+	subject, err := executeSubject(e.subject, data)
+	if err != nil {
+		return nil, exporter.Permanent(err)
+	}
+	payload, err := json.Marshal(exporter.Transform(ctx, e.cfg.Columns, data))
+	if err != nil {
+		return nil, exporter.Permanent(err)
+	}
+	msg := natsgo.NewMsg(subject)
+	msg.Data = payload
+	msg.Header.Set("mac", data.Addr)
+	msg.Header.Set("name", data.Name)
+	if e.cfg.Deduplicate {
+		msg.Header.Set(jetstream.MsgIDHeader, msgID(data))
+	}
+	return msg, nil
+}
+
+func publishError(err error) error {
+	if errors.Is(err, natsgo.ErrMaxPayload) || errors.Is(err, natsgo.ErrBadSubject) {
+		return exporter.Permanent(fmt.Errorf("failed to publish measurement: %w", err))
+	}
+	return err
+}
+
+func (e *natsExporter) Close() error {
+	return e.conn.Drain()
+}
@@ -0,0 +1,169 @@
+//go:build nats
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var columns = map[string]string{
+	"time":               "time",
+	"mac":                "mac",
+	"name":               "name",
+	"temperature":        "temperature",
+	"measurement_number": "measurement_number",
+}
+
+func runServer(t *testing.T) *server.Server {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	require.NoError(t, err)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	require.True(t, s.ReadyForConnections(5*time.Second))
+	return s
+}
+
+func connect(t *testing.T, s *server.Server) *natsgo.Conn {
+	t.Helper()
+	conn, err := natsgo.Connect(s.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+func newExporter(t *testing.T, cfg Config) *natsExporter {
+	t.Helper()
+	cfg.Columns = columns
+	exp, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		exp.Close()
+	})
+	return exp.(*natsExporter)
+}
+
+func TestExport(t *testing.T) {
+	s := runServer(t)
+	sub, err := connect(t, s).SubscribeSync("ruuvitag.>")
+	require.NoError(t, err)
+	exp := newExporter(t, Config{URL: s.ClientURL()})
+
+	unnamed := testData
+	unnamed.Name = ""
+	ctx := context.Background()
+	require.NoError(t, exp.Export(ctx, testData))
+	require.NoError(t, exp.Export(ctx, unnamed))
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.Living_room", msg.Subject)
+	assert.Equal(t, testData.Addr, msg.Header.Get("mac"))
+	assert.Equal(t, testData.Name, msg.Header.Get("name"))
+	assert.Empty(t, msg.Header.Get(jetstream.MsgIDHeader))
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(msg.Data, &payload))
+	assert.Equal(t, "CC:CA:7E:52:CC:34", payload["mac"])
+	assert.Equal(t, 21.5, payload["temperature"])
+	assert.Equal(t, 1234.0, payload["measurement_number"])
+
+	msg, err = sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.CCCA7E52CC34", msg.Subject)
+}
+
+func TestJetStream(t *testing.T) {
+	s := runServer(t)
+	js, err := jetstream.New(connect(t, s))
+	require.NoError(t, err)
+	ctx := context.Background()
+	stream, err := js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:     "RUUVITAG",
+		Subjects: []string{"ruuvi.>"},
+	})
+	require.NoError(t, err)
+	exp := newExporter(t, Config{
+		URL:         s.ClientURL(),
+		Subject:     "ruuvi.{{.MAC}}",
+		JetStream:   true,
+		Stream:      "RUUVITAG",
+		Deduplicate: true,
+	})
+
+	next := testData
+	next.MeasurementNumber++
+	next.Timestamp = next.Timestamp.Add(time.Minute)
+	batch := []exporter.Measurement{{Data: testData}, {Data: next}}
+	require.NoError(t, exp.ExportBatch(ctx, batch))
+	// Measurements that are exported again are discarded as duplicates
+	require.NoError(t, exp.ExportBatch(ctx, batch))
+	require.NoError(t, exp.Export(ctx, next))
+
+	info, err := stream.Info(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+	msg, err := stream.GetMsg(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvi.CCCA7E52CC34", msg.Subject)
+	assert.Equal(t, "CCCA7E52CC34-1234", msg.Header.Get(jetstream.MsgIDHeader))
+	msg, err = stream.GetMsg(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "CCCA7E52CC34-1235", msg.Header.Get(jetstream.MsgIDHeader))
+}
+
+func TestJetStreamErrors(t *testing.T) {
+	s := runServer(t)
+	js, err := jetstream.New(connect(t, s))
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:     "RUUVITAG",
+		Subjects: []string{"ruuvitag.>"},
+	})
+	require.NoError(t, err)
+
+	// The subject is captured by another stream than expected
+	exp := newExporter(t, Config{
+		URL:       s.ClientURL(),
+		JetStream: true,
+		Stream:    "OTHER",
+		Timeout:   time.Second,
+	})
+	assert.Error(t, exp.Export(ctx, testData))
+
+	// No stream captures the subject
+	exp = newExporter(t, Config{
+		URL:       s.ClientURL(),
+		Subject:   "other.{{.Name}}",
+		JetStream: true,
+		Timeout:   time.Second,
+	})
+	assert.Error(t, exp.Export(ctx, testData))
+}
+
+func TestBadSubject(t *testing.T) {
+	s := runServer(t)
+	exp := newExporter(t, Config{URL: s.ClientURL(), Subject: "ruuvitag..{{.Name}}"})
+	err := exp.Export(context.Background(), sensor.Data{Addr: testData.Addr})
+	assert.True(t, exporter.IsPermanent(err), err)
+}
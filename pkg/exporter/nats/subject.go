@@ -0,0 +1,73 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+// DefaultSubject is the default subject template of the measurements
+const DefaultSubject = "ruuvitag.{{.Name}}"
+
+// SubjectData is the data of the subject template
+type SubjectData struct {
+	// Name is the name of the RuuviTag, or MAC if the RuuviTag has no name. Characters
+	// that are not allowed in a subject token are replaced with underscores.
+	Name string
+	// MAC is the MAC address of the RuuviTag without colons
+	MAC string
+}
+
+var tokenReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+func parseSubject(subject string) (*template.Template, error) {
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	return template.New("subject").Option("missingkey=error").Parse(subject)
+}
+
+// executeSubject returns the subject of the measurements of the RuuviTag
+func executeSubject(tmpl *template.Template, data sensor.Data) (string, error) {
+	mac := strings.ReplaceAll(data.Addr, ":", "")
+	name := tokenReplacer.Replace(data.Name)
+	if name == "" {
+		name = mac
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, SubjectData{
+		Name: name,
+		MAC:  mac,
+	}); err != nil {
+		return "", err
+	}
+	subject := sb.String()
+	if !validSubject(subject) {
+		return "", fmt.Errorf("invalid subject: %q", subject)
+	}
+	return subject, nil
+}
+
+// validSubject returns true if the subject can be published to: it consists of non-empty
+// tokens separated by dots without whitespace or wildcards
+func validSubject(subject string) bool {
+	for token := range strings.SplitSeq(subject, ".") {
+		if token == "" || token == "*" || token == ">" || strings.ContainsAny(token, " \t\r\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// msgID returns the JetStream message ID of the measurement. The same measurement received
+// more than once gets the same ID regardless of when it was received. The timestamp is
+// used only when the measurement number is not available.
+func msgID(data sensor.Data) string {
+	mac := strings.ReplaceAll(data.Addr, ":", "")
+	if data.MeasurementNumber == 0 {
+		return fmt.Sprintf("%s-0-%d", mac, data.Timestamp.UnixNano())
+	}
+	return fmt.Sprintf("%s-%d", mac, data.MeasurementNumber)
+}
@@ -0,0 +1,72 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+var testData = sensor.Data{
+	Addr:              "CC:CA:7E:52:CC:34",
+	Name:              "Living room",
+	Temperature:       21.5,
+	MeasurementNumber: 1234,
+	Timestamp:         time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestSubject(t *testing.T) {
+	tmpl, err := parseSubject("")
+	require.NoError(t, err)
+	subject, err := executeSubject(tmpl, testData)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.Living_room", subject)
+
+	// Characters that separate or match subject tokens are replaced
+	data := testData
+	data.Name = "attic.north>*"
+	subject, err = executeSubject(tmpl, data)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.attic_north__", subject)
+
+	data.Name = ""
+	subject, err = executeSubject(tmpl, data)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvitag.CCCA7E52CC34", subject)
+
+	tmpl, err = parseSubject("ruuvi.{{.MAC}}.{{.Name}}")
+	require.NoError(t, err)
+	subject, err = executeSubject(tmpl, testData)
+	require.NoError(t, err)
+	assert.Equal(t, "ruuvi.CCCA7E52CC34.Living_room", subject)
+
+	tmpl, err = parseSubject("ruuvi..{{.Name}}")
+	require.NoError(t, err)
+	_, err = executeSubject(tmpl, testData)
+	assert.Error(t, err)
+
+	assert.Equal(t, "CCCA7E52CC34-1234", msgID(testData))
+	// The same measurement received again later has the same ID
+	data = testData
+	data.Timestamp = data.Timestamp.Add(time.Second)
+	assert.Equal(t, msgID(testData), msgID(data))
+	// Measurements without a measurement number are told apart by their timestamp
+	data = testData
+	data.MeasurementNumber = 0
+	later := data
+	later.Timestamp = later.Timestamp.Add(time.Second)
+	assert.NotEqual(t, msgID(data), msgID(later))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(Config{URL: "nats://localhost:4222"}))
+	assert.Error(t, Validate(Config{}))
+	assert.Error(t, Validate(Config{URL: "nats://localhost:4222", Subject: "ruuvi.{{.Name"}))
+	assert.Error(t, Validate(Config{URL: "nats://localhost:4222", Deduplicate: true}))
+	assert.Error(t, Validate(Config{URL: "nats://localhost:4222", Stream: "RUUVI"}))
+	assert.NoError(t, Validate(Config{URL: "nats://localhost:4222", JetStream: true, Stream: "RUUVI", Deduplicate: true}))
+	assert.Error(t, Validate(Config{URL: "nats://localhost:4222", Username: "user", Token: "token"}))
+}
@@ -0,0 +1,47 @@
+package otlp
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+const (
+	ProtocolHTTP = "http/protobuf"
+	ProtocolGRPC = "grpc"
+)
+
+type Config struct {
+	// Protocol is either http/protobuf (default) or grpc
+	Protocol string
+	// Endpoint is the URL of the metrics endpoint for OTLP/HTTP, such as
+	// http://localhost:4318/v1/metrics, or the host and port of the collector for gRPC.
+	// Defaults to the local collector.
+	Endpoint string
+	// Headers are sent with every request, for example for authentication
+	Headers map[string]string
+	// Insecure disables TLS for gRPC. OTLP/HTTP uses TLS for https endpoints.
+	Insecure bool
+	TLS      tlsconfig.Config
+	// Prefix is prepended to the column names to form metric names. Defaults to ruuvitag.
+	Prefix string
+	// ServiceName is the service.name resource attribute. Defaults to ruuvitag-gollector.
+	ServiceName string
+	Timeout     time.Duration
+	Columns     map[string]string
+	Logger      *slog.Logger
+}
+
+func Validate(cfg Config) error {
+	switch cfg.Protocol {
+	case "", ProtocolHTTP, ProtocolGRPC:
+	default:
+		return fmt.Errorf("invalid OTLP protocol %s, must be %s or %s", cfg.Protocol, ProtocolHTTP, ProtocolGRPC)
+	}
+	if len(cfg.Columns) == 0 {
+		return fmt.Errorf("columns must be non-empty")
+	}
+	return tlsconfig.Validate(cfg.TLS)
+}
@@ -0,0 +1,87 @@
+//go:build otlp
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+type httpClient struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func newHTTPClient(cfg Config, tlsConfig *tls.Config) (*httpClient, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "http://localhost:4318/v1/metrics"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s: %w", endpoint, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &httpClient{
+		client:  &http.Client{Transport: transport},
+		url:     u.String(),
+		headers: cfg.Headers,
+	}, nil
+}
+
+func (c *httpClient) export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, exporter.Permanent(err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, exporter.Permanent(err)
+	}
+	for k, v := range c.headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode/100 == 2:
+		res := new(colmetricspb.ExportMetricsServiceResponse)
+		if err := proto.Unmarshal(content, res); err != nil {
+			return nil, fmt.Errorf("invalid OTLP response: %w", err)
+		}
+		return res, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+		return nil, fmt.Errorf("OTLP collector returned %s", resp.Status)
+	default:
+		return nil, exporter.Permanent(fmt.Errorf("OTLP collector returned %s", resp.Status))
+	}
+}
+
+func (c *httpClient) close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
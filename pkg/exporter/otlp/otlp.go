@@ -0,0 +1,183 @@
+//go:build otlp
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+const scopeName = "github.com/niktheblak/ruuvitag-gollector"
+
+// client sends metrics to the collector over one of the OTLP transports
+type client interface {
+	export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error)
+	close() error
+}
+
+type otlpExporter struct {
+	cfg    Config
+	client client
+	logger *slog.Logger
+}
+
+// New creates an exporter that sends each mapped column of the measurements as an OTLP
+// gauge to an OpenTelemetry collector
+func New(cfg Config) (exporter.Exporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = ProtocolHTTP
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "ruuvitag"
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "ruuvitag-gollector"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	tlsConfig, err := tlsconfig.New(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	var c client
+	switch cfg.Protocol {
+	case ProtocolGRPC:
+		c, err = newGRPCClient(cfg, tlsConfig)
+	default:
+		c, err = newHTTPClient(cfg, tlsConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &otlpExporter{
+		cfg:    cfg,
+		client: c,
+		logger: cfg.Logger.With("exporter", "OTLP"),
+	}, nil
+}
+
+func (e *otlpExporter) Name() string {
+	return fmt.Sprintf("OTLP (%s)", e.cfg.Protocol)
+}
+
+func (e *otlpExporter) Export(ctx context.Context, data sensor.Data) error {
+	return e.ExportBatch(ctx, []exporter.Measurement{{Data: data, Extra: exporter.ExtraColumns(ctx)}})
+}
+
+func (e *otlpExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	req := e.request(batch)
+	if len(req.ResourceMetrics) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	resp, err := e.client.export(ctx, req)
+	if err != nil {
+		return err
+	}
+	if ps := resp.GetPartialSuccess(); ps != nil && (ps.RejectedDataPoints > 0 || ps.ErrorMessage != "") {
+		e.logger.LogAttrs(ctx, slog.LevelWarn, "Collector rejected data points",
+			slog.Int64("rejected", ps.RejectedDataPoints),
+			slog.String("message", ps.ErrorMessage),
+		)
+	}
+	return nil
+}
+
+// request builds an export request with a resource for each RuuviTag in the batch
+func (e *otlpExporter) request(batch []exporter.Measurement) *colmetricspb.ExportMetricsServiceRequest {
+	req := new(colmetricspb.ExportMetricsServiceRequest)
+	resources := make(map[string]*metricspb.ResourceMetrics)
+	metrics := make(map[string]map[string]*metricspb.Metric)
+	for _, m := range batch {
+		fields := exporter.NumericFields(m.Context(context.Background()), e.cfg.Columns, m.Data)
+		if len(fields) == 0 {
+			continue
+		}
+		addr := strings.ToUpper(m.Addr)
+		rm, ok := resources[addr]
+		if !ok {
+			rm = &metricspb.ResourceMetrics{
+				Resource: &resourcepb.Resource{Attributes: e.resourceAttributes(m.Data)},
+				ScopeMetrics: []*metricspb.ScopeMetrics{{
+					Scope: &commonpb.InstrumentationScope{Name: scopeName},
+				}},
+			}
+			resources[addr] = rm
+			metrics[addr] = make(map[string]*metricspb.Metric)
+			req.ResourceMetrics = append(req.ResourceMetrics, rm)
+		}
+		ts := m.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		columns := make([]string, 0, len(fields))
+		for column := range fields {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			metric, ok := metrics[addr][column]
+			if !ok {
+				metric = &metricspb.Metric{
+					Name: e.cfg.Prefix + "." + column,
+					Data: &metricspb.Metric_Gauge{Gauge: new(metricspb.Gauge)},
+				}
+				metrics[addr][column] = metric
+				sm := rm.ScopeMetrics[0]
+				sm.Metrics = append(sm.Metrics, metric)
+			}
+			gauge := metric.GetGauge()
+			gauge.DataPoints = append(gauge.DataPoints, &metricspb.NumberDataPoint{
+				TimeUnixNano: uint64(ts.UnixNano()),
+				Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: fields[column]},
+			})
+		}
+	}
+	return req
+}
+
+// resourceAttributes identifies the RuuviTag with the mapped MAC address and name columns
+func (e *otlpExporter) resourceAttributes(data sensor.Data) []*commonpb.KeyValue {
+	attrs := []*commonpb.KeyValue{stringAttribute("service.name", e.cfg.ServiceName)}
+	if mac, ok := e.cfg.Columns["mac"]; ok {
+		attrs = append(attrs, stringAttribute(mac, strings.ToUpper(data.Addr)))
+	}
+	if name, ok := e.cfg.Columns["name"]; ok && data.Name != "" {
+		attrs = append(attrs, stringAttribute(name, data.Name))
+	}
+	return attrs
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func (e *otlpExporter) Close() error {
+	return e.client.close()
+}
@@ -0,0 +1,11 @@
+//go:build !otlp
+
+package otlp
+
+import (
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+func New(cfg Config) (exporter.Exporter, error) {
+	return exporter.NoOp{ReportedName: "OTLP"}, nil
+}
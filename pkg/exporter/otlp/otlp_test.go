@@ -0,0 +1,190 @@
+//go:build otlp
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var (
+	columns = map[string]string{
+		"time":        "time",
+		"mac":         "mac",
+		"name":        "name",
+		"temperature": "temperature",
+		"humidity":    "humidity",
+	}
+	ts = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+type collector struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	mu       sync.Mutex
+	requests []*colmetricspb.ExportMetricsServiceRequest
+	headers  []map[string]string
+}
+
+func (c *collector) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	headers := make(map[string]string)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		headers[k] = v[0]
+	}
+	c.headers = append(c.headers, headers)
+	return new(colmetricspb.ExportMetricsServiceResponse), nil
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	req := new(colmetricspb.ExportMetricsServiceRequest)
+	if err := proto.Unmarshal(body, req); err != nil || r.URL.Path != "/v1/metrics" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, map[string]string{"authorization": r.Header.Get("Authorization")})
+	c.mu.Unlock()
+	resp, _ := proto.Marshal(new(colmetricspb.ExportMetricsServiceResponse))
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(resp)
+}
+
+func attributes(rm *metricspb.ResourceMetrics) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range rm.Resource.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	return attrs
+}
+
+func gauges(rm *metricspb.ResourceMetrics) map[string][]float64 {
+	values := make(map[string][]float64)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		for _, dp := range m.GetGauge().DataPoints {
+			values[m.Name] = append(values[m.Name], dp.GetAsDouble())
+		}
+	}
+	return values
+}
+
+func TestExportHTTP(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	exp, err := New(Config{
+		Endpoint: srv.URL,
+		Headers:  map[string]string{"Authorization": "Bearer abc123"},
+		Columns:  columns,
+	})
+	require.NoError(t, err)
+	defer exp.Close()
+	err = exp.Export(context.Background(), sensor.Data{Addr: "cc:ca:7e:52:cc:34", Name: "Backyard", Temperature: 21.5, Humidity: 60, Timestamp: ts})
+	require.NoError(t, err)
+	require.Len(t, c.requests, 1)
+	require.Len(t, c.requests[0].ResourceMetrics, 1)
+	rm := c.requests[0].ResourceMetrics[0]
+	assert.Equal(t, map[string]string{
+		"service.name": "ruuvitag-gollector",
+		"mac":          "CC:CA:7E:52:CC:34",
+		"name":         "Backyard",
+	}, attributes(rm))
+	assert.Equal(t, map[string][]float64{
+		"ruuvitag.humidity":    {60},
+		"ruuvitag.temperature": {21.5},
+	}, gauges(rm))
+	dp := rm.ScopeMetrics[0].Metrics[0].GetGauge().DataPoints[0]
+	assert.Equal(t, uint64(ts.UnixNano()), dp.TimeUnixNano)
+	assert.Equal(t, "Bearer abc123", c.headers[0]["authorization"])
+}
+
+func TestExportBatch(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	exp, err := New(Config{Endpoint: srv.URL, Prefix: "home", Columns: columns})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.True(t, exporter.SupportsBatch(exp))
+	batch := []exporter.Measurement{
+		{Data: sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.5, Timestamp: ts}},
+		{Data: sensor.Data{Addr: "FB:E1:B7:04:95:EE", Name: "Upstairs", Temperature: 22, Timestamp: ts}},
+		{Data: sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.7, Timestamp: ts.Add(time.Minute)}},
+	}
+	require.NoError(t, exporter.ExportBatch(context.Background(), exp, batch))
+	require.Len(t, c.requests, 1)
+	rms := c.requests[0].ResourceMetrics
+	require.Len(t, rms, 2)
+	assert.Equal(t, "Backyard", attributes(rms[0])["name"])
+	assert.Equal(t, []float64{21.5, 21.7}, gauges(rms[0])["home.temperature"])
+	assert.Equal(t, "Upstairs", attributes(rms[1])["name"])
+	assert.Equal(t, []float64{22}, gauges(rms[1])["home.temperature"])
+}
+
+func TestExportHTTPRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	exp, err := New(Config{Endpoint: srv.URL, Columns: columns})
+	require.NoError(t, err)
+	defer exp.Close()
+	err = exp.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Temperature: 21.5, Timestamp: ts})
+	assert.True(t, exporter.IsPermanent(err))
+}
+
+func TestExportGRPC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	c := new(collector)
+	srv := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(srv, c)
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer srv.Stop()
+	exp, err := New(Config{
+		Protocol: ProtocolGRPC,
+		Endpoint: ln.Addr().String(),
+		Insecure: true,
+		Headers:  map[string]string{"x-api-key": "secret"},
+		Columns:  columns,
+	})
+	require.NoError(t, err)
+	defer exp.Close()
+	err = exp.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.5, Timestamp: ts})
+	require.NoError(t, err)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Len(t, c.requests, 1)
+	rm := c.requests[0].ResourceMetrics[0]
+	assert.Equal(t, "Backyard", attributes(rm)["name"])
+	assert.Equal(t, []float64{21.5}, gauges(rm)["ruuvitag.temperature"])
+	assert.Equal(t, "secret", c.headers[0]["x-api-key"])
+}
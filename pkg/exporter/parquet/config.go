@@ -0,0 +1,48 @@
+package parquet
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+	CompressionGzip   = "gzip"
+	CompressionNone   = "none"
+)
+
+type Config struct {
+	// Dir is the root directory of the dataset, which is created if it doesn't exist.
+	// Files are written to <Dir>/date=<date>/name=<name>/.
+	Dir string
+	// Compression is snappy (default), zstd, gzip or none
+	Compression string
+	// RowGroupSize is the number of rows buffered in memory before they are written to
+	// the file as a row group. Defaults to 10000.
+	RowGroupSize int
+	// MaxSize is the size in bytes after which a file is finished and a new one started.
+	// Defaults to 64 MB.
+	MaxSize int64
+	// RotateInterval is the age after which a file is finished and a new one started.
+	// Defaults to 1 hour.
+	RotateInterval time.Duration
+	Columns        map[string]string
+	Logger         *slog.Logger
+}
+
+func Validate(cfg Config) error {
+	if cfg.Dir == "" {
+		return fmt.Errorf("directory must be specified")
+	}
+	if cfg.Columns["time"] == "" || cfg.Columns["mac"] == "" {
+		return fmt.Errorf("columns must include time and mac")
+	}
+	switch cfg.Compression {
+	case "", CompressionSnappy, CompressionZstd, CompressionGzip, CompressionNone:
+	default:
+		return fmt.Errorf("invalid compression: %s", cfg.Compression)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+//go:build parquet
+
+package parquet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+const tmpSuffix = ".tmp"
+
+var invalidPartitionChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// partition is the file being written to in a date and name partition. The file is
+// written under a temporary name until it is finished, because a Parquet file can only
+// be read once its footer has been written.
+type partition struct {
+	f       *os.File
+	w       *parquetgo.Writer
+	path    string
+	date    string
+	created time.Time
+	rows    int
+}
+
+type parquetExporter struct {
+	cfg    Config
+	schema *schema
+	codec  compress.Codec
+	logger *slog.Logger
+	now    func() time.Time
+	mu     sync.Mutex
+	parts  map[string]*partition
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates an exporter that writes measurements to Parquet files partitioned by date
+// and RuuviTag name
+func New(cfg Config) (exporter.Exporter, error) {
+	e, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.wg.Add(1)
+	go e.run(ctx)
+	return e, nil
+}
+
+func newExporter(cfg Config) (*parquetExporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.RowGroupSize <= 0 {
+		cfg.RowGroupSize = 10000
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 64 << 20
+	}
+	if cfg.RotateInterval <= 0 {
+		cfg.RotateInterval = time.Hour
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	var codec compress.Codec
+	switch cfg.Compression {
+	case "", CompressionSnappy:
+		codec = &parquetgo.Snappy
+	case CompressionZstd:
+		codec = &parquetgo.Zstd
+	case CompressionGzip:
+		codec = &parquetgo.Gzip
+	case CompressionNone:
+		codec = &parquetgo.Uncompressed
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &parquetExporter{
+		cfg:    cfg,
+		schema: newSchema(cfg.Columns),
+		codec:  codec,
+		logger: cfg.Logger,
+		now:    time.Now,
+		parts:  make(map[string]*partition),
+	}, nil
+}
+
+func (e *parquetExporter) Name() string {
+	return fmt.Sprintf("Parquet (%s)", e.cfg.Dir)
+}
+
+func (e *parquetExporter) Export(ctx context.Context, data sensor.Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.write(ctx, data)
+}
+
+func (e *parquetExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, m := range batch {
+		if err := e.write(m.Context(ctx), m.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *parquetExporter) write(ctx context.Context, data sensor.Data) error {
+	row, err := e.schema.row(exporter.Transform(ctx, e.cfg.Columns, data))
+	if err != nil {
+		return err
+	}
+	date := data.Timestamp.UTC().Format(time.DateOnly)
+	dir := filepath.Join(e.cfg.Dir, "date="+date, "name="+partitionName(data))
+	p, err := e.partition(dir, date)
+	if err != nil {
+		return err
+	}
+	if _, err := p.w.WriteRows([]parquetgo.Row{row}); err != nil {
+		return err
+	}
+	if p.rows++; p.rows >= e.cfg.RowGroupSize {
+		if err := p.w.Flush(); err != nil {
+			return err
+		}
+		p.rows = 0
+	}
+	if p.w.Size() >= e.cfg.MaxSize {
+		return e.finish(dir, p)
+	}
+	return nil
+}
+
+// partitionName returns the name of the RuuviTag, or its MAC address if it has no name,
+// in a form that is safe to use as a directory name
+func partitionName(data sensor.Data) string {
+	name := data.Name
+	if name == "" {
+		name = strings.ReplaceAll(strings.ToUpper(data.Addr), ":", "")
+	}
+	return invalidPartitionChars.ReplaceAllString(name, "_")
+}
+
+// partition returns the open partition of the directory, starting a new file if
+// necessary
+func (e *parquetExporter) partition(dir, date string) (*partition, error) {
+	if p, ok := e.parts[dir]; ok {
+		return p, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	now := e.now()
+	base := filepath.Join(dir, "part-"+now.UTC().Format("20060102T150405"))
+	path := base + ".parquet"
+	for i := 1; exists(path) || exists(path+tmpSuffix); i++ {
+		path = fmt.Sprintf("%s.%d.parquet", base, i)
+	}
+	f, err := os.OpenFile(path+tmpSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	p := &partition{
+		f:       f,
+		w:       parquetgo.NewWriter(f, e.schema.schema, parquetgo.Compression(e.codec)),
+		path:    path,
+		date:    date,
+		created: now,
+	}
+	e.parts[dir] = p
+	return p, nil
+}
+
+// finish writes the buffered rows and the footer of the partition file and renames it
+// to its final name
+func (e *parquetExporter) finish(dir string, p *partition) error {
+	delete(e.parts, dir)
+	size := p.w.Size()
+	if err := p.w.Close(); err != nil {
+		return errors.Join(err, p.f.Close())
+	}
+	if err := errors.Join(p.f.Sync(), p.f.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(p.path+tmpSuffix, p.path); err != nil {
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	e.logger.LogAttrs(context.TODO(), slog.LevelInfo, "Finished Parquet file", slog.String("path", p.path), slog.Int64("size", size))
+	return nil
+}
+
+func (e *parquetExporter) run(ctx context.Context) {
+	defer e.wg.Done()
+	ticker := time.NewTicker(min(e.cfg.RotateInterval, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := e.maintain(); err != nil {
+			e.logger.LogAttrs(ctx, slog.LevelError, "Failed to finish Parquet files", slog.Any("error", err))
+		}
+	}
+}
+
+// maintain finishes the files that are older than the rotation interval or belong to a
+// past date, so that they become readable even if their RuuviTag stops reporting
+func (e *parquetExporter) maintain() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	today := now.UTC().Format(time.DateOnly)
+	var errs []error
+	for dir, p := range e.parts {
+		if p.date < today || now.Sub(p.created) >= e.cfg.RotateInterval {
+			errs = append(errs, e.finish(dir, p))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *parquetExporter) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+		e.wg.Wait()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var errs []error
+	for dir, p := range e.parts {
+		errs = append(errs, e.finish(dir, p))
+	}
+	return errors.Join(errs...)
+}
+
+// syncDir flushes the directory entries so that renamed files survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,174 @@
+//go:build parquet
+
+package parquet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
+)
+
+type row struct {
+	Time            time.Time `parquet:"time,timestamp(microsecond)"`
+	MAC             string    `parquet:"mac"`
+	Name            *string   `parquet:"name,optional"`
+	Temperature     *float64  `parquet:"temperature,optional"`
+	MovementCounter *int64    `parquet:"movement_counter,optional"`
+	BatteryLow      *bool     `parquet:"battery_low,optional"`
+}
+
+func newTestExporter(t *testing.T, cfg Config, now time.Time) *parquetExporter {
+	t.Helper()
+	cfg.Dir = t.TempDir()
+	e, err := newExporter(cfg)
+	require.NoError(t, err)
+	e.now = func() time.Time { return now }
+	return e
+}
+
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		paths = append(paths, filepath.ToSlash(rel))
+		return err
+	})
+	require.NoError(t, err)
+	sort.Strings(paths)
+	return paths
+}
+
+func TestExport(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)
+	e := newTestExporter(t, Config{Columns: map[string]string{
+		"time":                     "time",
+		"mac":                      "mac",
+		"name":                     "name",
+		"temperature":              "temperature",
+		"movement_counter":         "movement_counter",
+		processor.BatteryLowColumn: "battery_low",
+	}}, ts)
+	ctx := exporter.WithExtraColumns(context.Background(), map[string]any{processor.BatteryLowColumn: true})
+	require.NoError(t, e.Export(ctx, sensor.Data{
+		Addr:            "CC:CA:7E:52:CC:34",
+		Name:            "Back yard",
+		Temperature:     21.5,
+		MovementCounter: 42,
+		Timestamp:       ts,
+	}))
+	require.NoError(t, e.ExportBatch(context.Background(), []exporter.Measurement{
+		{Data: sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Back yard", Timestamp: ts.Add(time.Minute)}},
+		{Data: sensor.Data{Addr: "CC:CA:7E:52:CC:34", Timestamp: ts.Add(time.Minute)}},
+	}))
+	// Files are not visible under their final name until they are finished
+	for _, f := range files(t, e.cfg.Dir) {
+		assert.True(t, strings.HasSuffix(f, ".parquet.tmp"), f)
+	}
+	require.NoError(t, e.Close())
+	assert.Equal(t, []string{
+		"date=2024-05-01/name=Back_yard/part-20240501T235800.parquet",
+		"date=2024-05-01/name=CCCA7E52CC34/part-20240501T235800.parquet",
+	}, files(t, e.cfg.Dir))
+
+	rows, err := parquetgo.ReadFile[row](filepath.Join(e.cfg.Dir, "date=2024-05-01/name=Back_yard/part-20240501T235800.parquet"))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.True(t, rows[0].Time.Equal(ts))
+	assert.Equal(t, "CC:CA:7E:52:CC:34", rows[0].MAC)
+	assert.Equal(t, "Back yard", *rows[0].Name)
+	assert.Equal(t, 21.5, *rows[0].Temperature)
+	assert.Equal(t, int64(42), *rows[0].MovementCounter)
+	assert.True(t, *rows[0].BatteryLow)
+	assert.Nil(t, rows[1].BatteryLow)
+
+	rows, err = parquetgo.ReadFile[row](filepath.Join(e.cfg.Dir, "date=2024-05-01/name=CCCA7E52CC34/part-20240501T235800.parquet"))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Nil(t, rows[0].Name)
+}
+
+func TestSchema(t *testing.T) {
+	s := newSchema(map[string]string{
+		"time":                     "time",
+		"mac":                      "mac",
+		"name":                     "name",
+		"temperature":              "temperature",
+		"movement_counter":         "movement_counter",
+		processor.BatteryLowColumn: "battery_low",
+	})
+	for _, expected := range []string{
+		"required int64 time (TIMESTAMP(isAdjustedToUTC=true,unit=MICROS))",
+		"required binary mac (STRING)",
+		"optional binary name (STRING)",
+		"optional double temperature",
+		"optional int64 movement_counter (INT(64,true))",
+		"optional boolean battery_low",
+	} {
+		assert.Contains(t, s.schema.String(), expected)
+	}
+}
+
+func TestRotateSize(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)
+	e := newTestExporter(t, Config{Columns: map[string]string{"time": "time", "mac": "mac"}, RowGroupSize: 1, MaxSize: 1}, ts)
+	for i := range 3 {
+		require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Timestamp: ts.Add(time.Duration(i) * time.Second)}))
+	}
+	require.NoError(t, e.Close())
+	assert.Equal(t, []string{
+		"date=2024-05-01/name=Backyard/part-20240501T235800.1.parquet",
+		"date=2024-05-01/name=Backyard/part-20240501T235800.2.parquet",
+		"date=2024-05-01/name=Backyard/part-20240501T235800.parquet",
+	}, files(t, e.cfg.Dir))
+}
+
+func TestRotateInterval(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)
+	e := newTestExporter(t, Config{Columns: map[string]string{"time": "time", "mac": "mac"}, RotateInterval: time.Hour}, now)
+	e.now = func() time.Time { return now }
+	require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Timestamp: now}))
+	require.NoError(t, e.maintain())
+	assert.Equal(t, []string{"date=2024-05-01/name=Backyard/part-20240501T235800.parquet.tmp"}, files(t, e.cfg.Dir))
+
+	// The file of the previous day is finished once the day has passed
+	now = now.Add(5 * time.Minute)
+	require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Timestamp: now}))
+	require.NoError(t, e.maintain())
+	assert.Equal(t, []string{
+		"date=2024-05-01/name=Backyard/part-20240501T235800.parquet",
+		"date=2024-05-02/name=Backyard/part-20240502T000300.parquet.tmp",
+	}, files(t, e.cfg.Dir))
+
+	now = now.Add(time.Hour)
+	require.NoError(t, e.maintain())
+	assert.Equal(t, []string{
+		"date=2024-05-01/name=Backyard/part-20240501T235800.parquet",
+		"date=2024-05-02/name=Backyard/part-20240502T000300.parquet",
+	}, files(t, e.cfg.Dir))
+	require.NoError(t, e.Close())
+}
+
+func TestValidate(t *testing.T) {
+	columns := map[string]string{"time": "time", "mac": "mac"}
+	assert.Error(t, Validate(Config{Columns: columns}))
+	assert.Error(t, Validate(Config{Dir: "data", Columns: map[string]string{"time": "time"}}))
+	assert.Error(t, Validate(Config{Dir: "data", Columns: columns, Compression: "lzo"}))
+	assert.NoError(t, Validate(Config{Dir: "data", Columns: columns, Compression: CompressionZstd}))
+}
@@ -0,0 +1,126 @@
+//go:build parquet
+
+package parquet
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+type columnType int
+
+const (
+	typeDouble columnType = iota
+	typeInt64
+	typeBoolean
+	typeString
+	typeTimestamp
+)
+
+type column struct {
+	name     string
+	typ      columnType
+	required bool
+	index    int
+	level    int
+}
+
+// schema is the Parquet schema derived from the column map
+type schema struct {
+	schema  *parquetgo.Schema
+	columns []column
+}
+
+func newSchema(columns map[string]string) *schema {
+	group := make(parquetgo.Group)
+	var cols []column
+	for _, key := range exporter.ColumnOrder(columns) {
+		c := column{name: columns[key]}
+		var node parquetgo.Node
+		switch {
+		case key == "time":
+			c.typ, c.required = typeTimestamp, true
+			node = parquetgo.Timestamp(parquetgo.Microsecond)
+		case key == "mac":
+			c.typ, c.required = typeString, true
+			node = parquetgo.String()
+		case key == "name":
+			c.typ = typeString
+			node = parquetgo.String()
+		case slices.Contains(exporter.IntegerColumns, key):
+			c.typ = typeInt64
+			node = parquetgo.Int(64)
+		case exporter.IsBooleanColumn(key):
+			c.typ = typeBoolean
+			node = parquetgo.Leaf(parquetgo.BooleanType)
+		default:
+			c.typ = typeDouble
+			node = parquetgo.Leaf(parquetgo.DoubleType)
+		}
+		if !c.required {
+			node = parquetgo.Optional(node)
+		}
+		group[c.name] = node
+		cols = append(cols, c)
+	}
+	s := &schema{schema: parquetgo.NewSchema("ruuvitag", group)}
+	for _, c := range cols {
+		leaf, _ := s.schema.Lookup(c.name)
+		c.index = leaf.ColumnIndex
+		c.level = leaf.MaxDefinitionLevel
+		s.columns = append(s.columns, c)
+	}
+	return s
+}
+
+// row converts the transformed fields of a measurement to a row. Missing values of
+// optional columns are stored as nulls.
+func (s *schema) row(fields map[string]any) (parquetgo.Row, error) {
+	row := make(parquetgo.Row, len(s.columns))
+	for _, c := range s.columns {
+		v, ok := c.value(fields[c.name])
+		switch {
+		case ok:
+			row[c.index] = v.Level(0, c.level, c.index)
+		case c.required:
+			return nil, fmt.Errorf("missing value for column %s", c.name)
+		default:
+			row[c.index] = parquetgo.NullValue().Level(0, 0, c.index)
+		}
+	}
+	return row, nil
+}
+
+func (c column) value(value any) (parquetgo.Value, bool) {
+	if value == nil {
+		return parquetgo.Value{}, false
+	}
+	switch c.typ {
+	case typeTimestamp:
+		ts, ok := value.(time.Time)
+		if !ok || ts.IsZero() {
+			return parquetgo.Value{}, false
+		}
+		return parquetgo.Int64Value(ts.UnixMicro()), true
+	case typeString:
+		s, ok := value.(string)
+		if !ok || s == "" {
+			return parquetgo.Value{}, false
+		}
+		return parquetgo.ByteArrayValue([]byte(s)), true
+	case typeBoolean:
+		b, ok := value.(bool)
+		return parquetgo.BooleanValue(b), ok
+	}
+	if c.typ == typeInt64 {
+		v, ok := exporter.ToInt64(value)
+		return parquetgo.Int64Value(v), ok
+	}
+	v, ok := exporter.ToFloat64(value)
+	return parquetgo.DoubleValue(v), ok
+}
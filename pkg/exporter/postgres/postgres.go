@@ -7,21 +7,32 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/niktheblak/ruuvitag-common/pkg/psql"
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
 
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
 )
 
+// pool is the subset of pgxpool.Pool used by the exporter
+type pool interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Close()
+}
+
 type postgresExporter struct {
 	name       string
-	dbpool     *pgxpool.Pool
+	dbpool     pool
 	connString string
 	query      string
-	columns    map[string]string
-	logger     *slog.Logger
+	// names are the column names of the query arguments in order
+	names   []string
+	columns map[string]string
+	logger  *slog.Logger
 }
 
 func New(ctx context.Context, name string, cfg Config) (exporter.Exporter, error) {
@@ -39,16 +50,14 @@ func New(ctx context.Context, name string, cfg Config) (exporter.Exporter, error
 	if err != nil {
 		return nil, err
 	}
-	q, err := psql.BuildInsertQuery(cfg.Table, cfg.Columns)
-	if err != nil {
-		return nil, err
-	}
+	q, names := insertQuery(cfg.Table, cfg.Columns)
 	cfg.Logger.LogAttrs(ctx, slog.LevelDebug, "Using insert query", slog.String("query", q))
 	e := &postgresExporter{
 		name:       name,
 		dbpool:     dbpool,
 		connString: cfg.ConnString,
 		query:      q,
+		names:      names,
 		columns:    cfg.Columns,
 		logger:     cfg.Logger,
 	}
@@ -60,14 +69,48 @@ func (t *postgresExporter) Name() string {
 }
 
 func (t *postgresExporter) Export(ctx context.Context, data sensor.Data) error {
-	args := psql.BuildQueryArguments(t.columns, data)
-	_, err := t.dbpool.Exec(ctx, t.query, args...)
+	_, err := t.dbpool.Exec(ctx, t.query, t.args(ctx, data)...)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ExportBatch inserts the measurements in a single round trip
+func (t *postgresExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	b := new(pgx.Batch)
+	for _, m := range batch {
+		b.Queue(t.query, t.args(m.Context(ctx), m.Data)...)
+	}
+	return t.dbpool.SendBatch(ctx, b).Close()
+}
+
+// insertQuery returns the insert statement of the mapped columns, including the
+// additional columns computed by processors, and the column names of its arguments
+func insertQuery(table string, columns map[string]string) (string, []string) {
+	var names, quoted, placeholders []string
+	for i, key := range exporter.ColumnOrder(columns) {
+		names = append(names, columns[key])
+		quoted = append(quoted, pgx.Identifier{columns[key]}.Sanitize())
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+	}
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		pgx.Identifier(strings.Split(table, ".")).Sanitize(),
+		strings.Join(quoted, ", "),
+		strings.Join(placeholders, ", "),
+	)
+	return q, names
+}
+
+func (t *postgresExporter) args(ctx context.Context, data sensor.Data) []any {
+	fields := exporter.Transform(ctx, t.columns, data)
+	args := make([]any, len(t.names))
+	for i, name := range t.names {
+		args[i] = fields[name]
+	}
+	return args
+}
+
 func (t *postgresExporter) Close() error {
 	t.dbpool.Close()
 	return nil
@@ -0,0 +1,68 @@
+//go:build postgres
+
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+type mockBatchResults struct {
+	pgx.BatchResults
+}
+
+func (r mockBatchResults) Close() error {
+	return nil
+}
+
+type mockPool struct {
+	batches []*pgx.Batch
+}
+
+func (p *mockPool) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (p *mockPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	p.batches = append(p.batches, b)
+	return mockBatchResults{}
+}
+
+func (p *mockPool) Close() {
+}
+
+func TestExportBatch(t *testing.T) {
+	db := new(mockPool)
+	columns := map[string]string{"time": "time", "name": "name", "temperature": "temperature", "battery_low": "battery_low"}
+	query, names := insertQuery("public.ruuvitag", columns)
+	assert.Equal(t, `INSERT INTO "public"."ruuvitag" ("time", "name", "temperature", "battery_low") VALUES ($1, $2, $3, $4)`, query)
+	exp := &postgresExporter{
+		name:    "postgres",
+		dbpool:  db,
+		query:   query,
+		names:   names,
+		columns: columns,
+	}
+	ts := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	batch := []exporter.Measurement{
+		{Data: sensor.Data{Name: "Backyard", Temperature: 21.5, Timestamp: ts}},
+		{Data: sensor.Data{Name: "Upstairs", Temperature: 22.5, Timestamp: ts}, Extra: map[string]any{"battery_low": true}},
+	}
+	err := exp.ExportBatch(context.Background(), batch)
+	require.NoError(t, err)
+	require.Len(t, db.batches, 1)
+	queries := db.batches[0].QueuedQueries
+	require.Len(t, queries, 2)
+	assert.Equal(t, exp.query, queries[0].SQL)
+	assert.Equal(t, []any{ts, "Upstairs", 22.5, true}, queries[1].Arguments)
+	assert.Nil(t, queries[0].Arguments[3])
+}
@@ -0,0 +1,20 @@
+package prometheus
+
+import (
+	"log/slog"
+	"time"
+)
+
+type Config struct {
+	// Addr is the listen address of the HTTP server. Defaults to :9521.
+	Addr string
+	// Path is the URL path of the metrics endpoint. Defaults to /metrics.
+	Path string
+	// Namespace is the prefix of metric names. Defaults to ruuvitag.
+	Namespace string
+	// StaleTimeout is the time after which the readings of a RuuviTag that hasn't been
+	// heard from are no longer exposed. Defaults to 5 minutes.
+	StaleTimeout time.Duration
+	Columns      map[string]string
+	Logger       *slog.Logger
+}
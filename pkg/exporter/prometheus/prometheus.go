@@ -0,0 +1,204 @@
+//go:build prometheus
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/scanner"
+)
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+type reading struct {
+	addr     string
+	name     string
+	values   map[string]float64
+	lastSeen time.Time
+}
+
+type prometheusExporter struct {
+	cfg      Config
+	server   *http.Server
+	logger   *slog.Logger
+	mu       sync.Mutex
+	readings map[string]*reading
+	stats    scanner.StatsSource
+	labels   []string
+	now      func() time.Time
+}
+
+// New creates an exporter that serves the latest readings of each RuuviTag as Prometheus
+// gauges over HTTP
+func New(cfg Config) (exporter.Exporter, error) {
+	e, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		e,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(e.cfg.Path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	ln, err := net.Listen("tcp", e.cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", e.cfg.Addr, err)
+	}
+	e.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	e.logger.LogAttrs(context.TODO(), slog.LevelInfo, "Serving metrics", slog.String("addr", ln.Addr().String()), slog.String("path", e.cfg.Path))
+	go func() {
+		if err := e.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.logger.LogAttrs(context.TODO(), slog.LevelError, "Metrics server failed", slog.Any("error", err))
+		}
+	}()
+	return e, nil
+}
+
+func newExporter(cfg Config) (*prometheusExporter, error) {
+	if len(cfg.Columns) == 0 {
+		return nil, fmt.Errorf("columns must be non-empty")
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = ":9521"
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/metrics"
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = "ruuvitag"
+	}
+	if cfg.StaleTimeout <= 0 {
+		cfg.StaleTimeout = 5 * time.Minute
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	macLabel := metricName(cfg.Columns["mac"])
+	if macLabel == "" {
+		macLabel = "mac"
+	}
+	nameLabel := metricName(cfg.Columns["name"])
+	if nameLabel == "" {
+		nameLabel = "name"
+	}
+	return &prometheusExporter{
+		cfg:      cfg,
+		logger:   cfg.Logger.With("exporter", "Prometheus"),
+		readings: make(map[string]*reading),
+		labels:   []string{macLabel, nameLabel},
+		now:      time.Now,
+	}, nil
+}
+
+func (e *prometheusExporter) Name() string {
+	return "Prometheus"
+}
+
+func (e *prometheusExporter) Export(ctx context.Context, data sensor.Data) error {
+	values := make(map[string]float64)
+	for column, v := range exporter.NumericFields(ctx, e.cfg.Columns, data) {
+		values[metricName(column)] = v
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.readings[data.Addr] = &reading{
+		addr:     data.Addr,
+		name:     data.Name,
+		values:   values,
+		lastSeen: e.now(),
+	}
+	return nil
+}
+
+func (e *prometheusExporter) SetStatsSource(src scanner.StatsSource) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stats = src
+}
+
+// Describe sends no descriptors which makes the exporter an unchecked collector, since
+// the metrics depend on the columns of the received measurements
+func (e *prometheusExporter) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (e *prometheusExporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	for addr, r := range e.readings {
+		if now.Sub(r.lastSeen) > e.cfg.StaleTimeout {
+			e.logger.LogAttrs(context.TODO(), slog.LevelInfo, "RuuviTag went stale", slog.String("addr", addr), slog.String("name", r.name))
+			delete(e.readings, addr)
+			continue
+		}
+		for metric, v := range r.values {
+			desc := prometheus.NewDesc(prometheus.BuildFQName(e.cfg.Namespace, "", metric), "Latest "+metric+" reading of the RuuviTag", e.labels, nil)
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, r.addr, r.name)
+		}
+		desc := prometheus.NewDesc(prometheus.BuildFQName(e.cfg.Namespace, "", "last_seen_timestamp_seconds"), "Time of the latest measurement of the RuuviTag", e.labels, nil)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(r.lastSeen.UnixNano())/1e9, r.addr, r.name)
+	}
+	if e.stats != nil {
+		e.collectStats(ch)
+	}
+}
+
+// collectStats sends the self-metrics of the collector
+func (e *prometheusExporter) collectStats(ch chan<- prometheus.Metric) {
+	scan := e.stats.ScanStats()
+	ch <- prometheus.MustNewConstMetric(e.desc("advertisements_total", "Number of BLE advertisements received from RuuviTags"), prometheus.CounterValue, float64(scan.Advertisements))
+	ch <- prometheus.MustNewConstMetric(e.desc("parse_errors_total", "Number of BLE advertisements that could not be parsed"), prometheus.CounterValue, float64(scan.ParseErrors))
+	for proc, fields := range scan.Rejections {
+		for field, n := range fields {
+			ch <- prometheus.MustNewConstMetric(e.desc("rejected_values_total", "Number of field values rejected by a processor", "processor", "field"), prometheus.CounterValue, float64(n), proc, field)
+		}
+	}
+	for _, q := range e.stats.QueueStats() {
+		ch <- prometheus.MustNewConstMetric(e.desc("queue_depth", "Number of measurements waiting to be exported", "exporter"), prometheus.GaugeValue, float64(q.Depth), q.Exporter)
+		ch <- prometheus.MustNewConstMetric(e.desc("queue_capacity", "Maximum number of measurements waiting to be exported", "exporter"), prometheus.GaugeValue, float64(q.Capacity), q.Exporter)
+		ch <- prometheus.MustNewConstMetric(e.desc("queue_spilled_bytes", "Size of measurements spilled to disk", "exporter"), prometheus.GaugeValue, float64(q.Spilled), q.Exporter)
+		ch <- prometheus.MustNewConstMetric(e.desc("exported_total", "Number of exported measurements", "exporter"), prometheus.CounterValue, float64(q.Exported), q.Exporter)
+		ch <- prometheus.MustNewConstMetric(e.desc("export_failures_total", "Number of measurements that failed to export", "exporter"), prometheus.CounterValue, float64(q.Failed), q.Exporter)
+		ch <- prometheus.MustNewConstMetric(e.desc("queue_dropped_total", "Number of measurements dropped from a full queue", "exporter"), prometheus.CounterValue, float64(q.Dropped), q.Exporter)
+		ch <- prometheus.MustNewConstMetric(e.desc("queue_latency_seconds", "Moving average of the time from queuing a measurement to exporting it", "exporter"), prometheus.GaugeValue, q.Latency.Seconds(), q.Exporter)
+	}
+}
+
+func (e *prometheusExporter) desc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(e.cfg.Namespace, "collector", name), help, labels, nil)
+}
+
+func (e *prometheusExporter) Close() error {
+	if e.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return e.server.Shutdown(ctx)
+}
+
+func metricName(column string) string {
+	return invalidMetricChars.ReplaceAllString(column, "_")
+}
@@ -0,0 +1,109 @@
+//go:build prometheus
+
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/scanner"
+)
+
+var columns = map[string]string{
+	"time":        "time",
+	"mac":         "mac",
+	"name":        "name",
+	"temperature": "temperature",
+	"humidity":    "humidity",
+}
+
+type mockStats struct{}
+
+func (mockStats) ScanStats() scanner.ScanStats {
+	return scanner.ScanStats{Advertisements: 12, ParseErrors: 2, Rejections: map[string]map[string]uint64{"outlier": {"temperature": 3}}}
+}
+
+func (mockStats) QueueStats() []scanner.QueueStats {
+	return []scanner.QueueStats{{Exporter: "InfluxDB", Depth: 3, Capacity: 100, Exported: 7}}
+}
+
+func scrape(t *testing.T, e *prometheusExporter) string {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(e))
+	srv := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestExport(t *testing.T) {
+	e, err := newExporter(Config{Columns: columns})
+	require.NoError(t, err)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	require.NoError(t, e.Export(context.Background(), sensor.Data{
+		Addr:        "CC:CA:7E:52:CC:34",
+		Name:        "Backyard",
+		Temperature: 21.5,
+		Humidity:    60,
+		Timestamp:   now,
+	}))
+	e.SetStatsSource(mockStats{})
+	body := scrape(t, e)
+	assert.Contains(t, body, `ruuvitag_temperature{mac="CC:CA:7E:52:CC:34",name="Backyard"} 21.5`)
+	assert.Contains(t, body, `ruuvitag_humidity{mac="CC:CA:7E:52:CC:34",name="Backyard"} 60`)
+	assert.Contains(t, body, `ruuvitag_last_seen_timestamp_seconds{mac="CC:CA:7E:52:CC:34",name="Backyard"} 1.7145648e+09`)
+	assert.NotContains(t, body, "ruuvitag_time")
+	assert.Contains(t, body, "ruuvitag_collector_advertisements_total 12")
+	assert.Contains(t, body, "ruuvitag_collector_parse_errors_total 2")
+	assert.Contains(t, body, `ruuvitag_collector_rejected_values_total{field="temperature",processor="outlier"} 3`)
+	assert.Contains(t, body, `ruuvitag_collector_queue_depth{exporter="InfluxDB"} 3`)
+	assert.Contains(t, body, `ruuvitag_collector_exported_total{exporter="InfluxDB"} 7`)
+}
+
+func TestStaleTimeout(t *testing.T) {
+	e, err := newExporter(Config{Columns: columns, StaleTimeout: time.Minute})
+	require.NoError(t, err)
+	now := time.Now()
+	e.now = func() time.Time { return now }
+	require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.5}))
+	require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "FB:E1:B7:04:95:EE", Name: "Upstairs", Temperature: 22}))
+	now = now.Add(45 * time.Second)
+	require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "FB:E1:B7:04:95:EE", Name: "Upstairs", Temperature: 22.5}))
+	now = now.Add(30 * time.Second)
+	body := scrape(t, e)
+	assert.NotContains(t, body, "Backyard")
+	assert.Contains(t, body, `ruuvitag_temperature{mac="FB:E1:B7:04:95:EE",name="Upstairs"} 22.5`)
+}
+
+func TestCustomColumns(t *testing.T) {
+	e, err := newExporter(Config{
+		Namespace: "home",
+		Columns: map[string]string{
+			"mac":         "address",
+			"name":        "location",
+			"temperature": "temp-c",
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, e.Export(context.Background(), sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.5}))
+	body := scrape(t, e)
+	assert.Contains(t, body, `home_temp_c{address="CC:CA:7E:52:CC:34",location="Backyard"} 21.5`)
+}
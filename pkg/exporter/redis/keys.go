@@ -0,0 +1,22 @@
+package redis
+
+import (
+	"strings"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+// streamKey returns the key of the stream of the RuuviTag, <prefix>:<MAC without colons>
+func streamKey(prefix string, data sensor.Data) string {
+	return prefix + ":" + strings.ReplaceAll(data.Addr, ":", "")
+}
+
+// latestKey returns the key of the hash of the latest values of the RuuviTag
+func latestKey(prefix string, data sensor.Data) string {
+	return streamKey(prefix, data) + ":latest"
+}
+
+// timeSeriesKey returns the key of the time series of a column of the RuuviTag
+func timeSeriesKey(prefix string, data sensor.Data, column string) string {
+	return streamKey(prefix, data) + ":" + column
+}
@@ -0,0 +1,25 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+func TestKeys(t *testing.T) {
+	data := sensor.Data{Addr: "CC:CA:7E:52:CC:34"}
+	assert.Equal(t, "ruuvitag:CCCA7E52CC34", streamKey(DefaultKeyPrefix, data))
+	assert.Equal(t, "ruuvitag:CCCA7E52CC34:latest", latestKey(DefaultKeyPrefix, data))
+	assert.Equal(t, "home:CCCA7E52CC34:temperature", timeSeriesKey("home", data, "temperature"))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(Config{URL: "redis://localhost:6379"}))
+	assert.NoError(t, Validate(Config{URL: "redis://localhost:6379", Mode: ModeTimeSeries, Retention: time.Hour}))
+	assert.Error(t, Validate(Config{}))
+	assert.Error(t, Validate(Config{URL: "redis://localhost:6379", Mode: "list"}))
+	assert.Error(t, Validate(Config{URL: "redis://localhost:6379", MaxLen: -1}))
+}
@@ -0,0 +1,157 @@
+//go:build redis
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/tlsconfig"
+)
+
+// timestampField is the field of the latest values hash that holds the time of the
+// measurement in Unix milliseconds
+const timestampField = "_timestamp"
+
+// setLatest replaces the hash of the latest values with the values of the measurement
+// unless the hash holds a newer measurement. ARGV is the time of the measurement in Unix
+// milliseconds followed by the fields and values.
+var setLatest = goredis.NewScript(`
+local current = redis.call('HGET', KEYS[1], '` + timestampField + `')
+if current and tonumber(current) > tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], '` + timestampField + `', unpack(ARGV))
+return 1
+`)
+
+type redisExporter struct {
+	cfg    Config
+	client *goredis.Client
+	logger *slog.Logger
+}
+
+// New creates an exporter that adds the measurements to a Redis stream or RedisTimeSeries
+// keys per RuuviTag and keeps the latest values of each RuuviTag in a hash
+func New(cfg Config) (exporter.Exporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeStream
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = DefaultKeyPrefix
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	opts, err := goredis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	opts.ClientName = "ruuvitag-gollector"
+	if cfg.TLS.Enabled() {
+		opts.TLSConfig, err = tlsconfig.New(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &redisExporter{
+		cfg:    cfg,
+		client: goredis.NewClient(opts),
+		logger: cfg.Logger.With("exporter", "Redis"),
+	}, nil
+}
+
+func (e *redisExporter) Name() string {
+	return fmt.Sprintf("Redis (%s)", e.cfg.Mode)
+}
+
+func (e *redisExporter) Export(ctx context.Context, data sensor.Data) error {
+	return e.ExportBatch(ctx, []exporter.Measurement{{Data: data, Extra: exporter.ExtraColumns(ctx)}})
+}
+
+// ExportBatch writes the measurements in a single pipeline
+func (e *redisExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	_, err := e.client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		for _, m := range batch {
+			mctx := m.Context(ctx)
+			values := e.values(mctx, m.Data)
+			switch e.cfg.Mode {
+			case ModeTimeSeries:
+				e.addTimeSeries(mctx, p, m.Data)
+			default:
+				p.XAdd(mctx, &goredis.XAddArgs{
+					Stream: streamKey(e.cfg.KeyPrefix, m.Data),
+					MaxLen: e.cfg.MaxLen,
+					Approx: e.cfg.MaxLen > 0,
+					Values: values,
+				})
+			}
+			args := []any{m.Data.Timestamp.UnixMilli()}
+			for _, column := range slices.Sorted(maps.Keys(values)) {
+				args = append(args, column, values[column])
+			}
+			setLatest.Eval(mctx, p, []string{latestKey(e.cfg.KeyPrefix, m.Data)}, args...)
+		}
+		return nil
+	})
+	return exportError(err)
+}
+
+func (e *redisExporter) values(ctx context.Context, data sensor.Data) map[string]any {
+	fields := exporter.Transform(ctx, e.cfg.Columns, data)
+	values := make(map[string]any, len(fields))
+	for column, value := range fields {
+		values[column] = exporter.FormatValue(value)
+	}
+	return values
+}
+
+func (e *redisExporter) addTimeSeries(ctx context.Context, p goredis.Pipeliner, data sensor.Data) {
+	ts := data.Timestamp.UnixMilli()
+	for column, value := range exporter.NumericFields(ctx, e.cfg.Columns, data) {
+		// The options only apply when the time series is created by the first sample
+		p.TSAddWithArgs(ctx, timeSeriesKey(e.cfg.KeyPrefix, data, column), ts, value, &goredis.TSOptions{
+			Retention:       int(e.cfg.Retention.Milliseconds()),
+			DuplicatePolicy: "LAST",
+			Labels: map[string]string{
+				"mac":   data.Addr,
+				"name":  data.Name,
+				"field": column,
+			},
+		})
+	}
+}
+
+// exportError marks the error replies of Redis as permanent, except for the replies of
+// a server that is temporarily unable to serve requests
+func exportError(err error) error {
+	var redisErr goredis.Error
+	if !errors.As(err, &redisErr) {
+		return err
+	}
+	for _, prefix := range []string{"LOADING", "READONLY", "BUSY", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN", "MOVED", "ASK"} {
+		if strings.HasPrefix(err.Error(), prefix+" ") {
+			return err
+		}
+	}
+	return exporter.Permanent(err)
+}
+
+func (e *redisExporter) Close() error {
+	return e.client.Close()
+}
@@ -0,0 +1,203 @@
+//go:build redis
+
+package redis
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
+)
+
+func newExporter(t *testing.T, cfg Config) (*redisExporter, *miniredis.Miniredis) {
+	t.Helper()
+	s := miniredis.RunT(t)
+	cfg.URL = "redis://" + s.Addr()
+	exp, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		exp.Close()
+	})
+	return exp.(*redisExporter), s
+}
+
+func TestStream(t *testing.T) {
+	exp, s := newExporter(t, Config{MaxLen: 2, Columns: map[string]string{
+		"time":                     "time",
+		"mac":                      "mac",
+		"name":                     "name",
+		"temperature":              "temperature",
+		"movement_counter":         "movement_counter",
+		processor.BatteryLowColumn: "battery_low",
+	}})
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ctx := exporter.WithExtraColumns(context.Background(), map[string]any{processor.BatteryLowColumn: true})
+	require.NoError(t, exp.Export(ctx, sensor.Data{Addr: "CC:CA:7E:52:CC:34", Timestamp: ts}))
+	require.NoError(t, exp.ExportBatch(context.Background(), []exporter.Measurement{
+		{Data: sensor.Data{Addr: "CC:CA:7E:52:CC:34", Timestamp: ts.Add(time.Minute)}},
+		{Data: sensor.Data{Addr: "FB:E1:B7:04:95:EE", Name: "Living room", Timestamp: ts.Add(time.Minute)}},
+		{Data: sensor.Data{
+			Addr:            "CC:CA:7E:52:CC:34",
+			Name:            "Backyard",
+			Temperature:     21.5,
+			MovementCounter: 42,
+			Timestamp:       ts.Add(2 * time.Minute),
+		}},
+	}))
+
+	// The stream is trimmed to the two latest measurements
+	entries, err := s.Stream("ruuvitag:CCCA7E52CC34")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	values := make(map[string]string)
+	for i := 0; i < len(entries[1].Values); i += 2 {
+		values[entries[1].Values[i]] = entries[1].Values[i+1]
+	}
+	assert.Equal(t, map[string]string{
+		"time":             "2024-05-01T12:02:00Z",
+		"mac":              "CC:CA:7E:52:CC:34",
+		"name":             "Backyard",
+		"temperature":      "21.5",
+		"movement_counter": "42",
+	}, values)
+	entries, err = s.Stream("ruuvitag:FBE1B70495EE")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Equal(t, "21.5", s.HGet("ruuvitag:CCCA7E52CC34:latest", "temperature"))
+	assert.Equal(t, "2024-05-01T12:02:00Z", s.HGet("ruuvitag:CCCA7E52CC34:latest", "time"))
+	// The battery_low column of the first measurement is not kept since the later ones do not have it
+	fields, err := s.HKeys("ruuvitag:CCCA7E52CC34:latest")
+	require.NoError(t, err)
+	assert.NotContains(t, fields, "battery_low")
+	assert.Equal(t, "Living room", s.HGet("ruuvitag:FBE1B70495EE:latest", "name"))
+}
+
+// tsRecorder records the RedisTimeSeries commands of pipelines, which miniredis does
+// not support, and passes the other commands through
+type tsRecorder struct {
+	mu   sync.Mutex
+	args [][]any
+}
+
+func (r *tsRecorder) DialHook(next goredis.DialHook) goredis.DialHook {
+	return next
+}
+
+func (r *tsRecorder) ProcessHook(next goredis.ProcessHook) goredis.ProcessHook {
+	return next
+}
+
+func (r *tsRecorder) ProcessPipelineHook(next goredis.ProcessPipelineHook) goredis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []goredis.Cmder) error {
+		var rest []goredis.Cmder
+		for _, cmd := range cmds {
+			if cmd.Name() == "ts.add" {
+				r.mu.Lock()
+				r.args = append(r.args, cmd.Args())
+				r.mu.Unlock()
+				cmd.(*goredis.IntCmd).SetVal(0)
+				continue
+			}
+			rest = append(rest, cmd)
+		}
+		return next(ctx, rest)
+	}
+}
+
+func TestTimeSeries(t *testing.T) {
+	exp, s := newExporter(t, Config{Mode: ModeTimeSeries, KeyPrefix: "home", Retention: 24 * time.Hour, Columns: map[string]string{
+		"time":                     "time",
+		"mac":                      "mac",
+		"name":                     "name",
+		"temperature":              "temperature",
+		"movement_counter":         "movement_counter",
+		processor.BatteryLowColumn: "battery_low",
+	}})
+	recorder := new(tsRecorder)
+	exp.client.AddHook(recorder)
+	ctx := exporter.WithExtraColumns(context.Background(), map[string]any{processor.BatteryLowColumn: false})
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, exp.Export(ctx, sensor.Data{
+		Addr:            "CC:CA:7E:52:CC:34",
+		Name:            "Backyard",
+		Temperature:     20.5,
+		MovementCounter: 42,
+		Timestamp:       start,
+	}))
+
+	require.Len(t, recorder.args, 3)
+	byKey := make(map[string][]any)
+	for _, args := range recorder.args {
+		byKey[args[1].(string)] = args
+	}
+	labels := []any{"LABELS", "mac", "CC:CA:7E:52:CC:34", "name", "Backyard", "field"}
+	ts := start.UnixMilli()
+	args := byKey["home:CCCA7E52CC34:temperature"]
+	require.NotNil(t, args)
+	assert.Equal(t, []any{"TS.ADD", "home:CCCA7E52CC34:temperature", ts, 20.5, "RETENTION", 86400000, "DUPLICATE_POLICY", "LAST"}, args[:8])
+	assert.Subset(t, args[8:], labels)
+	assert.Contains(t, args[8:], "temperature")
+	assert.Equal(t, 42.0, byKey["home:CCCA7E52CC34:movement_counter"][3])
+	assert.Equal(t, 0.0, byKey["home:CCCA7E52CC34:battery_low"][3])
+
+	// The latest values are kept in a hash as with streams
+	assert.Equal(t, "20.5", s.HGet("home:CCCA7E52CC34:latest", "temperature"))
+	assert.False(t, s.Exists("home:CCCA7E52CC34"))
+}
+
+func TestLatestOutOfOrder(t *testing.T) {
+	exp, s := newExporter(t, Config{Columns: map[string]string{"time": "time", "temperature": "temperature"}})
+	ctx := context.Background()
+	ts := time.Date(2024, 5, 1, 12, 1, 0, 0, time.UTC)
+	require.NoError(t, exp.Export(ctx, sensor.Data{Addr: "CC:CA:7E:52:CC:34", Temperature: 21.5, Timestamp: ts}))
+	// An older measurement exported late does not replace the latest values
+	require.NoError(t, exp.Export(ctx, sensor.Data{Addr: "CC:CA:7E:52:CC:34", Temperature: 20.5, Timestamp: ts.Add(-time.Minute)}))
+	assert.Equal(t, "21.5", s.HGet("ruuvitag:CCCA7E52CC34:latest", "temperature"))
+	assert.Equal(t, "2024-05-01T12:01:00Z", s.HGet("ruuvitag:CCCA7E52CC34:latest", "time"))
+	assert.Equal(t, strconv.FormatInt(ts.UnixMilli(), 10), s.HGet("ruuvitag:CCCA7E52CC34:latest", timestampField))
+	// The stream still has both
+	entries, err := s.Stream("ruuvitag:CCCA7E52CC34")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestErrors(t *testing.T) {
+	exp, s := newExporter(t, Config{Columns: map[string]string{"temperature": "temperature"}})
+	ctx := context.Background()
+	measurement := sensor.Data{Addr: "CC:CA:7E:52:CC:34"}
+
+	// An error reply is permanent
+	require.NoError(t, s.Set("ruuvitag:CCCA7E52CC34:latest", "not a hash"))
+	err := exp.Export(ctx, measurement)
+	require.Error(t, err)
+	assert.True(t, exporter.IsPermanent(err), err)
+
+	// A server that is loading its data set can be retried
+	s.Del("ruuvitag:CCCA7E52CC34:latest")
+	s.SetError("LOADING Redis is loading the dataset in memory")
+	err = exp.Export(ctx, measurement)
+	require.Error(t, err)
+	assert.False(t, exporter.IsPermanent(err), err)
+	s.SetError("")
+
+	// So can a server that cannot be reached
+	s.Close()
+	err = exp.Export(ctx, measurement)
+	require.Error(t, err)
+	var netErr net.Error
+	assert.ErrorAs(t, err, &netErr)
+	assert.False(t, exporter.IsPermanent(err), err)
+}
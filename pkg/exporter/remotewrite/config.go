@@ -0,0 +1,65 @@
+package remotewrite
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+type Config struct {
+	// URL is the remote-write endpoint of the receiver, such as http://localhost:9009/api/v1/push
+	URL string
+	// Prefix is prepended to the column names to form metric names. Defaults to ruuvitag.
+	Prefix string
+	// Labels are added to every time series
+	Labels   map[string]string
+	Username string
+	Password string
+	// Token is sent as a bearer token. Basic auth is used instead if Username is set.
+	Token string
+	// FlushInterval is the interval at which buffered samples are sent. Defaults to 15 seconds.
+	FlushInterval time.Duration
+	// MaxSamples is the number of buffered samples after which the samples are sent
+	// immediately. Defaults to 5000.
+	MaxSamples int
+	// MaxPending is the maximum number of samples kept for resending while the receiver is
+	// unavailable. The oldest samples are dropped first. Defaults to 50000.
+	MaxPending int
+	Timeout    time.Duration
+	Columns    map[string]string
+	Logger     *slog.Logger
+}
+
+func Validate(cfg Config) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("remote-write URL must be specified")
+	}
+	if len(cfg.Columns) == 0 {
+		return fmt.Errorf("columns must be non-empty")
+	}
+	if cfg.Username != "" && cfg.Token != "" {
+		return fmt.Errorf("only one of username and token can be specified")
+	}
+	// Receivers reject time series with duplicate label names
+	names := map[string]bool{"__name__": true}
+	for _, column := range []string{"mac", "name"} {
+		if name, ok := cfg.Columns[column]; ok {
+			names[sanitize(name)] = true
+		}
+	}
+	for k := range cfg.Labels {
+		name := sanitize(k)
+		if names[name] {
+			return fmt.Errorf("label %s conflicts with another label", k)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+func sanitize(name string) string {
+	return invalidNameChars.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,220 @@
+//go:build prometheus
+
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+type remoteWriteExporter struct {
+	cfg     Config
+	client  *http.Client
+	logger  *slog.Logger
+	mu      sync.Mutex
+	pending []sample
+	sendMu  sync.Mutex
+	full    chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// New creates an exporter that pushes measurements to a Prometheus remote-write receiver
+// such as Mimir, VictoriaMetrics or Thanos. Samples are buffered and sent every
+// cfg.FlushInterval, or sooner when cfg.MaxSamples samples have been buffered.
+func New(cfg Config) (exporter.Exporter, error) {
+	e, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	go e.run(ctx)
+	return e, nil
+}
+
+func newExporter(cfg Config) (*remoteWriteExporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "ruuvitag"
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 15 * time.Second
+	}
+	if cfg.MaxSamples <= 0 {
+		cfg.MaxSamples = 5000
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 50000
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &remoteWriteExporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		logger: cfg.Logger.With("exporter", "Prometheus remote-write"),
+		full:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+func (e *remoteWriteExporter) Name() string {
+	return fmt.Sprintf("Prometheus remote-write (%s)", e.cfg.URL)
+}
+
+func (e *remoteWriteExporter) Export(ctx context.Context, data sensor.Data) error {
+	ts := data.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var samples []sample
+	for column, v := range exporter.NumericFields(ctx, e.cfg.Columns, data) {
+		samples = append(samples, sample{
+			labels:    e.labels(column, data),
+			value:     v,
+			timestamp: ts.UnixMilli(),
+		})
+	}
+	e.mu.Lock()
+	e.pending = append(e.pending, samples...)
+	full := len(e.pending) >= e.cfg.MaxSamples
+	e.mu.Unlock()
+	if full {
+		// Send errors are logged by the flush loop. Returning them here would make
+		// wrapping exporters retry samples that are already buffered.
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// labels returns the sorted labels of the time series of the column
+func (e *remoteWriteExporter) labels(column string, data sensor.Data) []label {
+	labels := []label{{name: "__name__", value: sanitize(e.cfg.Prefix + "_" + column)}}
+	if mac, ok := e.cfg.Columns["mac"]; ok {
+		labels = append(labels, label{name: sanitize(mac), value: strings.ToUpper(data.Addr)})
+	}
+	if name, ok := e.cfg.Columns["name"]; ok && data.Name != "" {
+		labels = append(labels, label{name: sanitize(name), value: data.Name})
+	}
+	for k, v := range e.cfg.Labels {
+		labels = append(labels, label{name: sanitize(k), value: v})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+	return labels
+}
+
+func (e *remoteWriteExporter) run(ctx context.Context) {
+	defer close(e.done)
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.full:
+		}
+		if err := e.flush(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			e.logger.LogAttrs(ctx, slog.LevelError, "Failed to send samples", slog.Any("error", err))
+		}
+	}
+}
+
+// flush sends the buffered samples. Samples that could not be sent because of a
+// recoverable error are kept for the next flush.
+func (e *remoteWriteExporter) flush(ctx context.Context) error {
+	e.sendMu.Lock()
+	defer e.sendMu.Unlock()
+	e.mu.Lock()
+	samples := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(samples) == 0 {
+		return nil
+	}
+	err := e.send(ctx, samples)
+	if err == nil || exporter.IsPermanent(err) {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append(samples, e.pending...)
+	if dropped := len(e.pending) - e.cfg.MaxPending; dropped > 0 {
+		e.logger.LogAttrs(ctx, slog.LevelWarn, "Dropping oldest samples", slog.Int("dropped", dropped))
+		e.pending = e.pending[dropped:]
+	}
+	return err
+}
+
+func (e *remoteWriteExporter) send(ctx context.Context, samples []sample) error {
+	body := snappy.Encode(nil, marshalWriteRequest(samples))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return exporter.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("User-Agent", "ruuvitag-gollector")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case e.cfg.Username != "":
+		req.SetBasicAuth(e.cfg.Username, e.cfg.Password)
+	case e.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+e.cfg.Token)
+	}
+	e.logger.LogAttrs(ctx, slog.LevelDebug, "Sending samples", slog.Int("samples", len(samples)), slog.Int("bytes", len(body)))
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote-write receiver returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		// The receiver rejected the samples, so sending them again would fail as well
+		return exporter.Permanent(err)
+	}
+	return err
+}
+
+func (e *remoteWriteExporter) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+		<-e.done
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+	defer cancel()
+	err := e.flush(ctx)
+	e.client.CloseIdleConnections()
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !prometheus
+
+package remotewrite
+
+import (
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+func New(cfg Config) (exporter.Exporter, error) {
+	return exporter.NoOp{ReportedName: "Prometheus remote-write"}, nil
+}
@@ -0,0 +1,271 @@
+//go:build prometheus
+
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+var (
+	columns = map[string]string{
+		"time":        "time",
+		"mac":         "mac",
+		"name":        "name",
+		"temperature": "temperature",
+		"humidity":    "humidity",
+	}
+	ts = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+type receivedSeries struct {
+	labels  map[string]string
+	values  []float64
+	stamps  []int64
+	rawKeys []string
+}
+
+// receiver is a remote-write endpoint that decodes the received write requests
+type receiver struct {
+	mu       sync.Mutex
+	series   []receivedSeries
+	headers  []http.Header
+	statuses []int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.headers = append(r.headers, req.Header.Clone())
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	series, err := decodeWriteRequest(data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.series = append(r.series, series...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *receiver) received() []receivedSeries {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedSeries(nil), r.series...)
+}
+
+func (r *receiver) find(name string) (receivedSeries, bool) {
+	for _, s := range r.received() {
+		if s.labels["__name__"] == name {
+			return s, true
+		}
+	}
+	return receivedSeries{}, false
+}
+
+func decodeWriteRequest(b []byte) ([]receivedSeries, error) {
+	var series []receivedSeries
+	err := decodeFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		s := receivedSeries{labels: make(map[string]string)}
+		err := decodeFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+			switch num {
+			case 1:
+				var name, value string
+				err := decodeFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+					return nil
+				})
+				s.labels[name] = value
+				s.rawKeys = append(s.rawKeys, name)
+				return err
+			case 2:
+				return decodeFields(v, func(num protowire.Number, _ []byte, n uint64) error {
+					if num == 1 {
+						s.values = append(s.values, math.Float64frombits(n))
+					} else {
+						s.stamps = append(s.stamps, int64(n))
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		series = append(series, s)
+		return err
+	})
+	return series, err
+}
+
+// decodeFields calls fn for each length-delimited, varint or fixed64 field of the message
+func decodeFields(b []byte, fn func(num protowire.Number, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var (
+			v []byte
+			x uint64
+		)
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	recv := new(receiver)
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+	e, err := newExporter(Config{
+		URL:      srv.URL,
+		Prefix:   "home",
+		Labels:   map[string]string{"site": "cabin"},
+		Username: "user",
+		Password: "secret",
+		Columns:  columns,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, e.Export(ctx, sensor.Data{Addr: "cc:ca:7e:52:cc:34", Name: "Backyard", Temperature: 21.5, Humidity: 60, Timestamp: ts}))
+	require.NoError(t, e.Export(ctx, sensor.Data{Addr: "cc:ca:7e:52:cc:34", Name: "Backyard", Temperature: 21.7, Humidity: 61, Timestamp: ts.Add(time.Minute)}))
+	require.NoError(t, e.flush(ctx))
+
+	require.Len(t, recv.received(), 2)
+	temperature, ok := recv.find("home_temperature")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{
+		"__name__": "home_temperature",
+		"mac":      "CC:CA:7E:52:CC:34",
+		"name":     "Backyard",
+		"site":     "cabin",
+	}, temperature.labels)
+	assert.IsIncreasing(t, temperature.rawKeys, "labels must be sorted by name")
+	assert.Equal(t, []float64{21.5, 21.7}, temperature.values)
+	assert.Equal(t, []int64{ts.UnixMilli(), ts.Add(time.Minute).UnixMilli()}, temperature.stamps)
+	humidity, ok := recv.find("home_humidity")
+	require.True(t, ok)
+	assert.Equal(t, []float64{60, 61}, humidity.values)
+
+	header := recv.headers[0]
+	assert.Equal(t, "snappy", header.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", header.Get("Content-Type"))
+	assert.Equal(t, "0.1.0", header.Get("X-Prometheus-Remote-Write-Version"))
+	user, pass, ok := (&http.Request{Header: header}).BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", pass)
+	require.NoError(t, e.Close())
+}
+
+func TestRetryPendingSamples(t *testing.T) {
+	recv := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+	e, err := newExporter(Config{URL: srv.URL, Token: "abc123", Columns: columns})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, e.Export(ctx, sensor.Data{Addr: "CC:CA:7E:52:CC:34", Name: "Backyard", Temperature: 21.5, Timestamp: ts}))
+	assert.Error(t, e.flush(ctx))
+	assert.Empty(t, recv.received())
+	// The samples are sent again with the next flush
+	require.NoError(t, e.flush(ctx))
+	temperature, ok := recv.find("ruuvitag_temperature")
+	require.True(t, ok)
+	assert.Equal(t, []float64{21.5}, temperature.values)
+	assert.Equal(t, "Bearer abc123", recv.headers[1].Get("Authorization"))
+}
+
+func TestRejectedSamples(t *testing.T) {
+	recv := &receiver{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+	e, err := newExporter(Config{URL: srv.URL, Columns: columns})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, e.Export(ctx, sensor.Data{Addr: "CC:CA:7E:52:CC:34", Temperature: 21.5, Timestamp: ts}))
+	assert.Error(t, e.flush(ctx))
+	require.NoError(t, e.flush(ctx))
+	assert.Len(t, recv.headers, 1, "rejected samples are not sent again")
+}
+
+func TestFlushWhenFull(t *testing.T) {
+	recv := new(receiver)
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+	exp, err := New(Config{URL: srv.URL, FlushInterval: time.Hour, MaxSamples: 4, Columns: columns})
+	require.NoError(t, err)
+	ctx := context.Background()
+	for i := range 2 {
+		require.NoError(t, exp.Export(ctx, sensor.Data{Addr: "CC:CA:7E:52:CC:34", Temperature: 21.5, Humidity: 60, Timestamp: ts.Add(time.Duration(i) * time.Second)}))
+	}
+	assert.Eventually(t, func() bool {
+		return len(recv.received()) == 2
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, exp.Close())
+}
+
+func TestValidateLabels(t *testing.T) {
+	cfg := Config{URL: "http://localhost:9009/api/v1/push", Columns: columns}
+	cfg.Labels = map[string]string{"location": "home", "site-id": "1"}
+	assert.NoError(t, Validate(cfg))
+	for _, labels := range []map[string]string{
+		{"__name__": "ruuvitag"},
+		{"mac": "CC:CA:7E:52:CC:34"},
+		{"name": "Backyard"},
+		{"site-id": "1", "site.id": "2"},
+	} {
+		cfg.Labels = labels
+		assert.Error(t, Validate(cfg), labels)
+	}
+}
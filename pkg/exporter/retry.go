@@ -0,0 +1,298 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+)
+
+// ErrCircuitOpen is returned by exporters wrapped with WithRetry while the circuit breaker
+// is open after repeated failures
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an export error as permanent so that the export is not retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent returns true if the error has been marked permanent with Permanent
+func IsPermanent(err error) bool {
+	var pe permanentError
+	return errors.As(err, &pe)
+}
+
+// IsRetryable is the default classification of export errors. Permanent errors and
+// canceled exports are not retried.
+func IsRetryable(err error) bool {
+	return !IsPermanent(err) && !errors.Is(err, context.Canceled)
+}
+
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of export attempts per measurement. Defaults to 3.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Defaults to 1 second.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between retries. Defaults to 30 seconds.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay is multiplied with after each retry. Defaults to 2.
+	Multiplier float64
+	// FailureThreshold is the number of consecutive failed exports after which the circuit
+	// breaker opens. Defaults to 5. A negative value disables the circuit breaker.
+	FailureThreshold int
+	// OpenTimeout is the time the circuit breaker stays open before a trial export is
+	// allowed. Defaults to 1 minute.
+	OpenTimeout time.Duration
+	// Retryable decides whether an export error is retried. Defaults to IsRetryable.
+	Retryable func(err error) bool
+	Logger    *slog.Logger
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type retryExporter struct {
+	exp      Exporter
+	cfg      RetryConfig
+	logger   *slog.Logger
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+type eventRetryExporter struct {
+	*retryExporter
+	events EventExporter
+}
+
+// WithRetry wraps the exporter so that failed exports are retried with exponential backoff.
+// After cfg.FailureThreshold consecutive failed exports, exports fail immediately with
+// ErrCircuitOpen until cfg.OpenTimeout has passed and a trial export succeeds.
+func WithRetry(exp Exporter, cfg RetryConfig) Exporter {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 2
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = time.Minute
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = IsRetryable
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	r := &retryExporter{
+		exp:    exp,
+		cfg:    cfg,
+		logger: cfg.Logger.With("exporter", exp.Name()),
+		now:    time.Now,
+		sleep:  sleep,
+	}
+	if events, ok := exp.(EventExporter); ok {
+		return &eventRetryExporter{retryExporter: r, events: events}
+	}
+	return r
+}
+
+func (r *retryExporter) Name() string {
+	return r.exp.Name()
+}
+
+func (r *retryExporter) Export(ctx context.Context, data sensor.Data) error {
+	return r.do(ctx, func() error {
+		return r.exp.Export(ctx, data)
+	})
+}
+
+func (r *retryExporter) ExportBatch(ctx context.Context, batch []Measurement) error {
+	return r.do(ctx, func() error {
+		return ExportBatch(ctx, r.exp, batch)
+	})
+}
+
+func (r *retryExporter) Unwrap() Exporter {
+	return r.exp
+}
+
+// do calls export until it succeeds, fails with a permanent error or the maximum number
+// of attempts is reached
+func (r *retryExporter) do(ctx context.Context, export func() error) error {
+	if !r.allow(ctx) {
+		return ErrCircuitOpen
+	}
+	backoff := r.cfg.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = export()
+		if err == nil {
+			r.record(ctx, true)
+			return nil
+		}
+		if !r.cfg.Retryable(err) {
+			// Permanent errors are caused by the measurement rather than the backend and
+			// canceled exports tell nothing about the backend either
+			r.release(ctx)
+			return err
+		}
+		if attempt >= r.cfg.MaxAttempts {
+			break
+		}
+		r.logger.LogAttrs(ctx, slog.LevelWarn, "Export failed, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			slog.Any("error", err),
+		)
+		if sleepErr := r.sleep(ctx, jitter(backoff)); sleepErr != nil {
+			err = errors.Join(err, sleepErr)
+			break
+		}
+		backoff = min(time.Duration(float64(backoff)*r.cfg.Multiplier), r.cfg.MaxBackoff)
+	}
+	if errors.Is(err, context.Canceled) {
+		r.release(ctx)
+	} else {
+		r.record(ctx, false)
+	}
+	return err
+}
+
+func (r *retryExporter) Close() error {
+	return r.exp.Close()
+}
+
+func (r *eventRetryExporter) ExportEvent(ctx context.Context, e event.Event) error {
+	return r.events.ExportEvent(ctx, e)
+}
+
+// allow returns true if an export may be attempted in the current circuit breaker state
+func (r *retryExporter) allow(ctx context.Context) bool {
+	if r.cfg.FailureThreshold < 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.state {
+	case circuitOpen:
+		if r.now().Sub(r.openedAt) < r.cfg.OpenTimeout {
+			return false
+		}
+		r.setState(ctx, circuitHalfOpen)
+		return true
+	case circuitHalfOpen:
+		// Only one trial export at a time
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the circuit breaker state after an export
+func (r *retryExporter) record(ctx context.Context, success bool) {
+	if r.cfg.FailureThreshold < 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if success {
+		r.failures = 0
+		if r.state != circuitClosed {
+			r.setState(ctx, circuitClosed)
+		}
+		return
+	}
+	r.failures++
+	if r.state == circuitHalfOpen || r.failures >= r.cfg.FailureThreshold {
+		r.openedAt = r.now()
+		r.setState(ctx, circuitOpen)
+	}
+}
+
+// release ends an export that neither succeeded nor failed because of the backend. The
+// failure count is kept and an interrupted trial export is allowed again right away.
+func (r *retryExporter) release(ctx context.Context) {
+	if r.cfg.FailureThreshold < 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == circuitHalfOpen {
+		r.setState(ctx, circuitOpen)
+	}
+}
+
+func (r *retryExporter) setState(ctx context.Context, state circuitState) {
+	r.logger.LogAttrs(ctx, slog.LevelInfo, "Circuit breaker state changed",
+		slog.String("from", r.state.String()),
+		slog.String("to", state.String()),
+		slog.Int("failures", r.failures),
+	)
+	r.state = state
+}
+
+// jitter randomizes the backoff by up to 20% to avoid synchronized retries
+func jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (0.8 + 0.4*rand.Float64())) //nolint:gosec
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
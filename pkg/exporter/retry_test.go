@@ -0,0 +1,128 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+type failingExporter struct {
+	errs  []error
+	calls int
+}
+
+func (e *failingExporter) Name() string {
+	return "failing"
+}
+
+func (e *failingExporter) Export(ctx context.Context, data sensor.Data) error {
+	e.calls++
+	if len(e.errs) == 0 {
+		return nil
+	}
+	err := e.errs[0]
+	e.errs = e.errs[1:]
+	return err
+}
+
+func (e *failingExporter) Close() error {
+	return nil
+}
+
+func newTestRetry(exp Exporter, cfg RetryConfig) (*retryExporter, *time.Time, *[]time.Duration) {
+	r := WithRetry(exp, cfg).(*retryExporter)
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var sleeps []time.Duration
+	r.now = func() time.Time {
+		return now
+	}
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return r, &now, &sleeps
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	unavailable := errors.New("unavailable")
+	exp := &failingExporter{errs: []error{unavailable, unavailable}}
+	r, _, sleeps := newTestRetry(exp, RetryConfig{MaxAttempts: 3, InitialBackoff: time.Second})
+	require.NoError(t, r.Export(ctx, sensor.Data{}))
+	assert.Equal(t, 3, exp.calls)
+	require.Len(t, *sleeps, 2)
+	assert.InDelta(t, float64(time.Second), float64((*sleeps)[0]), float64(200*time.Millisecond))
+	assert.InDelta(t, float64(2*time.Second), float64((*sleeps)[1]), float64(400*time.Millisecond))
+
+	// Permanent errors are not retried
+	exp = &failingExporter{errs: []error{Permanent(unavailable)}}
+	r, _, _ = newTestRetry(exp, RetryConfig{})
+	err := r.Export(ctx, sensor.Data{})
+	assert.ErrorIs(t, err, unavailable)
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, exp.calls)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	unavailable := errors.New("unavailable")
+	exp := &failingExporter{}
+	for range 4 {
+		exp.errs = append(exp.errs, unavailable)
+	}
+	r, now, _ := newTestRetry(exp, RetryConfig{
+		MaxAttempts:      1,
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+	})
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), unavailable)
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), unavailable)
+	// Circuit is open so the exporter is not called
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), ErrCircuitOpen)
+	assert.Equal(t, 2, exp.calls)
+
+	// Failed trial export opens the circuit again
+	*now = now.Add(time.Minute)
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), unavailable)
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), ErrCircuitOpen)
+	assert.Equal(t, 3, exp.calls)
+
+	// Successful trial export closes the circuit
+	*now = now.Add(time.Minute)
+	exp.errs = nil
+	require.NoError(t, r.Export(ctx, sensor.Data{}))
+	require.NoError(t, r.Export(ctx, sensor.Data{}))
+	assert.Equal(t, 5, exp.calls)
+}
+
+func TestCircuitBreakerNeutralErrors(t *testing.T) {
+	ctx := context.Background()
+	unavailable := errors.New("unavailable")
+	exp := &failingExporter{errs: []error{unavailable, Permanent(unavailable), context.Canceled, unavailable}}
+	r, now, _ := newTestRetry(exp, RetryConfig{
+		MaxAttempts:      1,
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+	})
+	// Permanent errors and cancellations do not reset the failure count
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), unavailable)
+	assert.True(t, IsPermanent(r.Export(ctx, sensor.Data{})))
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), context.Canceled)
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), unavailable)
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), ErrCircuitOpen)
+
+	// A permanent error does not close a half-open circuit but allows another trial export
+	*now = now.Add(time.Minute)
+	exp.errs = []error{Permanent(unavailable), unavailable}
+	assert.True(t, IsPermanent(r.Export(ctx, sensor.Data{})))
+	assert.Equal(t, circuitOpen, r.state)
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), unavailable)
+	assert.ErrorIs(t, r.Export(ctx, sensor.Data{}), ErrCircuitOpen)
+	assert.Equal(t, 6, exp.calls)
+}
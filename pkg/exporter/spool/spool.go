@@ -0,0 +1,216 @@
+// Package spool implements an exporter that stores measurements on disk when the wrapped
+// exporter fails and sends them in order once it recovers
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/wal"
+)
+
+type Config struct {
+	// Dir is the directory where unsent measurements are stored
+	Dir string
+	// MaxSize is the maximum size of stored measurements in bytes. Zero means no limit.
+	MaxSize int64
+	// MaxAge is the maximum age of stored measurements. Zero means no limit.
+	MaxAge time.Duration
+	// RetryInterval is the interval between attempts to send stored measurements. Defaults to 30 seconds.
+	RetryInterval time.Duration
+	// Timeout is the timeout for sending a single stored measurement. Defaults to 30 seconds.
+	Timeout time.Duration
+	Logger  *slog.Logger
+}
+
+type record struct {
+	Data  sensor.Data    `json:"data"`
+	Extra map[string]any `json:"extra,omitempty"`
+}
+
+type spoolExporter struct {
+	exp    exporter.Exporter
+	log    *wal.Log
+	cfg    Config
+	logger *slog.Logger
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type eventSpoolExporter struct {
+	*spoolExporter
+	events exporter.EventExporter
+}
+
+// New wraps the given exporter. Measurements that cannot be exported are stored in
+// cfg.Dir and retried in the background until they are sent or expire. Stored
+// measurements are kept across restarts.
+func New(exp exporter.Exporter, cfg Config) (exporter.Exporter, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("spool directory must be specified")
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	log, err := wal.Open(cfg.Dir, wal.Options{
+		MaxSize: cfg.MaxSize,
+		MaxAge:  cfg.MaxAge,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &spoolExporter{
+		exp:    exp,
+		log:    log,
+		cfg:    cfg,
+		logger: cfg.Logger.With("exporter", exp.Name()),
+		cancel: cancel,
+	}
+	if !log.Empty() {
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "Found stored measurements", slog.String("dir", cfg.Dir))
+	}
+	s.wg.Add(1)
+	go s.run(ctx)
+	if events, ok := exp.(exporter.EventExporter); ok {
+		return &eventSpoolExporter{spoolExporter: s, events: events}, nil
+	}
+	return s, nil
+}
+
+func (s *spoolExporter) Name() string {
+	return s.exp.Name()
+}
+
+// Export sends the measurement directly if there are no stored measurements. Otherwise,
+// or if sending fails, the measurement is stored to be sent later. Measurements that the
+// exporter rejects permanently are not stored.
+func (s *spoolExporter) Export(ctx context.Context, data sensor.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log.Empty() {
+		err := s.exp.Export(ctx, data)
+		if err == nil || exporter.IsPermanent(err) {
+			// Storing a rejected measurement would block the stored ones behind it
+			return err
+		}
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "Export failed, storing measurement", slog.Any("error", err))
+	}
+	return s.store(record{Data: data, Extra: exporter.ExtraColumns(ctx)})
+}
+
+// ExportBatch sends the measurements directly if there are no stored measurements.
+// Otherwise, or if sending fails, the measurements are stored to be sent later.
+func (s *spoolExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log.Empty() {
+		err := exporter.ExportBatch(ctx, s.exp, batch)
+		if err == nil || exporter.IsPermanent(err) {
+			return err
+		}
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "Export failed, storing measurements", slog.Int("count", len(batch)), slog.Any("error", err))
+	}
+	for _, m := range batch {
+		if err := s.store(record{Data: m.Data, Extra: m.Extra}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *spoolExporter) Unwrap() exporter.Exporter {
+	return s.exp
+}
+
+func (s *spoolExporter) store(rec record) error {
+	content, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.log.Append(content)
+}
+
+func (s *spoolExporter) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return errors.Join(s.log.Close(), s.exp.Close())
+}
+
+func (s *eventSpoolExporter) ExportEvent(ctx context.Context, e event.Event) error {
+	return s.events.ExportEvent(ctx, e)
+}
+
+func (s *spoolExporter) run(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.RetryInterval)
+	defer ticker.Stop()
+	for {
+		s.replay(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replay sends stored measurements in order until there are none left or sending fails.
+// The lock is only held while reading and acknowledging the log so that new measurements
+// can be stored while a long backlog is being sent.
+func (s *spoolExporter) replay(ctx context.Context) {
+	var sent int
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		r, err := s.log.Peek()
+		s.mu.Unlock()
+		if errors.Is(err, wal.ErrEmpty) {
+			break
+		}
+		if err != nil {
+			s.logger.LogAttrs(ctx, slog.LevelError, "Failed to read stored measurement", slog.Any("error", err))
+			return
+		}
+		var rec record
+		if err := json.Unmarshal(r.Data, &rec); err != nil {
+			s.logger.LogAttrs(ctx, slog.LevelError, "Discarding invalid stored measurement", slog.Any("error", err))
+		} else if err := s.send(ctx, rec); exporter.IsPermanent(err) {
+			s.logger.LogAttrs(ctx, slog.LevelError, "Discarding stored measurement rejected by exporter", slog.Any("error", err))
+		} else if err != nil {
+			s.logger.LogAttrs(ctx, slog.LevelWarn, "Failed to send stored measurements", slog.Any("error", err))
+			return
+		}
+		s.mu.Lock()
+		err = s.log.Ack()
+		s.mu.Unlock()
+		if err != nil {
+			s.logger.LogAttrs(ctx, slog.LevelError, "Failed to update stored measurements", slog.Any("error", err))
+			return
+		}
+		sent++
+	}
+	if sent > 0 {
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "Sent stored measurements", slog.Int("count", sent), slog.Uint64("dropped", s.log.Dropped()))
+	}
+}
+
+func (s *spoolExporter) send(ctx context.Context, rec record) error {
+	ctx, cancel := context.WithTimeout(exporter.WithExtraColumns(ctx, rec.Extra), s.cfg.Timeout)
+	defer cancel()
+	return s.exp.Export(ctx, rec.Data)
+}
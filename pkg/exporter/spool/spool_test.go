@@ -0,0 +1,197 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+type flakyExporter struct {
+	mu       sync.Mutex
+	failing  bool
+	rejected map[int]bool
+	gate     chan struct{}
+	waiting  int
+	exported []sensor.Data
+	extra    []map[string]any
+}
+
+func (e *flakyExporter) Name() string {
+	return "flaky"
+}
+
+func (e *flakyExporter) Export(ctx context.Context, data sensor.Data) error {
+	e.mu.Lock()
+	gate := e.gate
+	if gate != nil {
+		e.waiting++
+	}
+	e.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failing {
+		return errors.New("unavailable")
+	}
+	if e.rejected[data.MeasurementNumber] {
+		return exporter.Permanent(errors.New("rejected"))
+	}
+	e.exported = append(e.exported, data)
+	e.extra = append(e.extra, exporter.ExtraColumns(ctx))
+	return nil
+}
+
+func (e *flakyExporter) Close() error {
+	return nil
+}
+
+func (e *flakyExporter) setFailing(failing bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failing = failing
+}
+
+func (e *flakyExporter) setGate(gate chan struct{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.gate = gate
+}
+
+func (e *flakyExporter) measurementNumbers() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var numbers []int
+	for _, d := range e.exported {
+		numbers = append(numbers, d.MeasurementNumber)
+	}
+	return numbers
+}
+
+func measurement(n int) sensor.Data {
+	return sensor.Data{
+		Addr:              "CC:CA:7E:52:CC:34",
+		Name:              "Backyard",
+		Temperature:       21.5,
+		MeasurementNumber: n,
+		Timestamp:         time.Date(2020, time.January, 1, 0, 0, n, 0, time.UTC),
+	}
+}
+
+func TestSpool(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyExporter{}
+	exp, err := New(flaky, Config{Dir: t.TempDir(), RetryInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer exp.Close()
+
+	require.NoError(t, exp.Export(ctx, measurement(1)))
+	flaky.setFailing(true)
+	require.NoError(t, exp.Export(ctx, measurement(2)))
+	require.NoError(t, exp.Export(exporter.WithExtraColumns(ctx, map[string]any{"tilt_x": 12.5}), measurement(3)))
+	flaky.setFailing(false)
+	// Measurements are queued behind the stored ones to keep them in order
+	require.NoError(t, exp.Export(ctx, measurement(4)))
+	assert.Eventually(t, func() bool {
+		return len(flaky.measurementNumbers()) == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int{1, 2, 3, 4}, flaky.measurementNumbers())
+	assert.Equal(t, map[string]any{"tilt_x": 12.5}, flaky.extra[2])
+	assert.Equal(t, measurement(2).Timestamp, flaky.exported[1].Timestamp.UTC())
+}
+
+func TestSpoolRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	flaky := &flakyExporter{failing: true}
+	exp, err := New(flaky, Config{Dir: dir, RetryInterval: time.Hour})
+	require.NoError(t, err)
+	for i := range 3 {
+		require.NoError(t, exp.Export(ctx, measurement(i)))
+	}
+	require.NoError(t, exp.Close())
+	assert.Empty(t, flaky.measurementNumbers())
+
+	flaky.setFailing(false)
+	exp, err = New(flaky, Config{Dir: dir, RetryInterval: time.Hour})
+	require.NoError(t, err)
+	defer exp.Close()
+	assert.Eventually(t, func() bool {
+		return len(flaky.measurementNumbers()) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2}, flaky.measurementNumbers())
+}
+
+func TestExportDuringReplay(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyExporter{failing: true}
+	exp, err := New(flaky, Config{Dir: t.TempDir(), RetryInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.NoError(t, exp.Export(ctx, measurement(1)))
+
+	// Replaying the stored measurement blocks until the gate is opened
+	gate := make(chan struct{})
+	var once sync.Once
+	release := func() {
+		once.Do(func() { close(gate) })
+	}
+	defer release()
+	flaky.setGate(gate)
+	flaky.setFailing(false)
+	assert.Eventually(t, func() bool {
+		flaky.mu.Lock()
+		defer flaky.mu.Unlock()
+		return flaky.waiting > 0
+	}, time.Second, 10*time.Millisecond)
+	flaky.setGate(nil)
+	done := make(chan error)
+	go func() {
+		done <- exp.Export(ctx, measurement(2))
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "export was blocked by the replay")
+	}
+	release()
+	assert.Eventually(t, func() bool {
+		return len(flaky.measurementNumbers()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int{1, 2}, flaky.measurementNumbers())
+}
+
+func TestPermanentError(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyExporter{rejected: map[int]bool{1: true, 3: true}}
+	exp, err := New(flaky, Config{Dir: t.TempDir(), RetryInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer exp.Close()
+
+	// A rejected measurement is returned as an error instead of being stored
+	err = exp.Export(ctx, measurement(1))
+	assert.True(t, exporter.IsPermanent(err))
+	require.NoError(t, exp.Export(ctx, measurement(2)))
+
+	// A stored measurement that is rejected on replay is discarded and does not block
+	// the measurements behind it
+	flaky.setFailing(true)
+	for i := 3; i <= 5; i++ {
+		require.NoError(t, exp.Export(ctx, measurement(i)))
+	}
+	flaky.setFailing(false)
+	assert.Eventually(t, func() bool {
+		return len(flaky.measurementNumbers()) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int{2, 4, 5}, flaky.measurementNumbers())
+}
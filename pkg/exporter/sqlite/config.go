@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type Config struct {
+	// Path is the path of the database file, which is created if it doesn't exist
+	Path string
+	// Table is the name of the table for raw measurements. Hourly rollups are stored in
+	// the table <Table>_hourly. Defaults to ruuvitag.
+	Table string
+	// Retention is how long raw measurements are kept. Defaults to 7 days.
+	Retention time.Duration
+	// RollupRetention is how long hourly rollups are kept. Defaults to 365 days.
+	RollupRetention time.Duration
+	// MaintenanceInterval is the interval of computing rollups and pruning old data.
+	// Defaults to 1 hour.
+	MaintenanceInterval time.Duration
+	Columns             map[string]string
+	Logger              *slog.Logger
+}
+
+// Query selects stored measurements to read
+type Query struct {
+	Path    string
+	Table   string
+	From    time.Time
+	To      time.Time
+	Hourly  bool
+	Columns map[string]string
+}
+
+func Validate(cfg Config) error {
+	if cfg.Path == "" {
+		return fmt.Errorf("database path must be specified")
+	}
+	if cfg.Columns["time"] == "" || cfg.Columns["mac"] == "" {
+		return fmt.Errorf("columns must include time and mac")
+	}
+	return nil
+}
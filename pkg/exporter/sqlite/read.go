@@ -0,0 +1,163 @@
+//go:build sqlite
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// Read calls fn for each stored measurement in the time range of the query, in
+// chronological order. With q.Hourly the hourly averages are read instead of the raw
+// measurements.
+func Read(ctx context.Context, q Query, fn func(m exporter.Measurement) error) (err error) {
+	if q.Table == "" {
+		q.Table = "ruuvitag"
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	db, err := open(q.Path, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, db.Close())
+	}()
+	s := newSchema(q.Table, q.Columns)
+	table := s.table
+	if q.Hourly {
+		table = s.rollup
+	}
+	existing, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return fmt.Errorf("table %s does not exist in %s", table, q.Path)
+	}
+	// Read the columns of the column map that exist in the table
+	keys := make(map[string]string)
+	for key, column := range q.Columns {
+		keys[column] = key
+	}
+	var columns []string
+	for _, c := range append([]string{s.time, s.mac, s.name}, s.values...) {
+		if c != "" && existing[c] {
+			columns = append(columns, c)
+		}
+	}
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = quote(c)
+	}
+	rows, err := db.QueryContext(ctx,
+		fmt.Sprintf("SELECT %s FROM %s WHERE %s >= ? AND %s < ? ORDER BY %s",
+			strings.Join(quoted, ", "), quote(table), quote(s.time), quote(s.time), quote(s.time)),
+		formatTime(q.From), formatTime(q.To),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		var m exporter.Measurement
+		for i, c := range columns {
+			if values[i] == nil {
+				continue
+			}
+			if err := setField(&m, keys[c], values[i]); err != nil {
+				return fmt.Errorf("invalid value in column %s: %w", c, err)
+			}
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// setField sets the sensor data field identified by its column map key. Values of columns
+// that are not sensor data fields are set as extra columns.
+func setField(m *exporter.Measurement, key string, value any) error {
+	switch key {
+	case "time":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected text, got %T", value)
+		}
+		ts, err := time.Parse(timeFormat, s)
+		if err != nil {
+			return err
+		}
+		m.Timestamp = ts
+		return nil
+	case "mac":
+		m.Addr = fmt.Sprint(value)
+		return nil
+	case "name":
+		m.Name = fmt.Sprint(value)
+		return nil
+	}
+	var f float64
+	switch v := value.(type) {
+	case int64:
+		f = float64(v)
+	case float64:
+		f = v
+	default:
+		m.SetExtra(key, value)
+		return nil
+	}
+	if !setNumber(&m.Data, key, f) {
+		m.SetExtra(key, value)
+	}
+	return nil
+}
+
+func setNumber(data *sensor.Data, key string, f float64) bool {
+	switch key {
+	case "temperature":
+		data.Temperature = f
+	case "humidity":
+		data.Humidity = f
+	case "pressure":
+		data.Pressure = f
+	case "dew_point":
+		data.DewPoint = f
+	case "wet_bulb":
+		data.WetBulb = f
+	case "battery_voltage":
+		data.BatteryVoltage = f
+	case "tx_power":
+		data.TxPower = int(f)
+	case "acceleration_x":
+		data.AccelerationX = int(f)
+	case "acceleration_y":
+		data.AccelerationY = int(f)
+	case "acceleration_z":
+		data.AccelerationZ = int(f)
+	case "movement_counter":
+		data.MovementCounter = int(f)
+	case "measurement_number":
+		data.MeasurementNumber = int(f)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+//go:build sqlite
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeFormat stores timestamps as fixed width UTC text, which sorts chronologically and is
+// understood by the SQLite date and time functions
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// hourFormat is the SQLite strftime format of the start of the hour in timeFormat
+const hourFormat = "%Y-%m-%dT%H:00:00.000Z"
+
+// schema describes the tables created from the column map
+type schema struct {
+	table  string
+	rollup string
+	time   string
+	mac    string
+	name   string
+	// values are the names of the columns other than time, MAC address and name
+	values []string
+}
+
+func newSchema(table string, columns map[string]string) schema {
+	s := schema{
+		table:  table,
+		rollup: table + "_hourly",
+		time:   columns["time"],
+		mac:    columns["mac"],
+		name:   columns["name"],
+	}
+	for key, column := range columns {
+		switch key {
+		case "time", "mac", "name":
+			continue
+		}
+		s.values = append(s.values, column)
+	}
+	sort.Strings(s.values)
+	return s
+}
+
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// rawColumns returns the column definitions of the raw measurement table
+func (s schema) rawColumns() [][2]string {
+	columns := [][2]string{{s.time, "TEXT NOT NULL"}, {s.mac, "TEXT NOT NULL"}}
+	if s.name != "" {
+		columns = append(columns, [2]string{s.name, "TEXT"})
+	}
+	for _, c := range s.values {
+		columns = append(columns, [2]string{c, "NUMERIC"})
+	}
+	return columns
+}
+
+// rollupColumns returns the column definitions of the hourly rollup table. Each value
+// column holds the hourly average along with <column>_min and <column>_max.
+func (s schema) rollupColumns() [][2]string {
+	columns := [][2]string{{s.time, "TEXT NOT NULL"}, {s.mac, "TEXT NOT NULL"}}
+	if s.name != "" {
+		columns = append(columns, [2]string{s.name, "TEXT"})
+	}
+	columns = append(columns, [2]string{"samples", "INTEGER"})
+	for _, c := range s.values {
+		columns = append(columns,
+			[2]string{c, "REAL"},
+			[2]string{c + "_min", "REAL"},
+			[2]string{c + "_max", "REAL"},
+		)
+	}
+	return columns
+}
+
+// create creates the tables and indexes, adding any columns that have been added to the
+// column map since the tables were created
+func (s schema) create(ctx context.Context, db *sql.DB) error {
+	if err := createTable(ctx, db, s.table, s.rawColumns(), ""); err != nil {
+		return err
+	}
+	primaryKey := fmt.Sprintf("PRIMARY KEY (%s, %s)", quote(s.mac), quote(s.time))
+	if err := createTable(ctx, db, s.rollup, s.rollupColumns(), primaryKey); err != nil {
+		return err
+	}
+	indexes := []string{
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", quote(s.table+"_time"), quote(s.table), quote(s.time)),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s, %s)", quote(s.table+"_mac_time"), quote(s.table), quote(s.mac), quote(s.time)),
+	}
+	for _, q := range indexes {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createTable(ctx context.Context, db *sql.DB, table string, columns [][2]string, constraint string) error {
+	var defs []string
+	for _, c := range columns {
+		defs = append(defs, quote(c[0])+" "+c[1])
+	}
+	if constraint != "" {
+		defs = append(defs, constraint)
+	}
+	q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quote(table), strings.Join(defs, ", "))
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	existing, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		if existing[c[0]] {
+			continue
+		}
+		// Columns added later can't be NOT NULL
+		colType := strings.TrimSuffix(c[1], " NOT NULL")
+		q := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quote(table), quote(c[0]), colType)
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to add column %s to table %s: %w", c[0], table, err)
+		}
+	}
+	return nil
+}
+
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
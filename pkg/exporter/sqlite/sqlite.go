@@ -0,0 +1,314 @@
+//go:build sqlite
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+type sqliteExporter struct {
+	cfg    Config
+	db     *sql.DB
+	schema schema
+	insert string
+	logger *slog.Logger
+	now    func() time.Time
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	// dirty is the earliest time of the measurements stored since the last rollup
+	dirty time.Time
+}
+
+// New creates an exporter that stores measurements in a local SQLite database. Raw
+// measurements are rolled up into hourly averages and pruned after cfg.Retention.
+func New(cfg Config) (exporter.Exporter, error) {
+	e, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.wg.Add(1)
+	go e.run(ctx)
+	return e, nil
+}
+
+func newExporter(cfg Config) (*sqliteExporter, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Table == "" {
+		cfg.Table = "ruuvitag"
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+	if cfg.RollupRetention <= 0 {
+		cfg.RollupRetention = 365 * 24 * time.Hour
+	}
+	if cfg.MaintenanceInterval <= 0 {
+		cfg.MaintenanceInterval = time.Hour
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	db, err := open(cfg.Path, false)
+	if err != nil {
+		return nil, err
+	}
+	s := newSchema(cfg.Table, cfg.Columns)
+	if err := s.create(context.Background(), db); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+	columns := []string{quote(s.time), quote(s.mac)}
+	if s.name != "" {
+		columns = append(columns, quote(s.name))
+	}
+	for _, c := range s.values {
+		columns = append(columns, quote(c))
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return &sqliteExporter{
+		cfg:    cfg,
+		db:     db,
+		schema: s,
+		insert: fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(s.table), strings.Join(columns, ", "), placeholders),
+		logger: cfg.Logger.With("exporter", "SQLite"),
+		now:    time.Now,
+	}, nil
+}
+
+// open opens the database in WAL mode so that it can be read while measurements are
+// being written
+func open(path string, readOnly bool) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	if readOnly {
+		params.Set("mode", "ro")
+	} else {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open %s: %w", path, err), db.Close())
+	}
+	return db, nil
+}
+
+func (e *sqliteExporter) Name() string {
+	return fmt.Sprintf("SQLite (%s)", e.cfg.Path)
+}
+
+func (e *sqliteExporter) Export(ctx context.Context, data sensor.Data) error {
+	if _, err := e.db.ExecContext(ctx, e.insert, e.args(ctx, data)...); err != nil {
+		return err
+	}
+	e.markDirty(data.Timestamp)
+	return nil
+}
+
+func (e *sqliteExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, e.insert)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer stmt.Close()
+	for _, m := range batch {
+		if _, err := stmt.ExecContext(ctx, e.args(m.Context(ctx), m.Data)...); err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, m := range batch {
+		e.markDirty(m.Timestamp)
+	}
+	return nil
+}
+
+// markDirty records that a measurement of the given time has been stored so that the
+// rollup of its hour is computed again even if later hours have already been rolled up
+func (e *sqliteExporter) markDirty(ts time.Time) {
+	if ts.IsZero() {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dirty.IsZero() || ts.Before(e.dirty) {
+		e.dirty = ts
+	}
+}
+
+// takeDirty returns and clears the earliest time of the measurements stored since the
+// last rollup
+func (e *sqliteExporter) takeDirty() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	dirty := e.dirty
+	e.dirty = time.Time{}
+	return dirty
+}
+
+func (e *sqliteExporter) args(ctx context.Context, data sensor.Data) []any {
+	fields := exporter.Transform(ctx, e.cfg.Columns, data)
+	ts := data.Timestamp
+	if ts.IsZero() {
+		ts = e.now()
+	}
+	args := []any{formatTime(ts), strings.ToUpper(data.Addr)}
+	if e.schema.name != "" {
+		args = append(args, data.Name)
+	}
+	for _, c := range e.schema.values {
+		args = append(args, fields[c])
+	}
+	return args
+}
+
+func (e *sqliteExporter) run(ctx context.Context) {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.cfg.MaintenanceInterval)
+	defer ticker.Stop()
+	for {
+		if err := e.maintain(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			e.logger.LogAttrs(ctx, slog.LevelError, "Database maintenance failed", slog.Any("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintain computes the hourly rollups of completed hours and prunes raw measurements
+// and rollups that are older than their retention
+func (e *sqliteExporter) maintain(ctx context.Context) error {
+	now := e.now().UTC()
+	// Raw measurements are pruned in whole hours so that the oldest rollup stays complete
+	rawCutoff := now.Add(-e.cfg.Retention).Truncate(time.Hour)
+	if err := e.rollup(ctx, rawCutoff, now.Truncate(time.Hour)); err != nil {
+		return fmt.Errorf("failed to compute hourly rollups: %w", err)
+	}
+	s := e.schema
+	res, err := e.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s < ?", quote(s.table), quote(s.time)), formatTime(rawCutoff))
+	if err != nil {
+		return fmt.Errorf("failed to prune measurements: %w", err)
+	}
+	pruned, _ := res.RowsAffected()
+	res, err = e.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s < ?", quote(s.rollup), quote(s.time)), formatTime(now.Add(-e.cfg.RollupRetention)))
+	if err != nil {
+		return fmt.Errorf("failed to prune rollups: %w", err)
+	}
+	prunedRollups, _ := res.RowsAffected()
+	e.logger.LogAttrs(ctx, slog.LevelDebug, "Database maintenance done",
+		slog.Int64("pruned_measurements", pruned),
+		slog.Int64("pruned_rollups", prunedRollups),
+	)
+	return nil
+}
+
+// rollup computes the rollups of the hours before the given hour, starting from the latest
+// existing rollup or from the earliest hour that received measurements since the last
+// rollup. Hours before cutoff are not computed again since their raw measurements may
+// already have been pruned.
+func (e *sqliteExporter) rollup(ctx context.Context, cutoff, before time.Time) (err error) {
+	dirty := e.takeDirty()
+	defer func() {
+		if err != nil && !dirty.IsZero() {
+			e.markDirty(dirty)
+		}
+	}()
+	s := e.schema
+	// Without any rollups all raw measurements are rolled up
+	var from sql.NullString
+	q := fmt.Sprintf("SELECT max(%s) FROM %s", quote(s.time), quote(s.rollup))
+	if err := e.db.QueryRowContext(ctx, q).Scan(&from); err != nil {
+		return err
+	}
+	if from.Valid && !dirty.IsZero() {
+		if late := formatTime(maxTime(dirty, cutoff).Truncate(time.Hour)); late < from.String {
+			from.String = late
+		}
+	}
+	hourExpr := fmt.Sprintf("strftime('%s', %s)", hourFormat, quote(s.time))
+	columns := []string{quote(s.time), quote(s.mac)}
+	selects := []string{hourExpr, quote(s.mac)}
+	if s.name != "" {
+		columns = append(columns, quote(s.name))
+		selects = append(selects, fmt.Sprintf("max(%s)", quote(s.name)))
+	}
+	columns = append(columns, "samples")
+	selects = append(selects, "count(*)")
+	for _, c := range s.values {
+		columns = append(columns, quote(c), quote(c+"_min"), quote(c+"_max"))
+		selects = append(selects,
+			fmt.Sprintf("avg(%s)", quote(c)),
+			fmt.Sprintf("min(%s)", quote(c)),
+			fmt.Sprintf("max(%s)", quote(c)),
+		)
+	}
+	q = fmt.Sprintf(
+		"INSERT OR REPLACE INTO %s (%s) SELECT %s FROM %s WHERE %s >= ? AND %s < ? GROUP BY 1, %s",
+		quote(s.rollup), strings.Join(columns, ", "),
+		strings.Join(selects, ", "), quote(s.table),
+		quote(s.time), quote(s.time), quote(s.mac),
+	)
+	_, err = e.db.ExecContext(ctx, q, from.String, formatTime(before))
+	return err
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (e *sqliteExporter) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+		e.wg.Wait()
+	}
+	// Roll up measurements stored for completed hours since the last maintenance, such as
+	// the ones written by a short export run
+	var err error
+	e.mu.Lock()
+	dirty := !e.dirty.IsZero()
+	e.mu.Unlock()
+	if dirty {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		now := e.now().UTC()
+		if err = e.rollup(ctx, now.Add(-e.cfg.Retention).Truncate(time.Hour), now.Truncate(time.Hour)); err != nil {
+			err = fmt.Errorf("failed to compute hourly rollups: %w", err)
+		}
+	}
+	return errors.Join(err, e.db.Close())
+}
@@ -0,0 +1,11 @@
+//go:build !sqlite
+
+package sqlite
+
+import (
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+func New(cfg Config) (exporter.Exporter, error) {
+	return exporter.NoOp{ReportedName: "SQLite"}, nil
+}
@@ -0,0 +1,184 @@
+//go:build sqlite
+
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var (
+	columns = map[string]string{
+		"time":         "time",
+		"mac":          "mac",
+		"name":         "name",
+		"temperature":  "temperature",
+		"humidity":     "humidity",
+		"tx_power":     "tx_power",
+		"battery_life": "battery_life",
+	}
+	start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func measurement(offset time.Duration, temperature float64) exporter.Measurement {
+	return exporter.Measurement{Data: sensor.Data{
+		Addr:        "cc:ca:7e:52:cc:34",
+		Name:        "Backyard",
+		Temperature: temperature,
+		Humidity:    60,
+		TxPower:     4,
+		Timestamp:   start.Add(offset),
+	}}
+}
+
+func readAll(t *testing.T, q Query) []exporter.Measurement {
+	t.Helper()
+	var ms []exporter.Measurement
+	require.NoError(t, Read(context.Background(), q, func(m exporter.Measurement) error {
+		ms = append(ms, m)
+		return nil
+	}))
+	return ms
+}
+
+func TestExportAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ruuvitag.db")
+	e, err := newExporter(Config{Path: path, Columns: columns})
+	require.NoError(t, err)
+	ctx := context.Background()
+	m := measurement(0, 21.5)
+	m.SetExtra("battery_life", 512.5)
+	require.NoError(t, e.Export(m.Context(ctx), m.Data))
+	require.NoError(t, e.ExportBatch(ctx, []exporter.Measurement{measurement(time.Minute, 21.7), measurement(2*time.Minute, 21.9)}))
+	require.NoError(t, e.Close())
+
+	ms := readAll(t, Query{Path: path, From: start, To: start.Add(time.Hour), Columns: columns})
+	require.Len(t, ms, 3)
+	assert.Equal(t, "CC:CA:7E:52:CC:34", ms[0].Addr)
+	assert.Equal(t, "Backyard", ms[0].Name)
+	assert.Equal(t, 21.5, ms[0].Temperature)
+	assert.Equal(t, 60.0, ms[0].Humidity)
+	assert.Equal(t, 4, ms[0].TxPower)
+	assert.True(t, start.Equal(ms[0].Timestamp))
+	assert.Equal(t, 512.5, ms[0].Extra["battery_life"])
+	assert.Equal(t, 21.9, ms[2].Temperature)
+	assert.Nil(t, ms[2].Extra)
+
+	ms = readAll(t, Query{Path: path, From: start.Add(time.Minute), To: start.Add(2 * time.Minute), Columns: columns})
+	require.Len(t, ms, 1)
+	assert.Equal(t, 21.7, ms[0].Temperature)
+}
+
+func TestRollupAndRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ruuvitag.db")
+	e, err := newExporter(Config{Path: path, Retention: 24 * time.Hour, RollupRetention: 48 * time.Hour, Columns: columns})
+	require.NoError(t, err)
+	ctx := context.Background()
+	var batch []exporter.Measurement
+	for i := range 6 {
+		// Two hours of measurements every 20 minutes
+		batch = append(batch, measurement(time.Duration(i)*20*time.Minute, float64(20+i)))
+	}
+	require.NoError(t, e.ExportBatch(ctx, batch))
+
+	// The current hour is not rolled up yet
+	e.now = func() time.Time { return start.Add(90 * time.Minute) }
+	require.NoError(t, e.maintain(ctx))
+	hourly := readAll(t, Query{Path: path, From: start, Hourly: true, Columns: columns, To: start.Add(72 * time.Hour)})
+	require.Len(t, hourly, 1)
+	assert.Equal(t, 21.0, hourly[0].Temperature)
+
+	e.now = func() time.Time { return start.Add(25 * time.Hour) }
+	require.NoError(t, e.maintain(ctx))
+	hourly = readAll(t, Query{Path: path, From: start, Hourly: true, Columns: columns, To: start.Add(72 * time.Hour)})
+	require.Len(t, hourly, 2)
+	assert.True(t, start.Equal(hourly[0].Timestamp))
+	assert.Equal(t, 21.0, hourly[0].Temperature)
+	assert.True(t, start.Add(time.Hour).Equal(hourly[1].Timestamp))
+	assert.Equal(t, 24.0, hourly[1].Temperature)
+	var minimum, maximum float64
+	var samples int
+	require.NoError(t, e.db.QueryRow(`SELECT samples, temperature_min, temperature_max FROM ruuvitag_hourly ORDER BY time DESC LIMIT 1`).Scan(&samples, &minimum, &maximum))
+	assert.Equal(t, 3, samples)
+	assert.Equal(t, 23.0, minimum)
+	assert.Equal(t, 25.0, maximum)
+	// Raw measurements of the first hour are older than the retention
+	raw := readAll(t, Query{Path: path, From: start, To: start.Add(72 * time.Hour), Columns: columns})
+	require.Len(t, raw, 3)
+	assert.Equal(t, 23.0, raw[0].Temperature)
+
+	e.now = func() time.Time { return start.Add(72 * time.Hour) }
+	require.NoError(t, e.maintain(ctx))
+	assert.Empty(t, readAll(t, Query{Path: path, From: start, Hourly: true, Columns: columns, To: start.Add(72 * time.Hour)}))
+	assert.Empty(t, readAll(t, Query{Path: path, From: start, Columns: columns, To: start.Add(72 * time.Hour)}))
+	require.NoError(t, e.Close())
+}
+
+func TestAddColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ruuvitag.db")
+	e, err := newExporter(Config{Path: path, Columns: map[string]string{"time": "time", "mac": "mac", "temperature": "temperature"}})
+	require.NoError(t, err)
+	require.NoError(t, e.Export(context.Background(), measurement(0, 21.5).Data))
+	require.NoError(t, e.Close())
+
+	e, err = newExporter(Config{Path: path, Columns: columns})
+	require.NoError(t, err)
+	require.NoError(t, e.Export(context.Background(), measurement(time.Minute, 21.7).Data))
+	require.NoError(t, e.Close())
+	ms := readAll(t, Query{Path: path, From: start, To: start.Add(time.Hour), Columns: columns})
+	require.Len(t, ms, 2)
+	assert.Equal(t, 0.0, ms[0].Humidity)
+	assert.Equal(t, 60.0, ms[1].Humidity)
+	assert.Equal(t, "Backyard", ms[1].Name)
+}
+
+func TestLateRollup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ruuvitag.db")
+	e, err := newExporter(Config{Path: path, Retention: 24 * time.Hour, Columns: columns})
+	require.NoError(t, err)
+	ctx := context.Background()
+	hourly := func() []exporter.Measurement {
+		return readAll(t, Query{Path: path, From: start, Hourly: true, Columns: columns, To: start.Add(72 * time.Hour)})
+	}
+	require.NoError(t, e.ExportBatch(ctx, []exporter.Measurement{
+		measurement(10*time.Minute, 20),
+		measurement(70*time.Minute, 30),
+	}))
+	e.now = func() time.Time { return start.Add(150 * time.Minute) }
+	require.NoError(t, e.maintain(ctx))
+	require.Len(t, hourly(), 2)
+
+	// A measurement that arrives late for an hour that has already been rolled up is
+	// included when the rollup is computed again
+	require.NoError(t, e.Export(ctx, measurement(20*time.Minute, 22).Data))
+	require.NoError(t, e.maintain(ctx))
+	rollups := hourly()
+	require.Len(t, rollups, 2)
+	assert.Equal(t, 21.0, rollups[0].Temperature)
+	assert.Equal(t, 30.0, rollups[1].Temperature)
+
+	// Hours whose raw measurements have been pruned keep their rollups
+	e.now = func() time.Time { return start.Add(25*time.Hour + 30*time.Minute) }
+	require.NoError(t, e.maintain(ctx))
+	require.NoError(t, e.Export(ctx, measurement(30*time.Minute, 40).Data))
+	require.NoError(t, e.maintain(ctx))
+	rollups = hourly()
+	require.Len(t, rollups, 2)
+	assert.Equal(t, 21.0, rollups[0].Temperature)
+
+	// Measurements stored after the last maintenance are rolled up on close
+	require.NoError(t, e.Export(ctx, measurement(23*time.Hour, 25).Data))
+	require.NoError(t, e.Close())
+	rollups = hourly()
+	require.Len(t, rollups, 3)
+	assert.Equal(t, 25.0, rollups[2].Temperature)
+}
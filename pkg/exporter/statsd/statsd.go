@@ -0,0 +1,173 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter/graphite"
+)
+
+// maxPacketSize keeps UDP packets within the MTU of typical networks
+const maxPacketSize = 1432
+
+type Config struct {
+	// Addr is the host and port of the StatsD server. Defaults to localhost:8125.
+	Addr string
+	// Prefix is the {prefix} of the metric name template. Defaults to ruuvitag.
+	Prefix string
+	// Template is the metric name template, see graphite.Template. Defaults to
+	// {prefix}.{name}.{column}, or {prefix}.{column} when Tags is enabled.
+	Template graphite.Template
+	// Tags sends the MAC address and name of the RuuviTag as DogStatsD tags instead of
+	// including them in the metric name
+	Tags bool
+	// ExtraTags are added to every metric when Tags is enabled
+	ExtraTags map[string]string
+	Columns   map[string]string
+	Logger    *slog.Logger
+}
+
+type statsdExporter struct {
+	cfg    Config
+	logger *slog.Logger
+	mu     sync.Mutex
+	conn   net.Conn
+}
+
+// New creates an exporter that sends the numeric columns of measurements as StatsD gauges
+// over UDP
+func New(cfg Config) (exporter.Exporter, error) {
+	if len(cfg.Columns) == 0 {
+		return nil, fmt.Errorf("columns must be non-empty")
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = "localhost:8125"
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "ruuvitag"
+	}
+	if cfg.Template == "" {
+		cfg.Template = graphite.DefaultTemplate
+		if cfg.Tags {
+			cfg.Template = "{prefix}.{column}"
+		}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdExporter{
+		cfg:    cfg,
+		logger: cfg.Logger.With("exporter", "StatsD"),
+		conn:   conn,
+	}, nil
+}
+
+func (e *statsdExporter) Name() string {
+	return fmt.Sprintf("StatsD (%s)", e.cfg.Addr)
+}
+
+func (e *statsdExporter) Export(ctx context.Context, data sensor.Data) error {
+	return e.send(e.gauges(ctx, data))
+}
+
+func (e *statsdExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	var lines []string
+	for _, m := range batch {
+		lines = append(lines, e.gauges(m.Context(ctx), m.Data)...)
+	}
+	return e.send(lines)
+}
+
+// gauges formats the numeric columns of the measurement as gauges
+func (e *statsdExporter) gauges(ctx context.Context, data sensor.Data) []string {
+	tags := e.tags(data)
+	fields := exporter.NumericFields(ctx, e.cfg.Columns, data)
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	var lines []string
+	for _, column := range columns {
+		name := e.cfg.Template.Path(e.cfg.Prefix, column, data)
+		v := fields[column]
+		if v < 0 && !e.cfg.Tags {
+			// Plain StatsD treats signed gauge values as changes to the previous value,
+			// so a negative value is set by first resetting the gauge to zero
+			lines = append(lines, name+":0|g")
+		}
+		lines = append(lines, name+":"+strconv.FormatFloat(v, 'f', -1, 64)+"|g"+tags)
+	}
+	return lines
+}
+
+func (e *statsdExporter) tags(data sensor.Data) string {
+	if !e.cfg.Tags {
+		return ""
+	}
+	var tags []string
+	if mac, ok := e.cfg.Columns["mac"]; ok {
+		tags = append(tags, tag(mac, strings.ToUpper(data.Addr)))
+	}
+	if name, ok := e.cfg.Columns["name"]; ok && data.Name != "" {
+		tags = append(tags, tag(name, data.Name))
+	}
+	extra := make([]string, 0, len(e.cfg.ExtraTags))
+	for k, v := range e.cfg.ExtraTags {
+		extra = append(extra, tag(k, v))
+	}
+	sort.Strings(extra)
+	tags = append(tags, extra...)
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// tag formats a DogStatsD tag. Commas and pipes would break the datagram format.
+func tag(k, v string) string {
+	return strings.NewReplacer(",", "_", "|", "_").Replace(k + ":" + v)
+}
+
+// send writes the lines as newline separated UDP packets
+func (e *statsdExporter) send(lines []string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > maxPacketSize {
+			if _, err := e.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err := e.conn.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
+
+func (e *statsdExporter) Close() error {
+	return e.conn.Close()
+}
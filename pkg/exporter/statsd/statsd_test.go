@@ -0,0 +1,72 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+var (
+	columns = map[string]string{
+		"mac":         "mac",
+		"name":        "name",
+		"temperature": "temperature",
+		"humidity":    "humidity",
+	}
+	testData = sensor.Data{
+		Addr:        "cc:ca:7e:52:cc:34",
+		Name:        "Backyard",
+		Temperature: -5.5,
+		Humidity:    60,
+	}
+)
+
+func receive(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	buf := make([]byte, 65536)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestExport(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	exp, err := New(Config{Addr: conn.LocalAddr().String(), Columns: columns})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.NoError(t, exp.Export(context.Background(), testData))
+	assert.Equal(t, []string{
+		"ruuvitag.Backyard.humidity:60|g",
+		"ruuvitag.Backyard.temperature:0|g",
+		"ruuvitag.Backyard.temperature:-5.5|g",
+	}, receive(t, conn))
+}
+
+func TestExportTags(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	exp, err := New(Config{
+		Addr:      conn.LocalAddr().String(),
+		Tags:      true,
+		ExtraTags: map[string]string{"site": "cabin"},
+		Columns:   columns,
+	})
+	require.NoError(t, err)
+	defer exp.Close()
+	require.NoError(t, exp.Export(context.Background(), testData))
+	assert.Equal(t, []string{
+		"ruuvitag.humidity:60|g|#mac:CC:CA:7E:52:CC:34,name:Backyard,site:cabin",
+		"ruuvitag.temperature:-5.5|g|#mac:CC:CA:7E:52:CC:34,name:Backyard,site:cabin",
+	}, receive(t, conn))
+}
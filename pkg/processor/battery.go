@@ -0,0 +1,374 @@
+package processor
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// Columns computed from battery voltage
+const (
+	BatteryLowColumn  = "battery_low"
+	BatteryLifeColumn = "battery_life"
+)
+
+func init() {
+	exporter.RegisterBooleanColumn(BatteryLowColumn)
+}
+
+// DefaultLowVoltage is the low battery voltage threshold above 0 °C
+const DefaultLowVoltage = 2.5
+
+// DefaultBatteryThresholds contains the low battery voltage thresholds of a CR2477 cell in
+// cold temperatures
+var DefaultBatteryThresholds = []BatteryThreshold{
+	{Temperature: -20, Voltage: 2.0},
+	{Temperature: 0, Voltage: 2.3},
+}
+
+// BatteryThreshold is the low battery voltage at or below the given temperature
+type BatteryThreshold struct {
+	Temperature float64
+	Voltage     float64
+}
+
+// BatteryStatus describes the battery state of a RuuviTag
+type BatteryStatus struct {
+	Voltage float64
+	Low     bool
+	// LifeDays is the estimated remaining battery life in days. Valid only if HasEstimate is true.
+	LifeDays    float64
+	HasEstimate bool
+}
+
+// BatteryMonitor is implemented by processors that track battery state
+type BatteryMonitor interface {
+	BatteryStatus(data sensor.Data) BatteryStatus
+}
+
+// BatteryConfig configures a processor that tracks battery voltage
+type BatteryConfig struct {
+	// LowVoltage is the low battery threshold at normal temperatures. Defaults to 2.5 V.
+	LowVoltage float64
+	// Thresholds contains lower thresholds for cold temperatures, since battery voltage
+	// sags in the cold. Defaults to DefaultBatteryThresholds.
+	Thresholds []BatteryThreshold
+	// TemperatureCoefficient is the voltage drop per °C below the reference temperature used
+	// to compensate readings for the voltage trend. Defaults to 0.01 V/°C.
+	TemperatureCoefficient float64
+	// ReferenceTemperature is the temperature above which voltage is not compensated. Defaults to 20 °C.
+	ReferenceTemperature float64
+	// SampleInterval is the interval of stored voltage samples. Defaults to 1 hour.
+	SampleInterval time.Duration
+	// History is the duration of voltage history used for estimating battery life. Defaults to 30 days.
+	History time.Duration
+	// MinHistory is the duration of voltage history required for an estimate. Defaults to 7 days.
+	MinHistory time.Duration
+	// StateFile is an optional file for persisting voltage history across restarts
+	StateFile string
+	// Handler receives low battery events
+	Handler event.Handler
+	Logger  *slog.Logger
+}
+
+// BatterySample is a temperature compensated battery voltage sample
+type BatterySample struct {
+	Time    time.Time `json:"time"`
+	Voltage float64   `json:"voltage"`
+}
+
+type batteryState struct {
+	samples []BatterySample
+	recent  []float64
+	low     bool
+}
+
+type battery struct {
+	name           string
+	lowVoltage     float64
+	thresholds     []BatteryThreshold
+	coefficient    float64
+	refTemperature float64
+	sampleInterval time.Duration
+	history        time.Duration
+	minHistory     time.Duration
+	stateFile      string
+	handler        event.Handler
+	logger         *slog.Logger
+	mu             sync.Mutex
+	state          map[string]*batteryState
+}
+
+// NewBattery creates a processor that emits an event when the battery voltage of a RuuviTag
+// drops below a temperature dependent threshold and estimates the remaining battery life
+// from the voltage trend
+func NewBattery(name string, cfg BatteryConfig) (Processor, error) {
+	if cfg.LowVoltage == 0 {
+		cfg.LowVoltage = DefaultLowVoltage
+	}
+	if cfg.Thresholds == nil {
+		cfg.Thresholds = DefaultBatteryThresholds
+	}
+	if cfg.TemperatureCoefficient == 0 {
+		cfg.TemperatureCoefficient = 0.01
+	}
+	if cfg.ReferenceTemperature == 0 {
+		cfg.ReferenceTemperature = 20
+	}
+	if cfg.SampleInterval == 0 {
+		cfg.SampleInterval = time.Hour
+	}
+	if cfg.History == 0 {
+		cfg.History = 30 * 24 * time.Hour
+	}
+	if cfg.MinHistory == 0 {
+		cfg.MinHistory = 7 * 24 * time.Hour
+	}
+	if cfg.MinHistory > cfg.History {
+		return nil, fmt.Errorf("minimum history must not be longer than history")
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if cfg.Handler == nil {
+		cfg.Handler = event.NewLogHandler(cfg.Logger)
+	}
+	thresholds := slices.Clone(cfg.Thresholds)
+	slices.SortFunc(thresholds, func(a, b BatteryThreshold) int {
+		return cmp.Compare(a.Temperature, b.Temperature)
+	})
+	b := &battery{
+		name:           name,
+		lowVoltage:     cfg.LowVoltage,
+		thresholds:     thresholds,
+		coefficient:    cfg.TemperatureCoefficient,
+		refTemperature: cfg.ReferenceTemperature,
+		sampleInterval: cfg.SampleInterval,
+		history:        cfg.History,
+		minHistory:     cfg.MinHistory,
+		stateFile:      cfg.StateFile,
+		handler:        cfg.Handler,
+		logger:         cfg.Logger.With("processor", name),
+		state:          make(map[string]*batteryState),
+	}
+	if cfg.StateFile != "" {
+		state, err := LoadBatteryState(cfg.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		for addr, samples := range state {
+			b.state[addr] = &batteryState{samples: samples}
+		}
+	}
+	return b, nil
+}
+
+func (b *battery) Name() string {
+	return b.name
+}
+
+func (b *battery) Process(ctx context.Context, m *Measurement) error {
+	if m.BatteryVoltage == 0 {
+		// Battery voltage not available
+		return nil
+	}
+	b.mu.Lock()
+	state, ok := b.state[m.Addr]
+	if !ok {
+		state = new(batteryState)
+		b.state[m.Addr] = state
+	}
+	// Smooth out noise in individual readings
+	state.recent = append(state.recent, m.BatteryVoltage)
+	if len(state.recent) > 5 {
+		state.recent = state.recent[1:]
+	}
+	voltage := median(state.recent)
+	threshold := b.threshold(m.Temperature)
+	var lowEvent bool
+	switch {
+	case !state.low && voltage < threshold:
+		state.low = true
+		lowEvent = true
+	case state.low && voltage > threshold+0.1:
+		state.low = false
+	}
+	var save bool
+	if n := len(state.samples); n == 0 || m.Timestamp.Sub(state.samples[n-1].Time) >= b.sampleInterval {
+		state.samples = append(state.samples, BatterySample{
+			Time:    m.Timestamp,
+			Voltage: b.compensate(voltage, m.Temperature),
+		})
+		cutoff := m.Timestamp.Add(-b.history)
+		for len(state.samples) > 0 && state.samples[0].Time.Before(cutoff) {
+			state.samples = state.samples[1:]
+		}
+		save = b.stateFile != ""
+	}
+	lifeDays, hasEstimate := b.estimate(state.samples)
+	low := state.low
+	b.mu.Unlock()
+
+	m.SetExtra(BatteryLowColumn, low)
+	if hasEstimate {
+		m.SetExtra(BatteryLifeColumn, lifeDays)
+	}
+	if save {
+		if err := b.save(); err != nil {
+			b.logger.LogAttrs(ctx, slog.LevelError, "Failed to save battery state", slog.String("file", b.stateFile), slog.Any("error", err))
+		}
+	}
+	if lowEvent {
+		attrs := map[string]any{
+			"battery_voltage": voltage,
+			"threshold":       threshold,
+			"temperature":     m.Temperature,
+		}
+		if hasEstimate {
+			attrs["battery_life"] = lifeDays
+		}
+		err := b.handler.HandleEvent(ctx, event.Event{
+			Type:       event.LowBattery,
+			Addr:       m.Addr,
+			Name:       m.Name,
+			Timestamp:  m.Timestamp,
+			Attributes: attrs,
+		})
+		if err != nil {
+			b.logger.LogAttrs(ctx, slog.LevelError, "Failed to handle event", slog.String("type", event.LowBattery), slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+func (b *battery) BatteryStatus(data sensor.Data) BatteryStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BatteryStatus{
+		Voltage: data.BatteryVoltage,
+		Low:     data.BatteryVoltage > 0 && data.BatteryVoltage < b.threshold(data.Temperature),
+	}
+	if state, ok := b.state[data.Addr]; ok {
+		status.LifeDays, status.HasEstimate = b.estimate(state.samples)
+	}
+	return status
+}
+
+// threshold returns the low battery voltage at the given temperature
+func (b *battery) threshold(temperature float64) float64 {
+	for _, t := range b.thresholds {
+		if temperature <= t.Temperature {
+			return t.Voltage
+		}
+	}
+	return b.lowVoltage
+}
+
+// compensate returns the voltage the battery would have at the reference temperature
+func (b *battery) compensate(voltage, temperature float64) float64 {
+	if temperature >= b.refTemperature {
+		return voltage
+	}
+	return voltage + b.coefficient*(b.refTemperature-temperature)
+}
+
+func (b *battery) estimate(samples []BatterySample) (float64, bool) {
+	if len(samples) < 2 || samples[len(samples)-1].Time.Sub(samples[0].Time) < b.minHistory {
+		return 0, false
+	}
+	// Samples are compensated to the reference temperature
+	return EstimateBatteryLife(samples, b.lowVoltage)
+}
+
+func (b *battery) save() error {
+	b.mu.Lock()
+	state := make(map[string][]BatterySample, len(b.state))
+	for addr, s := range b.state {
+		state[addr] = slices.Clone(s.samples)
+	}
+	b.mu.Unlock()
+	return SaveBatteryState(b.stateFile, state)
+}
+
+// EstimateBatteryLife fits a linear trend to the voltage samples and returns the number of
+// days until the trend reaches the end voltage. The returned boolean is false if the voltage
+// is not decreasing.
+func EstimateBatteryLife(samples []BatterySample, endVoltage float64) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	t0 := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(samples))
+	for _, s := range samples {
+		x := s.Time.Sub(t0).Hours() / 24
+		sumX += x
+		sumY += s.Voltage
+		sumXY += x * s.Voltage
+		sumXX += x * x
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denom
+	if slope >= 0 {
+		return 0, false
+	}
+	intercept := (sumY - slope*sumX) / n
+	latest := samples[len(samples)-1].Time.Sub(t0).Hours() / 24
+	current := intercept + slope*latest
+	return math.Max((endVoltage-current)/slope, 0), true
+}
+
+// LoadBatteryState reads battery voltage history from a state file. An empty state is
+// returned if the file does not exist.
+func LoadBatteryState(name string) (map[string][]BatterySample, error) {
+	state := make(map[string][]BatterySample)
+	content, err := os.ReadFile(name) //nolint:gosec
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("invalid battery state file %s: %w", name, err)
+	}
+	return state, nil
+}
+
+// SaveBatteryState atomically writes battery voltage history to a state file
+func SaveBatteryState(name string, state map[string][]BatterySample) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		return errors.Join(err, tmp.Close(), os.Remove(tmp.Name()))
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+	return os.Rename(tmp.Name(), name)
+}
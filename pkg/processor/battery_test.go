@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+)
+
+func TestEstimateBatteryLife(t *testing.T) {
+	t0 := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	samples := []BatterySample{
+		{Time: t0, Voltage: 3.0},
+		{Time: t0.Add(24 * time.Hour), Voltage: 2.99},
+		{Time: t0.Add(48 * time.Hour), Voltage: 2.98},
+	}
+	days, ok := EstimateBatteryLife(samples, 2.5)
+	require.True(t, ok)
+	assert.InDelta(t, 48.0, days, 0.001)
+
+	_, ok = EstimateBatteryLife([]BatterySample{
+		{Time: t0, Voltage: 3.0},
+		{Time: t0.Add(24 * time.Hour), Voltage: 3.0},
+	}, 2.5)
+	assert.False(t, ok)
+}
+
+func TestBattery(t *testing.T) {
+	ctx := context.Background()
+	var events []event.Event
+	stateFile := filepath.Join(t.TempDir(), "battery.json")
+	cfg := BatteryConfig{
+		MinHistory: 24 * time.Hour,
+		StateFile:  stateFile,
+		Handler: event.HandlerFunc(func(ctx context.Context, e event.Event) error {
+			events = append(events, e)
+			return nil
+		}),
+	}
+	p, err := NewBattery("battery", cfg)
+	require.NoError(t, err)
+	ts := testData.Timestamp
+	process := func(voltage, temperature float64) Measurement {
+		m := Measurement{Data: testData}
+		m.BatteryVoltage = voltage
+		m.Temperature = temperature
+		m.Timestamp = ts
+		ts = ts.Add(12 * time.Hour)
+		require.NoError(t, p.Process(ctx, &m))
+		return m
+	}
+	m := process(2.6, 20)
+	assert.Equal(t, false, m.Extra[BatteryLowColumn])
+	assert.NotContains(t, m.Extra, BatteryLifeColumn)
+	process(2.59, 20)
+	m = process(2.58, 20)
+	assert.InDelta(t, 9.0, m.Extra[BatteryLifeColumn], 0.001)
+
+	// Voltage sags in the cold but stays above the cold threshold
+	process(2.35, -5)
+	process(2.35, -5)
+	assert.Empty(t, events)
+
+	// Smoothed voltage drops below the threshold at normal temperature
+	for range 3 {
+		process(2.45, 20)
+	}
+	require.Len(t, events, 1)
+	assert.Equal(t, event.LowBattery, events[0].Type)
+	assert.Equal(t, "Backyard", events[0].Name)
+
+	// Battery history is restored from the state file
+	restored, err := NewBattery("battery", cfg)
+	require.NoError(t, err)
+	status := restored.(BatteryMonitor).BatteryStatus(m.Data)
+	assert.True(t, status.HasEstimate)
+	assert.False(t, status.Low)
+	m.BatteryVoltage = 2.2
+	assert.True(t, restored.(BatteryMonitor).BatteryStatus(m.Data).Low)
+}
@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/dewpoint"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/temperature"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/wetbulb"
+)
+
+// CalibrateConfig configures a processor that corrects sensor readings
+type CalibrateConfig struct {
+	// Offsets contains the offsets added to field values, keyed by RuuviTag name or MAC address
+	Offsets map[string]map[string]float64
+}
+
+type calibrate struct {
+	name    string
+	offsets map[string]map[string]float64
+}
+
+// NewCalibrate creates a processor that adds per-RuuviTag offsets to field values. Dew point
+// and wet bulb temperature are recalculated after temperature or humidity is calibrated.
+func NewCalibrate(name string, cfg CalibrateConfig) (Processor, error) {
+	offsets := make(map[string]map[string]float64)
+	for tag, fields := range cfg.Offsets {
+		for column := range fields {
+			if !slices.Contains(Fields, column) {
+				return nil, fmt.Errorf("invalid field for %s: %s", tag, column)
+			}
+		}
+		offsets[strings.ToUpper(tag)] = fields
+	}
+	return &calibrate{
+		name:    name,
+		offsets: offsets,
+	}, nil
+}
+
+func (c *calibrate) Name() string {
+	return c.name
+}
+
+func (c *calibrate) Process(_ context.Context, m *Measurement) error {
+	fields, ok := c.offsets[strings.ToUpper(m.Addr)]
+	if !ok {
+		fields, ok = c.offsets[strings.ToUpper(m.Name)]
+	}
+	if !ok {
+		return nil
+	}
+	for column, offset := range fields {
+		v, _ := Field(m.Data, column)
+		SetField(&m.Data, column, v+offset)
+	}
+	if fields["temperature"] == 0 && fields["humidity"] == 0 {
+		return nil
+	}
+	var err error
+	m.DewPoint, err = dewpoint.Calculate(m.Temperature, temperature.Celsius, m.Humidity)
+	if err != nil {
+		return err
+	}
+	m.WetBulb, err = wetbulb.Calculate(m.Temperature, temperature.Celsius, m.Humidity)
+	return err
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/temperature"
+)
+
+// Pressure units
+const (
+	Hectopascal          = "hpa"
+	Pascal               = "pa"
+	Kilopascal           = "kpa"
+	InchesOfMercury      = "inhg"
+	MillimetersOfMercury = "mmhg"
+)
+
+var pressureFactors = map[string]float64{
+	Hectopascal:          1,
+	Pascal:               100,
+	Kilopascal:           0.1,
+	InchesOfMercury:      0.029529983071445,
+	MillimetersOfMercury: 0.750061682704170,
+}
+
+// ConvertConfig configures a processor that converts units of measurement
+type ConvertConfig struct {
+	// Temperature is the unit for temperature, dew point and wet bulb temperature: celsius, fahrenheit or kelvin
+	Temperature string
+	// Pressure is the unit for pressure: hpa, pa, kpa, inhg or mmhg
+	Pressure string
+}
+
+type convert struct {
+	name           string
+	temperature    temperature.Unit
+	pressureFactor float64
+}
+
+// NewConvert creates a processor that converts temperatures and pressure from the units
+// RuuviTags report, Celsius and hectopascals, to other units
+func NewConvert(name string, cfg ConvertConfig) (Processor, error) {
+	c := &convert{
+		name:           name,
+		temperature:    temperature.Celsius,
+		pressureFactor: 1,
+	}
+	switch strings.ToLower(cfg.Temperature) {
+	case "", "celsius", "c":
+	case "fahrenheit", "f":
+		c.temperature = temperature.Fahrenheit
+	case "kelvin", "k":
+		c.temperature = temperature.Kelvin
+	default:
+		return nil, fmt.Errorf("invalid temperature unit: %s", cfg.Temperature)
+	}
+	if cfg.Pressure != "" {
+		factor, ok := pressureFactors[strings.ToLower(cfg.Pressure)]
+		if !ok {
+			return nil, fmt.Errorf("invalid pressure unit: %s", cfg.Pressure)
+		}
+		c.pressureFactor = factor
+	}
+	return c, nil
+}
+
+func (c *convert) Name() string {
+	return c.name
+}
+
+func (c *convert) Process(_ context.Context, m *Measurement) error {
+	m.Temperature = temperature.Convert(m.Temperature, temperature.Celsius, c.temperature)
+	m.DewPoint = temperature.Convert(m.DewPoint, temperature.Celsius, c.temperature)
+	m.WetBulb = temperature.Convert(m.WetBulb, temperature.Celsius, c.temperature)
+	m.Pressure *= c.pressureFactor
+	return nil
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"math"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+)
+
+// Fields contains the column names of the numeric sensor data fields
+var Fields = []string{
+	"temperature",
+	"humidity",
+	"pressure",
+	"dew_point",
+	"wet_bulb",
+	"battery_voltage",
+	"tx_power",
+	"acceleration_x",
+	"acceleration_y",
+	"acceleration_z",
+	"movement_counter",
+	"measurement_number",
+}
+
+// Field returns the value of the numeric field with the given column name
+func Field(data sensor.Data, column string) (float64, bool) {
+	switch column {
+	case "temperature":
+		return data.Temperature, true
+	case "humidity":
+		return data.Humidity, true
+	case "pressure":
+		return data.Pressure, true
+	case "dew_point":
+		return data.DewPoint, true
+	case "wet_bulb":
+		return data.WetBulb, true
+	case "battery_voltage":
+		return data.BatteryVoltage, true
+	case "tx_power":
+		return float64(data.TxPower), true
+	case "acceleration_x":
+		return float64(data.AccelerationX), true
+	case "acceleration_y":
+		return float64(data.AccelerationY), true
+	case "acceleration_z":
+		return float64(data.AccelerationZ), true
+	case "movement_counter":
+		return float64(data.MovementCounter), true
+	case "measurement_number":
+		return float64(data.MeasurementNumber), true
+	default:
+		return 0, false
+	}
+}
+
+// SetField sets the value of the numeric field with the given column name. Values of
+// integer fields are rounded to the nearest integer.
+func SetField(data *sensor.Data, column string, value float64) bool {
+	switch column {
+	case "temperature":
+		data.Temperature = value
+	case "humidity":
+		data.Humidity = value
+	case "pressure":
+		data.Pressure = value
+	case "dew_point":
+		data.DewPoint = value
+	case "wet_bulb":
+		data.WetBulb = value
+	case "battery_voltage":
+		data.BatteryVoltage = value
+	case "tx_power":
+		data.TxPower = int(math.Round(value))
+	case "acceleration_x":
+		data.AccelerationX = int(math.Round(value))
+	case "acceleration_y":
+		data.AccelerationY = int(math.Round(value))
+	case "acceleration_z":
+		data.AccelerationZ = int(math.Round(value))
+	case "movement_counter":
+		data.MovementCounter = int(math.Round(value))
+	case "measurement_number":
+		data.MeasurementNumber = int(math.Round(value))
+	default:
+		return false
+	}
+	return true
+}
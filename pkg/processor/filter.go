@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FilterConfig configures a processor that drops measurements
+type FilterConfig struct {
+	// Include lists the RuuviTag names or MAC addresses to pass through. If empty, all RuuviTags are included.
+	Include []string
+	// Exclude lists the RuuviTag names or MAC addresses to drop
+	Exclude []string
+	// Min is the minimum accepted value for a field
+	Min map[string]float64
+	// Max is the maximum accepted value for a field
+	Max map[string]float64
+}
+
+type filter struct {
+	name    string
+	include []string
+	exclude []string
+	min     map[string]float64
+	max     map[string]float64
+}
+
+// NewFilter creates a processor that drops measurements from unwanted RuuviTags and
+// measurements with field values outside the accepted range
+func NewFilter(name string, cfg FilterConfig) (Processor, error) {
+	for _, limits := range []map[string]float64{cfg.Min, cfg.Max} {
+		for column := range limits {
+			if !slices.Contains(Fields, column) {
+				return nil, fmt.Errorf("invalid field: %s", column)
+			}
+		}
+	}
+	return &filter{
+		name:    name,
+		include: cfg.Include,
+		exclude: cfg.Exclude,
+		min:     cfg.Min,
+		max:     cfg.Max,
+	}, nil
+}
+
+func (f *filter) Name() string {
+	return f.name
+}
+
+func (f *filter) Process(_ context.Context, m *Measurement) error {
+	if len(f.include) > 0 && !matchesTag(f.include, m) {
+		return ErrDrop
+	}
+	if matchesTag(f.exclude, m) {
+		return ErrDrop
+	}
+	for column, limit := range f.min {
+		if v, _ := Field(m.Data, column); v < limit {
+			return fmt.Errorf("%w: %s %v is below %v", ErrDrop, column, v, limit)
+		}
+	}
+	for column, limit := range f.max {
+		if v, _ := Field(m.Data, column); v > limit {
+			return fmt.Errorf("%w: %s %v is above %v", ErrDrop, column, v, limit)
+		}
+	}
+	return nil
+}
+
+func matchesTag(tags []string, m *Measurement) bool {
+	return slices.ContainsFunc(tags, func(tag string) bool {
+		return strings.EqualFold(tag, m.Name) || strings.EqualFold(tag, m.Addr)
+	})
+}
@@ -0,0 +1,163 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+)
+
+// Columns computed from acceleration
+const (
+	TiltXColumn             = "tilt_x"
+	TiltYColumn             = "tilt_y"
+	TiltZColumn             = "tilt_z"
+	TotalAccelerationColumn = "acceleration_total"
+)
+
+// MotionConfig configures a processor that detects movement and orientation changes
+type MotionConfig struct {
+	// Thresholds contains tilt angles in degrees, keyed by tilt column. An orientation event is
+	// emitted when the tilt angle crosses the threshold.
+	Thresholds map[string]float64
+	// Hysteresis is the distance in degrees the tilt angle has to move past a threshold before it
+	// is considered crossed again. Defaults to 5.
+	Hysteresis float64
+	// Handler receives movement and orientation events
+	Handler event.Handler
+	Logger  *slog.Logger
+}
+
+type motionState struct {
+	movementCounter int
+	above           map[string]bool
+}
+
+type motion struct {
+	name       string
+	thresholds map[string]float64
+	hysteresis float64
+	handler    event.Handler
+	logger     *slog.Logger
+	mu         sync.Mutex
+	state      map[string]*motionState
+}
+
+// NewMotion creates a processor that emits events when the movement counter of a RuuviTag
+// increments or its tilt angle crosses a threshold. Tilt angles and total acceleration are
+// added to the measurement as additional columns.
+func NewMotion(name string, cfg MotionConfig) (Processor, error) {
+	for column := range cfg.Thresholds {
+		switch column {
+		case TiltXColumn, TiltYColumn, TiltZColumn:
+		default:
+			return nil, fmt.Errorf("invalid tilt column: %s", column)
+		}
+	}
+	if cfg.Hysteresis == 0 {
+		cfg.Hysteresis = 5
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if cfg.Handler == nil {
+		cfg.Handler = event.NewLogHandler(cfg.Logger)
+	}
+	return &motion{
+		name:       name,
+		thresholds: cfg.Thresholds,
+		hysteresis: cfg.Hysteresis,
+		handler:    cfg.Handler,
+		logger:     cfg.Logger.With("processor", name),
+		state:      make(map[string]*motionState),
+	}, nil
+}
+
+func (p *motion) Name() string {
+	return p.name
+}
+
+func (p *motion) Process(ctx context.Context, m *Measurement) error {
+	var events []event.Event
+	p.mu.Lock()
+	state, seen := p.state[m.Addr]
+	if !seen {
+		state = &motionState{above: make(map[string]bool)}
+		p.state[m.Addr] = state
+	}
+	if seen && m.MovementCounter != state.movementCounter {
+		// The movement counter is a single byte that wraps around
+		moves := (m.MovementCounter - state.movementCounter + 256) % 256
+		events = append(events, p.newEvent(m, event.Movement, map[string]any{
+			"movement_counter": m.MovementCounter,
+			"moves":            moves,
+		}))
+	}
+	state.movementCounter = m.MovementCounter
+	tilt, total, ok := Tilt(m.AccelerationX, m.AccelerationY, m.AccelerationZ)
+	if ok {
+		m.SetExtra(TiltXColumn, tilt[0])
+		m.SetExtra(TiltYColumn, tilt[1])
+		m.SetExtra(TiltZColumn, tilt[2])
+		m.SetExtra(TotalAccelerationColumn, total)
+		for column, threshold := range p.thresholds {
+			angle := m.Extra[column].(float64)
+			wasAbove, known := state.above[column]
+			above := wasAbove
+			switch {
+			case !known:
+				above = angle > threshold
+			case wasAbove && angle < threshold-p.hysteresis:
+				above = false
+			case !wasAbove && angle > threshold+p.hysteresis:
+				above = true
+			}
+			state.above[column] = above
+			if known && above != wasAbove {
+				events = append(events, p.newEvent(m, event.Orientation, map[string]any{
+					"angle":     column,
+					"value":     angle,
+					"threshold": threshold,
+					"above":     above,
+				}))
+			}
+		}
+	}
+	p.mu.Unlock()
+	// Failing to deliver an event should not prevent exporting the measurement
+	for _, e := range events {
+		if err := p.handler.HandleEvent(ctx, e); err != nil {
+			p.logger.LogAttrs(ctx, slog.LevelError, "Failed to handle event", slog.String("type", e.Type), slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+func (p *motion) newEvent(m *Measurement, tp string, attrs map[string]any) event.Event {
+	return event.Event{
+		Type:       tp,
+		Addr:       m.Addr,
+		Name:       m.Name,
+		Timestamp:  m.Timestamp,
+		Attributes: attrs,
+	}
+}
+
+// Tilt returns the angles in degrees between each axis and the horizontal plane, and the total
+// acceleration in mG. The returned boolean is false if there is no acceleration.
+func Tilt(x, y, z int) (angles [3]float64, total float64, ok bool) {
+	fx, fy, fz := float64(x), float64(y), float64(z)
+	total = math.Sqrt(fx*fx + fy*fy + fz*fz)
+	if total == 0 {
+		return
+	}
+	ok = true
+	for i, v := range []float64{fx, fy, fz} {
+		angles[i] = math.Asin(v/total) * 180 / math.Pi
+	}
+	return
+}
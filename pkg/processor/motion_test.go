@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/event"
+)
+
+func TestTilt(t *testing.T) {
+	angles, total, ok := Tilt(0, 0, 1000)
+	require.True(t, ok)
+	assert.InDelta(t, 0.0, angles[0], 0.001)
+	assert.InDelta(t, 0.0, angles[1], 0.001)
+	assert.InDelta(t, 90.0, angles[2], 0.001)
+	assert.InDelta(t, 1000.0, total, 0.001)
+
+	angles, _, ok = Tilt(1000, 0, 1000)
+	require.True(t, ok)
+	assert.InDelta(t, 45.0, angles[0], 0.001)
+	assert.InDelta(t, 45.0, angles[2], 0.001)
+
+	_, _, ok = Tilt(0, 0, 0)
+	assert.False(t, ok)
+}
+
+func TestMotion(t *testing.T) {
+	ctx := context.Background()
+	var events []event.Event
+	p, err := NewMotion("motion", MotionConfig{
+		Thresholds: map[string]float64{TiltXColumn: 30},
+		Handler: event.HandlerFunc(func(ctx context.Context, e event.Event) error {
+			events = append(events, e)
+			return nil
+		}),
+	})
+	require.NoError(t, err)
+	ts := testData.Timestamp
+	process := func(movementCounter, x, z int) Measurement {
+		m := Measurement{Data: testData}
+		m.MovementCounter = movementCounter
+		m.AccelerationX = x
+		m.AccelerationZ = z
+		m.Timestamp = ts
+		ts = ts.Add(time.Second)
+		require.NoError(t, p.Process(ctx, &m))
+		return m
+	}
+	m := process(254, 0, 1000)
+	assert.InDelta(t, 90.0, m.Extra[TiltZColumn], 0.001)
+	assert.InDelta(t, 1000.0, m.Extra[TotalAccelerationColumn], 0.001)
+	assert.Empty(t, events)
+
+	// Door opens: tilt crosses the threshold and the movement counter wraps around
+	process(1, 1000, 1000)
+	require.Len(t, events, 2)
+	assert.Equal(t, event.Movement, events[0].Type)
+	assert.Equal(t, "Backyard", events[0].Name)
+	assert.Equal(t, 3, events[0].Attributes["moves"])
+	assert.Equal(t, event.Orientation, events[1].Type)
+	assert.Equal(t, true, events[1].Attributes["above"])
+	assert.Equal(t, testData.Timestamp.Add(time.Second), events[1].Timestamp)
+
+	// Small wobble around the threshold is ignored
+	process(1, 500, 1000)
+	assert.Len(t, events, 2)
+
+	// Door closes
+	process(1, 0, 1000)
+	require.Len(t, events, 3)
+	assert.Equal(t, false, events[2].Attributes["above"])
+}
@@ -0,0 +1,241 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// Outlier actions
+const (
+	OutlierDrop = "drop"
+	OutlierFlag = "flag"
+)
+
+// OutlierColumn is the additional column set to true when a flagged measurement contains outliers
+const OutlierColumn = "outlier"
+
+func init() {
+	exporter.RegisterBooleanColumn(OutlierColumn)
+}
+
+// MADScale scales the median absolute deviation to be comparable to standard deviation
+const MADScale = 1.4826
+
+// DefaultOutlierTolerance contains changes that are always accepted for common fields
+var DefaultOutlierTolerance = map[string]float64{
+	"temperature": 1,
+	"humidity":    5,
+	"pressure":    2,
+}
+
+// RejectionCounter is implemented by processors that count rejected field values
+type RejectionCounter interface {
+	// Rejections returns the number of rejected values per field
+	Rejections() map[string]uint64
+}
+
+// OutlierConfig configures a processor that rejects single-sample glitches
+type OutlierConfig struct {
+	// Fields to check. Defaults to temperature, humidity and pressure.
+	Fields []string
+	// MaxRate is the maximum accepted change of a field per minute
+	MaxRate map[string]float64
+	// Tolerance is the change of a field that is always accepted regardless of the other limits
+	Tolerance map[string]float64
+	// Window is the number of previous samples per RuuviTag used for the rolling median. Defaults to 15.
+	Window int
+	// Threshold is the maximum accepted distance from the rolling median in scaled median
+	// absolute deviations. Defaults to 5.
+	Threshold float64
+	// Action is either drop (default) to discard measurements with outliers or flag to
+	// mark them with the outlier column
+	Action string
+	Logger *slog.Logger
+}
+
+type fieldHistory struct {
+	values   []float64
+	last     time.Time
+	rejected int
+}
+
+type outlier struct {
+	name       string
+	fields     []string
+	maxRate    map[string]float64
+	tolerance  map[string]float64
+	window     int
+	threshold  float64
+	flag       bool
+	logger     *slog.Logger
+	mu         sync.Mutex
+	history    map[string]map[string]*fieldHistory
+	rejections map[string]uint64
+}
+
+// NewOutlier creates a processor that rejects field values that change faster than the
+// configured rate or deviate too much from the rolling median of the RuuviTag
+func NewOutlier(name string, cfg OutlierConfig) (Processor, error) {
+	if len(cfg.Fields) == 0 {
+		cfg.Fields = []string{"temperature", "humidity", "pressure"}
+	}
+	for _, column := range cfg.Fields {
+		if !slices.Contains(Fields, column) {
+			return nil, fmt.Errorf("invalid field: %s", column)
+		}
+	}
+	if cfg.Window == 0 {
+		cfg.Window = 15
+	}
+	if cfg.Window < 3 {
+		return nil, fmt.Errorf("window must be at least 3 samples")
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = 5
+	}
+	if cfg.Threshold < 0 {
+		return nil, fmt.Errorf("threshold must be positive")
+	}
+	var flag bool
+	switch strings.ToLower(cfg.Action) {
+	case "", OutlierDrop:
+	case OutlierFlag:
+		flag = true
+	default:
+		return nil, fmt.Errorf("invalid action: %s", cfg.Action)
+	}
+	tolerance := maps.Clone(DefaultOutlierTolerance)
+	maps.Copy(tolerance, cfg.Tolerance)
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &outlier{
+		name:       name,
+		fields:     cfg.Fields,
+		maxRate:    cfg.MaxRate,
+		tolerance:  tolerance,
+		window:     cfg.Window,
+		threshold:  cfg.Threshold,
+		flag:       flag,
+		logger:     cfg.Logger.With("processor", name),
+		history:    make(map[string]map[string]*fieldHistory),
+		rejections: make(map[string]uint64),
+	}, nil
+}
+
+func (o *outlier) Name() string {
+	return o.name
+}
+
+func (o *outlier) Rejections() map[string]uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return maps.Clone(o.rejections)
+}
+
+func (o *outlier) Process(ctx context.Context, m *Measurement) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tagHistory, ok := o.history[m.Addr]
+	if !ok {
+		tagHistory = make(map[string]*fieldHistory)
+		o.history[m.Addr] = tagHistory
+	}
+	var rejected []string
+	for _, column := range o.fields {
+		h, ok := tagHistory[column]
+		if !ok {
+			h = new(fieldHistory)
+			tagHistory[column] = h
+		}
+		v, _ := Field(m.Data, column)
+		if reason := o.check(h, column, v, m.Timestamp); reason != "" {
+			h.rejected++
+			// A long run of rejected values means the level has genuinely changed
+			if h.rejected < o.window/2 {
+				o.rejections[column]++
+				rejected = append(rejected, column)
+				o.logger.LogAttrs(ctx, slog.LevelWarn, "Rejected outlier",
+					slog.String("addr", m.Addr),
+					slog.String("name", m.Name),
+					slog.String("field", column),
+					slog.Float64("value", v),
+					slog.String("reason", reason),
+					slog.Uint64("rejections", o.rejections[column]),
+				)
+				continue
+			}
+			h.values = h.values[:0]
+		}
+		h.rejected = 0
+		h.last = m.Timestamp
+		h.values = append(h.values, v)
+		if len(h.values) > o.window {
+			h.values = h.values[1:]
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	if o.flag {
+		m.SetExtra(OutlierColumn, true)
+		return nil
+	}
+	return fmt.Errorf("%w: outliers in %s", ErrDrop, strings.Join(rejected, ", "))
+}
+
+// check returns the reason for rejecting the value or an empty string if the value is accepted
+func (o *outlier) check(h *fieldHistory, column string, v float64, ts time.Time) string {
+	if len(h.values) == 0 {
+		return ""
+	}
+	tolerance := o.tolerance[column]
+	prev := h.values[len(h.values)-1]
+	change := math.Abs(v - prev)
+	if change <= tolerance {
+		return ""
+	}
+	if rate, ok := o.maxRate[column]; ok {
+		minutes := ts.Sub(h.last).Minutes()
+		if change > rate*minutes {
+			return fmt.Sprintf("change %.2f in %.2f minutes exceeds rate limit %v", change, minutes, rate)
+		}
+	}
+	// Require a few samples before the median is meaningful
+	if len(h.values) < 3 {
+		return ""
+	}
+	med := median(h.values)
+	deviations := make([]float64, len(h.values))
+	for i, value := range h.values {
+		deviations[i] = math.Abs(value - med)
+	}
+	scale := math.Max(MADScale*median(deviations), tolerance)
+	if scale == 0 {
+		return ""
+	}
+	if dist := math.Abs(v-med) / scale; dist > o.threshold {
+		return fmt.Sprintf("%.1f deviations from median %.2f", dist, med)
+	}
+	return ""
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
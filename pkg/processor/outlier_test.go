@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutlier(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewOutlier("outlier", OutlierConfig{
+		MaxRate: map[string]float64{"temperature": 2},
+		Window:  10,
+	})
+	require.NoError(t, err)
+	ts := testData.Timestamp
+	process := func(temperature, pressure float64) error {
+		m := Measurement{Data: testData}
+		m.Temperature = temperature
+		m.Pressure = pressure
+		m.Timestamp = ts
+		ts = ts.Add(time.Minute)
+		return p.Process(ctx, &m)
+	}
+	for _, temp := range []float64{21.0, 21.2, 21.1, 21.4, 21.3} {
+		require.NoError(t, process(temp, 1002))
+	}
+	// Temperature spike exceeds the rate limit
+	assert.ErrorIs(t, process(40, 1002), ErrDrop)
+	// Pressure glitch deviates too far from the median
+	assert.ErrorIs(t, process(21.5, 500), ErrDrop)
+	assert.NoError(t, process(21.6, 1002.5))
+	assert.Equal(t, map[string]uint64{"temperature": 1, "pressure": 1}, p.(RejectionCounter).Rejections())
+	assert.Equal(t, map[string]map[string]uint64{"outlier": {"temperature": 1, "pressure": 1}}, Pipeline{p, extraProcessor{}}.Rejections())
+}
+
+func TestOutlierLevelChange(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewOutlier("outlier", OutlierConfig{
+		Fields: []string{"temperature"},
+		Window: 6,
+	})
+	require.NoError(t, err)
+	values := []float64{20, 20.1, 20.2, 20.1, 20, 35, 35.1, 35, 35.2}
+	var dropped int
+	for _, v := range values {
+		m := Measurement{Data: testData}
+		m.Temperature = v
+		if err := p.Process(ctx, &m); err != nil {
+			require.ErrorIs(t, err, ErrDrop)
+			dropped++
+		}
+	}
+	// After a run of rejected values the new level is accepted
+	assert.Equal(t, 2, dropped)
+}
+
+func TestOutlierFlag(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewOutlier("outlier", OutlierConfig{
+		Fields: []string{"humidity"},
+		Action: OutlierFlag,
+	})
+	require.NoError(t, err)
+	for _, v := range []float64{60, 60.5, 61, 60.5} {
+		m := Measurement{Data: testData}
+		m.Humidity = v
+		require.NoError(t, p.Process(ctx, &m))
+		assert.Nil(t, m.Extra)
+	}
+	m := Measurement{Data: testData}
+	m.Humidity = 0
+	require.NoError(t, p.Process(ctx, &m))
+	assert.Equal(t, true, m.Extra[OutlierColumn])
+}
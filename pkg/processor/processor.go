@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// ErrDrop is returned by a processor to discard a measurement so that it won't be exported
+var ErrDrop = errors.New("measurement dropped")
+
+// Measurement is a sensor reading passing through the processing pipeline together with
+// any additional column values computed by processors
+type Measurement = exporter.Measurement
+
+// Processor is a stage in the measurement processing pipeline. A processor may modify
+// the measurement in place or return ErrDrop to discard it.
+type Processor interface {
+	Name() string
+	Process(ctx context.Context, m *Measurement) error
+}
+
+// Pipeline runs processors in order
+type Pipeline []Processor
+
+// Process runs the measurement through all processors in the pipeline. The returned error
+// wraps ErrDrop if one of the processors discarded the measurement.
+func (p Pipeline) Process(ctx context.Context, data sensor.Data) (Measurement, error) {
+	m := Measurement{Data: data}
+	for _, proc := range p {
+		if err := proc.Process(ctx, &m); err != nil {
+			return m, fmt.Errorf("processor %s: %w", proc.Name(), err)
+		}
+	}
+	return m, nil
+}
+
+// Rejections returns the number of rejected values per field of each processor in the
+// pipeline that counts them, keyed by processor name
+func (p Pipeline) Rejections() map[string]map[string]uint64 {
+	rejections := make(map[string]map[string]uint64)
+	for _, proc := range p {
+		if c, ok := proc.(RejectionCounter); ok {
+			rejections[proc.Name()] = c.Rejections()
+		}
+	}
+	return rejections
+}
@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+var testData = sensor.Data{
+	Addr:            "CC:CA:7E:52:CC:34",
+	Name:            "Backyard",
+	Temperature:     21.5,
+	Humidity:        60,
+	DewPoint:        13.5,
+	Pressure:        1002,
+	BatteryVoltage:  2.755,
+	MovementCounter: 1,
+	Timestamp:       time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+}
+
+type extraProcessor struct{}
+
+func (p extraProcessor) Name() string {
+	return "extra"
+}
+
+func (p extraProcessor) Process(_ context.Context, m *Measurement) error {
+	m.SetExtra("temperature_f", m.Temperature*1.8+32)
+	return nil
+}
+
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+	calibrate, err := NewCalibrate("calibrate", CalibrateConfig{
+		Offsets: map[string]map[string]float64{
+			"backyard": {"temperature": -1.5},
+		},
+	})
+	require.NoError(t, err)
+	filter, err := NewFilter("filter", FilterConfig{
+		Max: map[string]float64{"temperature": 30},
+	})
+	require.NoError(t, err)
+	p := Pipeline{calibrate, filter, extraProcessor{}}
+	m, err := p.Process(ctx, testData)
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, m.Temperature)
+	assert.InDelta(t, 12.0, m.DewPoint, 0.1)
+	assert.InDelta(t, 68.0, m.Extra["temperature_f"], 0.001)
+
+	hot := testData
+	hot.Temperature = 40
+	_, err = p.Process(ctx, hot)
+	assert.ErrorIs(t, err, ErrDrop)
+
+	m, err = Pipeline(nil).Process(ctx, testData)
+	require.NoError(t, err)
+	assert.Equal(t, testData, m.Data)
+}
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFilter("filter", FilterConfig{
+		Include: []string{"backyard", "FB:E1:B7:04:95:EE"},
+		Exclude: []string{"fb:e1:b7:04:95:ee"},
+		Min:     map[string]float64{"pressure": 500},
+	})
+	require.NoError(t, err)
+	m := Measurement{Data: testData}
+	assert.NoError(t, f.Process(ctx, &m))
+	m.Pressure = 300
+	assert.ErrorIs(t, f.Process(ctx, &m), ErrDrop)
+	m = Measurement{Data: testData}
+	m.Addr = "FB:E1:B7:04:95:EE"
+	m.Name = "Upstairs"
+	assert.ErrorIs(t, f.Process(ctx, &m), ErrDrop)
+	m.Addr = "E8:E0:C6:0B:B8:C5"
+	m.Name = "Downstairs"
+	assert.ErrorIs(t, f.Process(ctx, &m), ErrDrop)
+
+	_, err = NewFilter("filter", FilterConfig{Max: map[string]float64{"invalid": 1}})
+	assert.Error(t, err)
+}
+
+func TestConvert(t *testing.T) {
+	c, err := NewConvert("convert", ConvertConfig{
+		Temperature: "fahrenheit",
+		Pressure:    "kPa",
+	})
+	require.NoError(t, err)
+	m := Measurement{Data: testData}
+	require.NoError(t, c.Process(context.Background(), &m))
+	assert.InDelta(t, 70.7, m.Temperature, 0.001)
+	assert.InDelta(t, 56.3, m.DewPoint, 0.001)
+	assert.InDelta(t, 100.2, m.Pressure, 0.001)
+
+	_, err = NewConvert("convert", ConvertConfig{Pressure: "bar"})
+	assert.Error(t, err)
+}
+
+func TestFields(t *testing.T) {
+	data := testData
+	for _, column := range Fields {
+		require.True(t, SetField(&data, column, 42))
+		v, ok := Field(data, column)
+		require.True(t, ok)
+		assert.Equal(t, 42.0, v, column)
+	}
+	_, ok := Field(data, "name")
+	assert.False(t, ok)
+	assert.False(t, SetField(&data, "name", 1))
+}
+
+func TestBooleanColumns(t *testing.T) {
+	assert.True(t, exporter.IsBooleanColumn(BatteryLowColumn))
+	assert.True(t, exporter.IsBooleanColumn(OutlierColumn))
+	assert.False(t, exporter.IsBooleanColumn(BatteryLifeColumn))
+}
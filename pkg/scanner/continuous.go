@@ -16,10 +16,15 @@ func NewContinuous(cfg Config) (Scanner, error) {
 	if err := Validate(cfg); err != nil {
 		return nil, err
 	}
+	scn, err := newScanner(cfg)
+	if err != nil {
+		return nil, err
+	}
 	s := &continuous{
-		scanner: newScanner(cfg),
+		scanner: scn,
 	}
-	err := s.init(cfg.DeviceName)
+	observeStats(cfg.Exporters, s)
+	err = s.init(cfg.DeviceName)
 	return s, err
 }
 
@@ -28,6 +33,7 @@ func (s *continuous) Scan(ctx context.Context, _ time.Duration) error {
 	s.logger.Info("Listening for measurements")
 	meas := s.meas.Channel(ctx)
 	s.exportContinuously(ctx, meas)
+	s.flush()
 	return nil
 }
 
@@ -9,9 +9,11 @@ import (
 	"maps"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/go-ble/ble"
 
+	commonsensor "github.com/niktheblak/ruuvitag-common/pkg/sensor"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/sensor"
 )
 
@@ -46,16 +48,38 @@ func (d *Discover) init(device string) error {
 	return nil
 }
 
+// Discover returns the sorted addresses of all nearby RuuviTags
 func (d *Discover) Discover(ctx context.Context) ([]string, error) {
-	ch := make(chan string, 1024)
+	data, err := d.DiscoverData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(data)), nil
+}
+
+// DiscoverData returns the latest sensor data of all nearby RuuviTags keyed by address.
+// The sensor data of RuuviTags whose advertisement data could not be parsed contains only the address.
+func (d *Discover) DiscoverData(ctx context.Context) (map[string]commonsensor.Data, error) {
+	dataMap := make(map[string]commonsensor.Data)
+	mu := new(sync.Mutex)
 	err := d.ble.Scan(ctx, true, func(a ble.Advertisement) {
-		addr := a.Addr().String()
+		addr := strings.ToUpper(a.Addr().String())
 		d.logger.LogAttrs(ctx, slog.LevelDebug, "Read sensor data from device", slog.String("addr", addr))
-		ch <- addr
+		data, err := Read(a)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			LogInvalidData(ctx, d.logger, a.ManufacturerData(), err)
+			if _, ok := dataMap[addr]; !ok {
+				dataMap[addr] = commonsensor.Data{Addr: addr}
+			}
+			return
+		}
+		data.Addr = addr
+		dataMap[addr] = data
 	}, func(a ble.Advertisement) bool {
 		return sensor.IsRuuviTag(a.ManufacturerData())
 	})
-	close(ch)
 	switch {
 	case errors.Is(err, context.Canceled):
 	case errors.Is(err, context.DeadlineExceeded):
@@ -63,11 +87,9 @@ func (d *Discover) Discover(ctx context.Context) ([]string, error) {
 	default:
 		return nil, err
 	}
-	addrMap := make(map[string]bool)
-	for addr := range ch {
-		addrMap[strings.ToUpper(addr)] = true
-	}
-	return slices.Sorted(maps.Keys(addrMap)), nil
+	mu.Lock()
+	defer mu.Unlock()
+	return dataMap, nil
 }
 
 func (d *Discover) Close() error {
@@ -15,10 +15,15 @@ func NewInterval(cfg Config) (Scanner, error) {
 	if err := Validate(cfg); err != nil {
 		return nil, err
 	}
+	scn, err := newScanner(cfg)
+	if err != nil {
+		return nil, err
+	}
 	s := &interval{
-		scanner: newScanner(cfg),
+		scanner: scn,
 	}
-	err := s.init(cfg.DeviceName)
+	observeStats(cfg.Exporters, s)
+	err = s.init(cfg.DeviceName)
 	return s, err
 }
 
@@ -31,6 +36,7 @@ func (s *interval) Scan(ctx context.Context, scanInterval time.Duration) error {
 	ticker := time.NewTicker(scanInterval)
 	s.listen(ctx, ticker.C, scanInterval)
 	ticker.Stop()
+	s.flush()
 	return nil
 }
 
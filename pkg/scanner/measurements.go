@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"sync/atomic"
 
 	"github.com/go-ble/ble"
 
@@ -12,9 +13,28 @@ import (
 )
 
 type Measurements struct {
-	BLE         BLEScanner
-	Peripherals map[string]string
-	Logger      *slog.Logger
+	BLE            BLEScanner
+	Peripherals    map[string]string
+	Logger         *slog.Logger
+	advertisements atomic.Uint64
+	parseErrors    atomic.Uint64
+}
+
+// ScanStats contains counters of the BLE advertisements received from RuuviTags
+type ScanStats struct {
+	Advertisements uint64
+	ParseErrors    uint64
+	// Rejections are the numbers of field values rejected by the processors per processor
+	// and field
+	Rejections map[string]map[string]uint64
+}
+
+// Stats returns the number of advertisements received and failed to parse so far
+func (s *Measurements) Stats() ScanStats {
+	return ScanStats{
+		Advertisements: s.advertisements.Load(),
+		ParseErrors:    s.parseErrors.Load(),
+	}
 }
 
 // Channel creates a channel that will receive measurements read from all registered peripherals.
@@ -33,8 +53,10 @@ func (s *Measurements) scan(ctx context.Context, ch chan sensor.Data) {
 	err := s.BLE.Scan(ctx, true, func(a ble.Advertisement) {
 		addr := a.Addr().String()
 		s.Logger.LogAttrs(ctx, slog.LevelDebug, "Read sensor data from device", slog.String("addr", addr))
+		s.advertisements.Add(1)
 		sensorData, err := Read(a)
 		if err != nil {
+			s.parseErrors.Add(1)
 			LogInvalidData(ctx, s.Logger, a.ManufacturerData(), err)
 			return
 		}
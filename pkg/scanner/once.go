@@ -13,10 +13,15 @@ func NewOnce(cfg Config) (Scanner, error) {
 	if err := Validate(cfg); err != nil {
 		return nil, err
 	}
+	scn, err := newScanner(cfg)
+	if err != nil {
+		return nil, err
+	}
 	s := &once{
-		scanner: newScanner(cfg),
+		scanner: scn,
 	}
-	err := s.init(cfg.DeviceName)
+	observeStats(cfg.Exporters, s)
+	err = s.init(cfg.DeviceName)
 	return s, err
 }
 
@@ -24,5 +29,6 @@ func NewOnce(cfg Config) (Scanner, error) {
 func (s *once) Scan(ctx context.Context, _ time.Duration) error {
 	meas := s.meas.Channel(ctx)
 	s.doExport(ctx, meas)
+	s.flush()
 	return nil
 }
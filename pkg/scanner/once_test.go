@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
 )
 
 func TestScanOnce(t *testing.T) {
@@ -38,3 +39,59 @@ func TestScanOnce(t *testing.T) {
 	assert.Equal(t, 510.0, e.Pressure)
 	assert.Equal(t, 500.0, e.BatteryVoltage)
 }
+
+func TestScanOnceWithProcessors(t *testing.T) {
+	exp := new(mockExporter)
+	calibrate, err := processor.NewCalibrate("calibrate", processor.CalibrateConfig{
+		Offsets: map[string]map[string]float64{
+			"Test": {"temperature": -5, "pressure": 490},
+		},
+	})
+	require.NoError(t, err)
+	convert, err := processor.NewConvert("convert", processor.ConvertConfig{
+		Temperature: "fahrenheit",
+	})
+	require.NoError(t, err)
+	scn, err := NewOnce(Config{
+		Exporters:     []exporter.Exporter{exp},
+		Processors:    processor.Pipeline{calibrate, convert},
+		DeviceName:    "default",
+		BLEScanner:    NewMockBLEScanner(testAdvertisement),
+		Peripherals:   peripherals,
+		DeviceCreator: mockDeviceCreator{mockDevice{}},
+		Logger:        logger,
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, scn.Scan(ctx, 0))
+	require.NoError(t, scn.Close())
+	require.Len(t, exp.events, 1)
+	e := exp.events[0]
+	assert.Equal(t, "Test", e.Name)
+	assert.InDelta(t, 122.0, e.Temperature, 0.001)
+	assert.Equal(t, 1000.0, e.Pressure)
+}
+
+func TestScanOnceDropped(t *testing.T) {
+	exp := new(mockExporter)
+	filter, err := processor.NewFilter("filter", processor.FilterConfig{
+		Exclude: []string{"Test"},
+	})
+	require.NoError(t, err)
+	scn, err := NewOnce(Config{
+		Exporters:     []exporter.Exporter{exp},
+		Processors:    processor.Pipeline{filter},
+		DeviceName:    "default",
+		BLEScanner:    NewMockBLEScanner(testAdvertisement),
+		Peripherals:   peripherals,
+		DeviceCreator: mockDeviceCreator{mockDevice{}},
+		Logger:        logger,
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, scn.Scan(ctx, 0))
+	require.NoError(t, scn.Close())
+	assert.Empty(t, exp.events)
+}
@@ -0,0 +1,381 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/wal"
+)
+
+// OverflowPolicy decides what happens when a measurement is exported to a full queue
+type OverflowPolicy string
+
+const (
+	// DropOldest discards the oldest queued measurement
+	DropOldest OverflowPolicy = "drop_oldest"
+	// Block waits until there is room in the queue
+	Block OverflowPolicy = "block"
+	// Spill writes measurements to disk until the queue has been emptied
+	Spill OverflowPolicy = "spill"
+)
+
+var errQueueClosed = errors.New("queue is closed")
+
+// QueueConfig configures the queue each exporter reads measurements from
+type QueueConfig struct {
+	// Size is the maximum number of measurements kept in memory per exporter. Defaults to 100.
+	Size int
+	// Overflow is the policy for a full queue. Defaults to DropOldest.
+	Overflow OverflowPolicy
+	// SpillDir is the directory for measurements spilled to disk with the Spill policy.
+	// Each exporter uses its own subdirectory.
+	SpillDir string
+	// SpillMaxSize is the maximum size of spilled measurements per exporter in bytes. Zero means no limit.
+	SpillMaxSize int64
+	// Timeout is the timeout for exporting a single measurement. Defaults to 30 seconds.
+	Timeout time.Duration
+	// DrainTimeout is the time to wait for queued measurements to be exported when
+	// scanning stops. Defaults to 30 seconds.
+	DrainTimeout time.Duration
+	// BatchSize is the maximum number of measurements sent at once to exporters that
+	// support batching. Defaults to 50.
+	BatchSize int
+	// BatchInterval is the maximum time a measurement waits for a batch to fill up.
+	// Defaults to 1 second.
+	BatchInterval time.Duration
+}
+
+// QueueStats describes the state of the queue of an exporter
+type QueueStats struct {
+	Exporter string
+	// Depth is the number of measurements in memory waiting to be exported
+	Depth    int
+	Capacity int
+	// Spilled is the size of measurements spilled to disk in bytes
+	Spilled  int64
+	Exported uint64
+	Failed   uint64
+	Dropped  uint64
+	// Latency is a moving average of the time from queuing a measurement to exporting it
+	Latency time.Duration
+}
+
+type queuedMeasurement struct {
+	exporter.Measurement
+	Enqueued time.Time `json:"-"`
+}
+
+type exportQueue struct {
+	exp    exporter.Exporter
+	cfg    QueueConfig
+	logger *slog.Logger
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []queuedMeasurement
+	spill  *wal.Log
+	batch  bool
+	busy   bool
+	closed bool
+	// flushing is the number of callers waiting for the queue to be emptied
+	flushing int
+	stats    QueueStats
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+}
+
+func (cfg QueueConfig) withDefaults() (QueueConfig, error) {
+	if cfg.Size <= 0 {
+		cfg.Size = 100
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = DropOldest
+	}
+	switch cfg.Overflow {
+	case DropOldest, Block:
+	case Spill:
+		if cfg.SpillDir == "" {
+			return cfg, fmt.Errorf("spill directory must be specified for overflow policy %s", Spill)
+		}
+	default:
+		return cfg, fmt.Errorf("invalid queue overflow policy: %s", cfg.Overflow)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = time.Second
+	}
+	return cfg, nil
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// newExportQueues creates a queue and starts a worker for each exporter
+func newExportQueues(exporters []exporter.Exporter, cfg QueueConfig, logger *slog.Logger) ([]*exportQueue, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	var queues []*exportQueue
+	spillDirs := make(map[string]bool)
+	for _, exp := range exporters {
+		q := &exportQueue{
+			exp:     exp,
+			cfg:     cfg,
+			batch:   exporter.SupportsBatch(exp),
+			logger:  logger.With("exporter", exp.Name()),
+			items:   make([]queuedMeasurement, 0, cfg.Size),
+			stats:   QueueStats{Exporter: exp.Name(), Capacity: cfg.Size},
+			stopped: make(chan struct{}),
+		}
+		q.cond = sync.NewCond(&q.mu)
+		if cfg.Overflow == Spill {
+			name := unsafePathChars.ReplaceAllString(exp.Name(), "_")
+			for i := 2; spillDirs[name]; i++ {
+				name = fmt.Sprintf("%s_%d", unsafePathChars.ReplaceAllString(exp.Name(), "_"), i)
+			}
+			spillDirs[name] = true
+			q.spill, err = wal.Open(filepath.Join(cfg.SpillDir, name), wal.Options{MaxSize: cfg.SpillMaxSize})
+			if err != nil {
+				err = fmt.Errorf("failed to open spill directory for exporter %s: %w", exp.Name(), err)
+				return nil, errors.Join(err, closeExportQueues(queues))
+			}
+		}
+		q.ctx, q.cancel = context.WithCancel(context.Background())
+		go q.run()
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
+
+func closeExportQueues(queues []*exportQueue) error {
+	var errs []error
+	for _, q := range queues {
+		errs = append(errs, q.close())
+	}
+	return errors.Join(errs...)
+}
+
+// enqueue adds a measurement to the queue applying the overflow policy if the queue is full
+func (q *exportQueue) enqueue(ctx context.Context, m queuedMeasurement) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errQueueClosed
+	}
+	m.Enqueued = time.Now()
+	if q.spill != nil && (len(q.items) >= q.cfg.Size || !q.spill.Empty()) {
+		// Keep spilling until the spilled measurements have been exported to retain ordering
+		content, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := q.spill.AppendRecord(wal.Record{Timestamp: m.Enqueued, Data: content}); err != nil {
+			return fmt.Errorf("failed to spill measurement: %w", err)
+		}
+		q.cond.Broadcast()
+		return nil
+	}
+	if len(q.items) >= q.cfg.Size && q.cfg.Overflow == Block {
+		stop := context.AfterFunc(ctx, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.cond.Broadcast()
+		})
+		defer stop()
+		for len(q.items) >= q.cfg.Size && !q.closed {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			q.cond.Wait()
+		}
+		if q.closed {
+			return errQueueClosed
+		}
+	}
+	if len(q.items) >= q.cfg.Size {
+		q.items = q.items[1:]
+		q.stats.Dropped++
+		q.logger.LogAttrs(ctx, slog.LevelWarn, "Export queue is full, dropped oldest measurement", slog.Uint64("dropped", q.stats.Dropped))
+	}
+	q.items = append(q.items, m)
+	q.cond.Broadcast()
+	return nil
+}
+
+// run exports queued measurements in order until the queue is closed
+func (q *exportQueue) run() {
+	defer close(q.stopped)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for len(q.items) == 0 && !q.closed && (q.spill == nil || q.spill.Empty()) {
+			q.cond.Wait()
+		}
+		var batch []queuedMeasurement
+		var spilled bool
+		switch {
+		case len(q.items) > 0:
+			n := 1
+			if q.batch {
+				q.waitForBatch()
+				n = min(len(q.items), q.cfg.BatchSize)
+			}
+			batch = append(batch, q.items[:n]...)
+			q.items = q.items[n:]
+		case q.closed:
+			// Spilled measurements are kept on disk for the next run
+			return
+		default:
+			r, err := q.spill.Peek()
+			if err != nil {
+				if !errors.Is(err, wal.ErrEmpty) {
+					q.logger.LogAttrs(q.ctx, slog.LevelError, "Failed to read spilled measurement", slog.Any("error", err))
+				}
+				// Wait for new measurements instead of spinning on the spill
+				q.cond.Wait()
+				continue
+			}
+			var m queuedMeasurement
+			if err := json.Unmarshal(r.Data, &m); err != nil {
+				q.logger.LogAttrs(q.ctx, slog.LevelError, "Discarding invalid spilled measurement", slog.Any("error", err))
+				if err := q.spill.Ack(); err != nil {
+					q.logger.LogAttrs(q.ctx, slog.LevelError, "Failed to remove spilled measurement", slog.Any("error", err))
+				}
+				continue
+			}
+			m.Enqueued = r.Timestamp
+			batch = append(batch, m)
+			spilled = true
+		}
+		q.busy = true
+		q.mu.Unlock()
+		err := q.export(batch)
+		q.mu.Lock()
+		q.busy = false
+		if spilled {
+			if ackErr := q.spill.Ack(); ackErr != nil {
+				q.logger.LogAttrs(q.ctx, slog.LevelError, "Failed to remove spilled measurement", slog.Any("error", ackErr))
+			}
+		}
+		if err != nil {
+			q.stats.Failed += uint64(len(batch))
+			q.logger.LogAttrs(q.ctx, slog.LevelError, "Failed to export measurements", slog.Int("count", len(batch)), slog.Any("error", err))
+		} else {
+			q.stats.Exported += uint64(len(batch))
+			for _, m := range batch {
+				latency := time.Since(m.Enqueued)
+				if q.stats.Latency == 0 {
+					q.stats.Latency = latency
+				} else {
+					q.stats.Latency = (q.stats.Latency*7 + latency) / 8
+				}
+			}
+		}
+		q.cond.Broadcast()
+	}
+}
+
+// waitForBatch waits until the queue holds a full batch, the oldest measurement has waited
+// for the batch interval or the queue is being flushed
+func (q *exportQueue) waitForBatch() {
+	deadline := q.items[0].Enqueued.Add(q.cfg.BatchInterval)
+	for len(q.items) < q.cfg.BatchSize && !q.closed && q.flushing == 0 {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return
+		}
+		timer := time.AfterFunc(wait, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.cond.Broadcast()
+		})
+		q.cond.Wait()
+		timer.Stop()
+	}
+}
+
+func (q *exportQueue) export(batch []queuedMeasurement) error {
+	ctx, cancel := context.WithTimeout(q.ctx, q.cfg.Timeout)
+	defer cancel()
+	if !q.batch {
+		q.logger.LogAttrs(ctx, slog.LevelDebug, "Exporting measurement")
+		m := batch[0]
+		return q.exp.Export(m.Context(ctx), m.Data)
+	}
+	q.logger.LogAttrs(ctx, slog.LevelDebug, "Exporting batch", slog.Int("size", len(batch)))
+	measurements := make([]exporter.Measurement, len(batch))
+	for i, m := range batch {
+		measurements[i] = m.Measurement
+	}
+	return exporter.ExportBatch(ctx, q.exp, measurements)
+}
+
+// flush waits until the measurements in memory have been exported or the context is done
+func (q *exportQueue) flush(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+	defer stop()
+	q.flushing++
+	defer func() {
+		q.flushing--
+	}()
+	q.cond.Broadcast()
+	for (len(q.items) > 0 || q.busy) && !q.closed {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("exporter %s: %d measurements not exported: %w", q.exp.Name(), len(q.items), err)
+		}
+		q.cond.Wait()
+	}
+	return nil
+}
+
+// close stops the worker after the measurements in memory have been exported or the drain
+// timeout has passed
+func (q *exportQueue) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), q.cfg.DrainTimeout)
+	defer cancel()
+	err := q.flush(ctx)
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	// Abort any export still in progress
+	q.cancel()
+	<-q.stopped
+	if q.spill != nil {
+		err = errors.Join(err, q.spill.Close())
+	}
+	return err
+}
+
+func (q *exportQueue) queueStats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Depth = len(q.items)
+	if q.spill != nil {
+		stats.Spilled = q.spill.Size()
+	}
+	return stats
+}
@@ -0,0 +1,189 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+)
+
+// gatedExporter blocks each export until it is released
+type gatedExporter struct {
+	name     string
+	gate     chan struct{}
+	mu       sync.Mutex
+	exported []int
+}
+
+func newGatedExporter(name string) *gatedExporter {
+	return &gatedExporter{name: name, gate: make(chan struct{})}
+}
+
+func (e *gatedExporter) Name() string {
+	return e.name
+}
+
+func (e *gatedExporter) Export(ctx context.Context, data sensor.Data) error {
+	select {
+	case <-e.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.exported = append(e.exported, data.MeasurementNumber)
+	return nil
+}
+
+func (e *gatedExporter) Close() error {
+	return nil
+}
+
+func (e *gatedExporter) measurementNumbers() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]int(nil), e.exported...)
+}
+
+func queued(n int) queuedMeasurement {
+	return queuedMeasurement{Measurement: exporter.Measurement{
+		Data: sensor.Data{Addr: testAddr1, MeasurementNumber: n},
+	}}
+}
+
+func TestQueueSlowExporter(t *testing.T) {
+	ctx := context.Background()
+	slow := newGatedExporter("slow")
+	fast := new(mockExporter)
+	queues, err := newExportQueues([]exporter.Exporter{slow, fast}, QueueConfig{Size: 10, Timeout: time.Minute}, logger)
+	require.NoError(t, err)
+	for i := range 3 {
+		for _, q := range queues {
+			require.NoError(t, q.enqueue(ctx, queued(i)))
+		}
+	}
+	// The fast exporter is not held back by the slow one
+	require.NoError(t, queues[1].flush(ctx))
+	assert.Len(t, fast.events, 3)
+	stats := queues[0].queueStats()
+	assert.Equal(t, "slow", stats.Exporter)
+	assert.Equal(t, 10, stats.Capacity)
+	assert.GreaterOrEqual(t, stats.Depth, 2)
+	close(slow.gate)
+	require.NoError(t, closeExportQueues(queues))
+	assert.Equal(t, []int{0, 1, 2}, slow.measurementNumbers())
+	stats = queues[0].queueStats()
+	assert.Equal(t, uint64(3), stats.Exported)
+	assert.Positive(t, stats.Latency)
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	ctx := context.Background()
+	exp := newGatedExporter("gated")
+	queues, err := newExportQueues([]exporter.Exporter{exp}, QueueConfig{Size: 2, Overflow: DropOldest}, logger)
+	require.NoError(t, err)
+	q := queues[0]
+	require.NoError(t, q.enqueue(ctx, queued(0)))
+	// Wait for the worker to pick up the first measurement
+	assert.Eventually(t, func() bool {
+		return q.queueStats().Depth == 0
+	}, time.Second, time.Millisecond)
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, q.enqueue(ctx, queued(i)))
+	}
+	assert.Equal(t, uint64(2), q.queueStats().Dropped)
+	close(exp.gate)
+	require.NoError(t, closeExportQueues(queues))
+	assert.Equal(t, []int{0, 3, 4}, exp.measurementNumbers())
+}
+
+func TestQueueBlock(t *testing.T) {
+	exp := newGatedExporter("gated")
+	queues, err := newExportQueues([]exporter.Exporter{exp}, QueueConfig{Size: 1, Overflow: Block}, logger)
+	require.NoError(t, err)
+	q := queues[0]
+	require.NoError(t, q.enqueue(context.Background(), queued(0)))
+	assert.Eventually(t, func() bool {
+		return q.queueStats().Depth == 0
+	}, time.Second, time.Millisecond)
+	require.NoError(t, q.enqueue(context.Background(), queued(1)))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.enqueue(ctx, queued(2)), context.DeadlineExceeded)
+	close(exp.gate)
+	require.NoError(t, q.enqueue(context.Background(), queued(3)))
+	require.NoError(t, closeExportQueues(queues))
+	assert.Equal(t, []int{0, 1, 3}, exp.measurementNumbers())
+}
+
+func TestQueueSpill(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	exp := newGatedExporter("gated")
+	cfg := QueueConfig{Size: 1, Overflow: Spill, SpillDir: dir, DrainTimeout: 50 * time.Millisecond}
+	queues, err := newExportQueues([]exporter.Exporter{exp}, cfg, logger)
+	require.NoError(t, err)
+	q := queues[0]
+	require.NoError(t, q.enqueue(ctx, queued(0)))
+	assert.Eventually(t, func() bool {
+		return q.queueStats().Depth == 0
+	}, time.Second, time.Millisecond)
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, q.enqueue(ctx, queued(i)))
+	}
+	assert.Equal(t, 1, q.queueStats().Depth)
+	assert.Positive(t, q.queueStats().Spilled)
+	// Stop before the exporter recovers; spilled measurements are kept on disk
+	assert.Error(t, closeExportQueues(queues))
+
+	exp = newGatedExporter("gated")
+	close(exp.gate)
+	queues, err = newExportQueues([]exporter.Exporter{exp}, cfg, logger)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(exp.measurementNumbers()) == 3
+	}, time.Second, time.Millisecond)
+	require.NoError(t, closeExportQueues(queues))
+	assert.Equal(t, []int{2, 3, 4}, exp.measurementNumbers())
+}
+
+type batchExporter struct {
+	mockExporter
+	mu      sync.Mutex
+	batches [][]int
+}
+
+func (e *batchExporter) ExportBatch(ctx context.Context, batch []exporter.Measurement) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var numbers []int
+	for _, m := range batch {
+		numbers = append(numbers, m.MeasurementNumber)
+	}
+	e.batches = append(e.batches, numbers)
+	return nil
+}
+
+func TestQueueBatch(t *testing.T) {
+	ctx := context.Background()
+	exp := new(batchExporter)
+	wrapped := exporter.WithRetry(exp, exporter.RetryConfig{})
+	queues, err := newExportQueues([]exporter.Exporter{wrapped}, QueueConfig{BatchSize: 3, BatchInterval: time.Hour}, logger)
+	require.NoError(t, err)
+	q := queues[0]
+	for i := range 4 {
+		require.NoError(t, q.enqueue(ctx, queued(i)))
+	}
+	// A partial batch is sent when the queue is flushed
+	require.NoError(t, q.flush(ctx))
+	require.NoError(t, closeExportQueues(queues))
+	assert.Equal(t, [][]int{{0, 1, 2}, {3}}, exp.batches)
+	assert.Empty(t, exp.events)
+	assert.Equal(t, uint64(4), q.queueStats().Exported)
+}
@@ -7,21 +7,23 @@ import (
 	"io"
 	"log/slog"
 	"maps"
-	"sync"
 	"time"
 
 	"github.com/go-ble/ble"
 
 	"github.com/niktheblak/ruuvitag-common/pkg/sensor"
 	"github.com/niktheblak/ruuvitag-gollector/pkg/exporter"
+	"github.com/niktheblak/ruuvitag-gollector/pkg/processor"
 )
 
 type Config struct {
 	Exporters     []exporter.Exporter
+	Processors    processor.Pipeline
 	DeviceName    string
 	BLEScanner    BLEScanner
 	Peripherals   map[string]string
 	DeviceCreator DeviceCreator
+	Queue         QueueConfig
 	Logger        *slog.Logger
 }
 
@@ -46,11 +48,27 @@ func Validate(cfg Config) error {
 
 type Scanner interface {
 	io.Closer
+	StatsSource
 	Scan(ctx context.Context, interval time.Duration) error
 }
 
+// StatsSource provides statistics about scanning and exporting measurements
+type StatsSource interface {
+	// ScanStats returns counters of the received BLE advertisements
+	ScanStats() ScanStats
+	// QueueStats returns the state of the export queue of each exporter
+	QueueStats() []QueueStats
+}
+
+// StatsObserver is implemented by exporters that publish the statistics of the scanner
+type StatsObserver interface {
+	SetStatsSource(src StatsSource)
+}
+
 type scanner struct {
-	exporters   []exporter.Exporter
+	queues      []*exportQueue
+	queueCfg    QueueConfig
+	processors  processor.Pipeline
 	device      ble.Device
 	peripherals map[string]string
 	dev         DeviceCreator
@@ -58,9 +76,19 @@ type scanner struct {
 	logger      *slog.Logger
 }
 
-func newScanner(cfg Config) scanner {
+func newScanner(cfg Config) (scanner, error) {
+	queueCfg, err := cfg.Queue.withDefaults()
+	if err != nil {
+		return scanner{}, err
+	}
+	queues, err := newExportQueues(cfg.Exporters, cfg.Queue, cfg.Logger)
+	if err != nil {
+		return scanner{}, err
+	}
 	return scanner{
-		exporters:   cfg.Exporters,
+		queues:      queues,
+		queueCfg:    queueCfg,
+		processors:  cfg.Processors,
 		peripherals: cfg.Peripherals,
 		dev:         cfg.DeviceCreator,
 		logger:      cfg.Logger,
@@ -69,6 +97,15 @@ func newScanner(cfg Config) scanner {
 			Peripherals: cfg.Peripherals,
 			Logger:      cfg.Logger,
 		},
+	}, nil
+}
+
+// observeStats passes the scanner statistics to the exporters that publish them
+func observeStats(exporters []exporter.Exporter, src StatsSource) {
+	for _, exp := range exporters {
+		if o, ok := exporter.As[StatsObserver](exp); ok {
+			o.SetStatsSource(src)
+		}
 	}
 }
 
@@ -87,12 +124,38 @@ func (s *scanner) init(device string) error {
 }
 
 func (s *scanner) Close() error {
+	err := closeExportQueues(s.queues)
+	s.queues = nil
 	if s.device != nil {
-		err := s.device.Stop()
+		err = errors.Join(err, s.device.Stop())
 		s.device = nil
-		return err
 	}
-	return nil
+	return err
+}
+
+func (s *scanner) ScanStats() ScanStats {
+	stats := s.meas.Stats()
+	stats.Rejections = s.processors.Rejections()
+	return stats
+}
+
+func (s *scanner) QueueStats() []QueueStats {
+	var stats []QueueStats
+	for _, q := range s.queues {
+		stats = append(stats, q.queueStats())
+	}
+	return stats
+}
+
+// flush waits until the queued measurements have been exported or the drain timeout has passed
+func (s *scanner) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.queueCfg.DrainTimeout)
+	defer cancel()
+	for _, q := range s.queues {
+		if err := q.flush(ctx); err != nil {
+			s.logger.LogAttrs(ctx, slog.LevelWarn, "Failed to export queued measurements", slog.Any("error", err))
+		}
+	}
 }
 
 func (s *scanner) doExport(ctx context.Context, measurements chan sensor.Data) {
@@ -116,32 +179,27 @@ func (s *scanner) doExport(ctx context.Context, measurements chan sensor.Data) {
 	}
 }
 
+// export processes the measurement and adds it to the queue of each exporter
 func (s *scanner) export(ctx context.Context, m sensor.Data) error {
-	if len(s.exporters) == 0 {
+	if len(s.queues) == 0 {
 		return fmt.Errorf("no exporters available")
 	}
-	s.logger.LogAttrs(ctx, slog.LevelInfo, "Exporting measurement", slog.Any("measurement", m))
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-	wg := new(sync.WaitGroup)
-	wg.Add(len(s.exporters))
-	errs := make(chan error, len(s.exporters))
-	for _, e := range s.exporters {
-		go func() {
-			s.logger.LogAttrs(ctx, slog.LevelDebug, "Exporting measurement", slog.String("exporter", e.Name()))
-			if err := e.Export(ctx, m); err != nil {
-				errs <- err
-			}
-			wg.Done()
-		}()
+	pm, err := s.processors.Process(ctx, m)
+	if errors.Is(err, processor.ErrDrop) {
+		s.logger.LogAttrs(ctx, slog.LevelDebug, "Dropped measurement", slog.String("addr", m.Addr), slog.Any("reason", err))
+		return nil
 	}
-	wg.Wait()
-	close(errs)
-	var allErrs []error
-	for e := range errs {
-		allErrs = append(allErrs, e)
+	if err != nil {
+		return fmt.Errorf("failed to process measurement: %w", err)
+	}
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "Exporting measurement", slog.Any("measurement", pm.Data))
+	var errs []error
+	for _, q := range s.queues {
+		if err := q.enqueue(ctx, queuedMeasurement{Measurement: pm}); err != nil {
+			errs = append(errs, fmt.Errorf("exporter %s: %w", q.exp.Name(), err))
+		}
 	}
-	return errors.Join(allErrs...)
+	return errors.Join(errs...)
 }
 
 func containsKeys[Map1 ~map[K]V1, K comparable, V1 any, Map2 ~map[K]V2, V2 any](m1 Map1, m2 Map2) bool {
@@ -0,0 +1,91 @@
+// Package tlsconfig builds TLS client configurations from the TLS options shared by the
+// exporters
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Config struct {
+	// CaFile is a PEM file of the CA certificates used to verify the server instead of the
+	// system roots
+	CaFile string
+	// CertFile and KeyFile are PEM files of the client certificate and its private key
+	// for mutual TLS
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name used to verify the server certificate
+	ServerName string
+	// MinVersion is the minimum TLS version: 1.0, 1.1, 1.2 or 1.3. Defaults to 1.2.
+	MinVersion string
+	// InsecureSkipVerify disables the verification of the server certificate
+	InsecureSkipVerify bool
+}
+
+// Enabled returns true if any of the options is set
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+func Validate(cfg Config) error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("both cert_file and key_file must be specified")
+	}
+	if _, err := parseVersion(cfg.MinVersion); err != nil {
+		return err
+	}
+	return nil
+}
+
+// New creates a TLS client configuration
+func New(cfg Config) (*tls.Config, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	minVersion, _ := parseVersion(cfg.MinVersion)
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		MinVersion:         minVersion,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec
+	}
+	if cfg.CaFile != "" {
+		ca, err := os.ReadFile(cfg.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CaFile)
+		}
+		tlsConfig.RootCAs = certPool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func parseVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+	case "":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS version: %s", version)
+	}
+}
@@ -0,0 +1,486 @@
+// Package wal implements a durable first-in first-out queue of records stored on disk as a
+// segmented write-ahead log
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrEmpty is returned by Peek when there are no records in the log
+var ErrEmpty = errors.New("log is empty")
+
+const (
+	segmentSuffix = ".wal"
+	cursorFile    = "cursor"
+	// Record header: payload length, CRC-32 of timestamp and payload, timestamp
+	headerSize = 4 + 4 + 8
+	// MaxRecordSize is the maximum size of a record payload
+	MaxRecordSize = 16 << 20
+)
+
+// Options configures a log
+type Options struct {
+	// SegmentSize is the size after which a new segment file is started. Defaults to 4 MiB.
+	SegmentSize int64
+	// MaxSize is the maximum total size of the segment files. The oldest records are
+	// discarded when the limit is exceeded. Zero means no limit.
+	MaxSize int64
+	// MaxAge is the maximum age of records. Older records are discarded. Zero means no limit.
+	MaxAge time.Duration
+}
+
+// Record is a single entry of the log
+type Record struct {
+	Timestamp time.Time
+	Data      []byte
+}
+
+type position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// Log is a segmented write-ahead log. Records are appended to the newest segment and read
+// and acknowledged in order from the oldest segment. Fully acknowledged segments are deleted.
+type Log struct {
+	dir      string
+	opts     Options
+	mu       sync.Mutex
+	segments []uint64
+	active   *os.File
+	size     map[uint64]int64
+	cursor   position
+	// next is the position after the last peeked record
+	next    position
+	reader  *os.File
+	dropped uint64
+}
+
+// Open opens or creates a log in the given directory
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 4 << 20
+	}
+	if opts.MaxSize > 0 && opts.SegmentSize > opts.MaxSize/4 {
+		opts.SegmentSize = max(opts.MaxSize/4, headerSize)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	l := &Log{
+		dir:  dir,
+		opts: opts,
+		size: make(map[uint64]int64),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentSuffix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		l.segments = append(l.segments, seq)
+	}
+	slices.Sort(l.segments)
+	if err := l.loadCursor(); err != nil {
+		return nil, err
+	}
+	for _, seq := range l.segments {
+		fi, err := os.Stat(l.segmentPath(seq))
+		if err != nil {
+			return nil, err
+		}
+		l.size[seq] = fi.Size()
+	}
+	if len(l.segments) == 0 {
+		if err := l.newSegment(l.cursor.Segment); err != nil {
+			return nil, err
+		}
+	} else if err := l.openActive(); err != nil {
+		return nil, err
+	}
+	if len(l.segments) > 0 && l.cursor.Segment < l.segments[0] {
+		l.cursor = position{Segment: l.segments[0]}
+	}
+	l.next = l.cursor
+	return l, nil
+}
+
+// Append adds a record to the end of the log and syncs it to disk
+func (l *Log) Append(data []byte) error {
+	return l.AppendRecord(Record{Timestamp: time.Now(), Data: data})
+}
+
+// AppendRecord adds a record with the given timestamp to the end of the log and syncs it to disk
+func (l *Log) AppendRecord(r Record) error {
+	if len(r.Data) > MaxRecordSize {
+		return fmt.Errorf("record size %d exceeds maximum %d", len(r.Data), MaxRecordSize)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active == nil {
+		return os.ErrClosed
+	}
+	seq := l.segments[len(l.segments)-1]
+	if l.size[seq] >= l.opts.SegmentSize {
+		if err := l.newSegment(seq + 1); err != nil {
+			return err
+		}
+		seq++
+	}
+	buf := encode(r)
+	if _, err := l.active.Write(buf); err != nil {
+		return err
+	}
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+	l.size[seq] += int64(len(buf))
+	return l.enforceMaxSize()
+}
+
+// Peek returns the oldest unacknowledged record. ErrEmpty is returned if there are no records.
+// Calling Peek again without Ack returns the same record.
+func (l *Log) Peek() (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		if l.active == nil {
+			return Record{}, os.ErrClosed
+		}
+		r, next, err := l.read(l.cursor)
+		switch {
+		case errors.Is(err, io.EOF):
+			if l.cursor.Segment >= l.segments[len(l.segments)-1] {
+				return Record{}, ErrEmpty
+			}
+			// Move on to the next segment and delete the consumed one
+			if err := l.advance(position{Segment: l.nextSegment(l.cursor.Segment)}); err != nil {
+				return Record{}, err
+			}
+			continue
+		case err != nil:
+			return Record{}, err
+		}
+		if l.opts.MaxAge > 0 && time.Since(r.Timestamp) > l.opts.MaxAge {
+			l.dropped++
+			if err := l.advance(next); err != nil {
+				return Record{}, err
+			}
+			continue
+		}
+		l.next = next
+		return r, nil
+	}
+}
+
+// Ack acknowledges the record returned by the last call to Peek so that it is removed from the log
+func (l *Log) Ack() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next == l.cursor {
+		return nil
+	}
+	return l.advance(l.next)
+}
+
+// Empty returns true if there are no unacknowledged records
+func (l *Log) Empty() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last := l.segments[len(l.segments)-1]
+	return l.cursor.Segment == last && l.cursor.Offset >= l.size[last]
+}
+
+// Size returns the total size of the segment files in bytes
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var total int64
+	for _, s := range l.size {
+		total += s
+	}
+	return total
+}
+
+// Dropped returns the number of records discarded because of size or age limits
+func (l *Log) Dropped() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped
+}
+
+// Close closes the log. Unacknowledged records are kept on disk.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	if l.reader != nil {
+		errs = append(errs, l.reader.Close())
+		l.reader = nil
+	}
+	if l.active != nil {
+		errs = append(errs, l.active.Close())
+		l.active = nil
+	}
+	return errors.Join(errs...)
+}
+
+// read reads the record at the given position. io.EOF is returned at the end of a segment
+// or if the rest of the segment is corrupted.
+func (l *Log) read(pos position) (Record, position, error) {
+	if l.reader == nil || l.reader.Name() != l.segmentPath(pos.Segment) {
+		if l.reader != nil {
+			if err := l.reader.Close(); err != nil {
+				return Record{}, pos, err
+			}
+			l.reader = nil
+		}
+		f, err := os.Open(l.segmentPath(pos.Segment))
+		if errors.Is(err, fs.ErrNotExist) {
+			return Record{}, pos, io.EOF
+		}
+		if err != nil {
+			return Record{}, pos, err
+		}
+		l.reader = f
+	}
+	if pos.Offset >= l.size[pos.Segment] {
+		return Record{}, pos, io.EOF
+	}
+	r, n, err := decode(bufio.NewReader(io.NewSectionReader(l.reader, pos.Offset, l.size[pos.Segment]-pos.Offset)))
+	if err != nil {
+		// Skip the corrupted tail of the segment
+		return Record{}, pos, io.EOF
+	}
+	return r, position{Segment: pos.Segment, Offset: pos.Offset + int64(n)}, nil
+}
+
+// advance moves the cursor to the given position and deletes segments before it
+func (l *Log) advance(pos position) error {
+	for len(l.segments) > 1 && l.segments[0] < pos.Segment {
+		if err := l.removeSegment(l.segments[0]); err != nil {
+			return err
+		}
+	}
+	l.cursor = pos
+	l.next = pos
+	return l.saveCursor()
+}
+
+func (l *Log) nextSegment(seq uint64) uint64 {
+	for _, s := range l.segments {
+		if s > seq {
+			return s
+		}
+	}
+	return seq
+}
+
+func (l *Log) enforceMaxSize() error {
+	if l.opts.MaxSize <= 0 {
+		return nil
+	}
+	for len(l.segments) > 1 {
+		var total int64
+		for _, s := range l.size {
+			total += s
+		}
+		if total <= l.opts.MaxSize {
+			return nil
+		}
+		oldest := l.segments[0]
+		if l.cursor.Segment <= oldest {
+			l.dropped += l.countRecords(oldest, l.cursor.Offset)
+			if err := l.advance(position{Segment: l.segments[1]}); err != nil {
+				return err
+			}
+		} else if err := l.removeSegment(oldest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countRecords counts the records in a segment after the given offset
+func (l *Log) countRecords(seq uint64, offset int64) uint64 {
+	var n uint64
+	pos := position{Segment: seq, Offset: offset}
+	for {
+		_, next, err := l.read(pos)
+		if err != nil {
+			return n
+		}
+		n++
+		pos = next
+	}
+}
+
+func (l *Log) newSegment(seq uint64) error {
+	if l.active != nil {
+		if err := l.active.Close(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	l.active = f
+	l.segments = append(l.segments, seq)
+	l.size[seq] = 0
+	return syncDir(l.dir)
+}
+
+// openActive opens the newest segment for appending and truncates any partially written
+// record at its end
+func (l *Log) openActive() error {
+	seq := l.segments[len(l.segments)-1]
+	path := l.segmentPath(seq)
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	var valid int64
+	br := bufio.NewReader(f)
+	for {
+		_, n, err := decode(br)
+		if err != nil {
+			break
+		}
+		valid += int64(n)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if valid < l.size[seq] {
+		if err := os.Truncate(path, valid); err != nil {
+			return err
+		}
+		l.size[seq] = valid
+	}
+	l.active, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0640) //nolint:gosec
+	return err
+}
+
+func (l *Log) removeSegment(seq uint64) error {
+	if l.reader != nil && l.reader.Name() == l.segmentPath(seq) {
+		if err := l.reader.Close(); err != nil {
+			return err
+		}
+		l.reader = nil
+	}
+	if err := os.Remove(l.segmentPath(seq)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	l.segments = slices.DeleteFunc(l.segments, func(s uint64) bool {
+		return s == seq
+	})
+	delete(l.size, seq)
+	return nil
+}
+
+func (l *Log) segmentPath(seq uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func (l *Log) loadCursor() error {
+	content, err := os.ReadFile(filepath.Join(l.dir, cursorFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		if len(l.segments) > 0 {
+			l.cursor = position{Segment: l.segments[0]}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, &l.cursor); err != nil {
+		return fmt.Errorf("invalid cursor file: %w", err)
+	}
+	return nil
+}
+
+func (l *Log) saveCursor() error {
+	content, err := json.Marshal(l.cursor)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(l.dir, cursorFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	// The cursor must be on disk before the rename or a crash could leave an empty cursor file
+	if err := errors.Join(f.Sync(), f.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(l.dir, cursorFile)); err != nil {
+		return err
+	}
+	return syncDir(l.dir)
+}
+
+func encode(r Record) []byte {
+	buf := make([]byte, headerSize+len(r.Data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(r.Data)))             //nolint:gosec
+	binary.BigEndian.PutUint64(buf[8:16], uint64(r.Timestamp.UnixNano())) //nolint:gosec
+	copy(buf[headerSize:], r.Data)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+	return buf
+}
+
+func decode(r io.Reader) (Record, int, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Record{}, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > MaxRecordSize {
+		return Record{}, 0, fmt.Errorf("invalid record size %d", size)
+	}
+	buf := make([]byte, 8+size)
+	copy(buf, header[8:16])
+	if _, err := io.ReadFull(r, buf[8:]); err != nil {
+		return Record{}, 0, err
+	}
+	if crc32.ChecksumIEEE(buf) != binary.BigEndian.Uint32(header[4:8]) {
+		return Record{}, 0, fmt.Errorf("checksum mismatch")
+	}
+	return Record{
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16]))), //nolint:gosec
+		Data:      buf[8:],
+	}, headerSize + int(size), nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
@@ -0,0 +1,111 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, l *Log) []string {
+	t.Helper()
+	var records []string
+	for {
+		r, err := l.Peek()
+		if err == ErrEmpty {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, string(r.Data))
+		require.NoError(t, l.Ack())
+	}
+}
+
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, Options{SegmentSize: 64})
+	require.NoError(t, err)
+	assert.True(t, l.Empty())
+	for i := range 10 {
+		require.NoError(t, l.Append(fmt.Appendf(nil, "record %d", i)))
+	}
+	assert.False(t, l.Empty())
+
+	// Peek without Ack returns the same record
+	r, err := l.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "record 0", string(r.Data))
+	r, err = l.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "record 0", string(r.Data))
+	require.NoError(t, l.Ack())
+	r, err = l.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "record 1", string(r.Data))
+	require.NoError(t, l.Ack())
+	require.NoError(t, l.Close())
+
+	// Unacknowledged records survive reopening
+	l, err = Open(dir, Options{SegmentSize: 64})
+	require.NoError(t, err)
+	records := readAll(t, l)
+	require.Len(t, records, 8)
+	assert.Equal(t, "record 2", records[0])
+	assert.Equal(t, "record 9", records[7])
+	assert.True(t, l.Empty())
+
+	// Consumed segments are deleted
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	require.NoError(t, err)
+	assert.Len(t, segments, 1)
+	require.NoError(t, l.Close())
+}
+
+func TestLogMaxSize(t *testing.T) {
+	l, err := Open(t.TempDir(), Options{SegmentSize: 64, MaxSize: 256})
+	require.NoError(t, err)
+	for i := range 100 {
+		require.NoError(t, l.Append(fmt.Appendf(nil, "record %d", i)))
+	}
+	assert.LessOrEqual(t, l.Size(), int64(256+64))
+	records := readAll(t, l)
+	assert.Equal(t, "record 99", records[len(records)-1])
+	assert.Equal(t, uint64(100-len(records)), l.Dropped())
+	require.NoError(t, l.Close())
+}
+
+func TestLogMaxAge(t *testing.T) {
+	l, err := Open(t.TempDir(), Options{MaxAge: time.Hour})
+	require.NoError(t, err)
+	require.NoError(t, l.AppendRecord(Record{Timestamp: time.Now().Add(-2 * time.Hour), Data: []byte("old")}))
+	require.NoError(t, l.Append([]byte("new")))
+	assert.Equal(t, []string{"new"}, readAll(t, l))
+	assert.Equal(t, uint64(1), l.Dropped())
+	require.NoError(t, l.Close())
+}
+
+func TestLogTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, Options{})
+	require.NoError(t, err)
+	require.NoError(t, l.Append([]byte("first")))
+	require.NoError(t, l.Close())
+
+	// Simulate a crash in the middle of writing a record
+	path := filepath.Join(dir, fmt.Sprintf("%020d%s", 0, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0640)
+	require.NoError(t, err)
+	_, err = f.Write(encode(Record{Timestamp: time.Now(), Data: []byte("second")})[:10])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	l, err = Open(dir, Options{})
+	require.NoError(t, err)
+	require.NoError(t, l.Append([]byte("third")))
+	assert.Equal(t, []string{"first", "third"}, readAll(t, l))
+	require.NoError(t, l.Close())
+}